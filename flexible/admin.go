@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/hostkit"
+	common "github.com/slackmgr/types"
+)
+
+// registerAdminHandlers adds the admin endpoints to the admin mux.
+// The endpoints are only registered if an admin token is configured, since they must never be exposed without authentication.
+func registerAdminHandlers(mux *http.ServeMux, cfg *config.Config, reloader *settingsReloader, ingress *ingressServer, levels *hostkit.LogLevels, logger common.Logger) {
+	if cfg.AdminToken == "" {
+		logger.Info("Admin endpoints are disabled (ADMIN_TOKEN is not set)")
+
+		if cfg.EnablePprof {
+			logger.Error("ENABLE_PPROF is ignored, since the pprof endpoints require ADMIN_TOKEN")
+		}
+
+		return
+	}
+
+	mux.Handle("POST /admin/reload", requireAdminToken(cfg.AdminToken, handleReload(reloader, logger)))
+	mux.Handle("POST /admin/route", requireAdminToken(cfg.AdminToken, handleRouteSimulation(ingress)))
+	mux.Handle("/admin/log-level", requireAdminToken(cfg.AdminToken, handleLogLevel(levels, cfg.LogLevelRevertAfter, logger)))
+
+	if cfg.EnablePprof {
+		registerDebugHandlers(mux, cfg.AdminToken)
+		logger.Info("pprof and runtime debug endpoints enabled")
+	}
+
+	logger.Infof("Admin endpoints enabled on port %s", cfg.AdminListenPort())
+}
+
+// requireAdminToken wraps an admin handler, rejecting requests without a valid bearer token.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleReload forces an immediate reload of both settings files, and returns the result synchronously.
+// The response status is 200 if both files were applied, and 422 if either of them failed to load or validate.
+func handleReload(reloader *settingsReloader, logger common.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		logger.Info("Settings reload requested via admin endpoint")
+
+		result := reloader.reload(true)
+
+		if result.Err() != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, result)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleRouteSimulation shows which rule and channel the alerts in the request body would be routed to,
+// using the current routing rules. The optional "at" query parameter (RFC 3339) sets the time used to
+// evaluate rule schedules, and defaults to the current time. The alerts are not sent anywhere.
+func handleRouteSimulation(ingress *ingressServer) http.HandlerFunc {
+	type simulationResult struct {
+		At      time.Time        `json:"at"`
+		Results []*routeDecision `json:"results"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		at := time.Now()
+
+		if s := r.URL.Query().Get("at"); s != "" {
+			var err error
+
+			if at, err = time.Parse(time.RFC3339, s); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The at parameter must be an RFC 3339 timestamp"})
+				return
+			}
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to read POST body"})
+			return
+		}
+
+		alerts, err := parseAlertInput(body)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to parse POST body: " + err.Error()})
+			return
+		}
+
+		result := simulationResult{At: at, Results: make([]*routeDecision, 0, len(alerts))}
+
+		for _, alert := range alerts {
+			if alert != nil {
+				result.Results = append(result.Results, ingress.route(alert, "", at))
+			}
+		}
+
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleLogLevel shows and changes the log levels at runtime.
+//
+// GET returns the effective levels, the defaults and the current override. PUT sets an override, with a body
+// such as {"logLevel": "debug", "componentLogLevels": {"queue": "debug"}, "revertAfter": "30m"}. The override
+// reverts to the defaults after revertAfter, which defaults to LOG_LEVEL_REVERT_SECONDS ("0" means never).
+// DELETE clears the override.
+func handleLogLevel(levels *hostkit.LogLevels, defaultRevertAfter time.Duration, logger common.Logger) http.HandlerFunc {
+	type overrideInput struct {
+		hostkit.LogLevelSettings
+
+		RevertAfter *string `json:"revertAfter"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var input overrideInput
+
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to parse PUT body: " + err.Error()})
+				return
+			}
+
+			set, err := input.Parse(logComponents)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+
+			revertAfter := defaultRevertAfter
+
+			if input.RevertAfter != nil {
+				if revertAfter, err = time.ParseDuration(*input.RevertAfter); err != nil || revertAfter < 0 {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The revertAfter field must be a non-negative duration, e.g. 30m"})
+					return
+				}
+			}
+
+			levels.SetOverride(set, revertAfter)
+			logger.Infof("Log level override set via admin endpoint (reverts after %s)", revertAfter)
+		case http.MethodDelete:
+			levels.ClearOverride()
+			logger.Info("Log level override cleared via admin endpoint")
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, levels.Status())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
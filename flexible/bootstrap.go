@@ -3,31 +3,37 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	awscfg "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/eko/gocache/lib/v4/store"
 	redis_store "github.com/eko/gocache/store/rediscluster/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	redis "github.com/redis/go-redis/v9"
 	managerconfig "github.com/slackmgr/core/config"
 	manager "github.com/slackmgr/core/manager"
 	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/flexible/routing"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/natsqueue"
+	"github.com/slackmgr/examples/hostkit/queuechaos"
+	"github.com/slackmgr/examples/hostkit/ratelimit"
+	"github.com/slackmgr/examples/hostkit/redisheaders"
+	"github.com/slackmgr/examples/hostkit/sqlitestore"
 	dynamodb "github.com/slackmgr/plugins/dynamodb"
 	postgres "github.com/slackmgr/plugins/postgres"
 	sqs "github.com/slackmgr/plugins/sqs"
 	"github.com/slackmgr/types"
-	"gopkg.in/yaml.v2"
 )
 
 // newRedisClient creates a new Redis client based on the provided configuration.
@@ -55,40 +61,107 @@ func newCacheStore(client redis.UniversalClient) store.StoreInterface {
 }
 
 // newAlertQueue creates a new alert queue based on the provided configuration.
-// It supports SQS, Redis, and in-memory queue modes, depending on the QueueMode setting in the config.
-func newAlertQueue(ctx context.Context, redisClient redis.UniversalClient, channelLocker manager.ChannelLocker, cfg *config.Config, logger *Logger) (manager.FifoQueue, error) {
+// It supports SQS, Redis, NATS JetStream and in-memory queue modes, depending on the QueueMode setting in the config.
+// The queue is wrapped with the injected failures in QueueChaos, if any, and with the host instrumentation.
+// The returned function closes the connection of the queue, if it has one, and must be called on shutdown.
+func newAlertQueue(ctx context.Context, redisClient redis.UniversalClient, channelLocker manager.ChannelLocker, inst *instrumentation, cfg *config.Config, logger *hostkit.Logger) (manager.FifoQueue, func(), error) {
+	var queue manager.FifoQueue
+	var err error
+
+	closeQueue := func() {}
+
 	switch strings.ToLower(cfg.QueueMode) {
 	case "sqs":
-		return newSQSClient(ctx, &cfg.Aws, &cfg.Aws.AlertQueue, logger)
+		queue, err = newSQSQueue(ctx, &cfg.Aws, &cfg.Aws.AlertQueue, logger)
 	case "redis":
-		return manager.NewRedisFifoQueue(redisClient, channelLocker, "alerts", logger).Init()
+		queue, err = newRedisQueue(redisClient, channelLocker, "alerts", logger.WithComponent("queue"))
+	case "nats":
+		queue, closeQueue, err = newNATSQueue(ctx, &cfg.Nats, cfg.Nats.AlertStream, logger)
 	case "in-memory":
-		return types.NewInMemoryFifoQueue("alerts", 1000, 5*time.Second), nil
+		queue = &envelopeQueue{queue: types.NewInMemoryFifoQueue("alerts", 1000, 5*time.Second)}
 	default:
-		return nil, fmt.Errorf("unknown queue mode: %s", cfg.QueueMode)
+		return nil, nil, fmt.Errorf("unknown queue mode: %s", cfg.QueueMode)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queue = withQueueChaos(queue, &cfg.QueueChaos, logger)
+
+	return inst.wrapQueue(queue, strings.ToLower(cfg.QueueMode)), closeQueue, nil
+}
+
+// withQueueChaos wraps the queue with the failures in the chaos config, or returns it unchanged if there are none.
+// The instrumentation wraps the chaos queue, so the injected failures show up in the queue metrics and traces.
+func withQueueChaos(queue manager.FifoQueue, cfg *config.QueueChaosConfig, logger *hostkit.Logger) manager.FifoQueue {
+	opts := queuechaos.Options{
+		MaxLatency:    cfg.MaxLatency,
+		DropRate:      cfg.DropRate,
+		DuplicateRate: cfg.DuplicateRate,
+		SendErrorRate: cfg.SendErrorRate,
+	}
+
+	if !opts.Enabled() {
+		return queue
+	}
+
+	logger.WithField("queue", queue.Name()).Infof("Injecting queue failures: max latency %s, drop rate %g, duplicate rate %g, send error rate %g",
+		opts.MaxLatency, opts.DropRate, opts.DuplicateRate, opts.SendErrorRate)
+
+	return queuechaos.Wrap(queue, opts)
+}
+
+// newRateLimiter creates the rate limiter used by the ingress, based on the RateLimitMode setting in the config.
+// The local limiter enforces the limits per replica, while the Redis limiter shares the limits across all replicas.
+func newRateLimiter(redisClient redis.UniversalClient, cfg *config.Config, logger *hostkit.Logger) (ratelimit.Limiter, error) {
+	switch strings.ToLower(cfg.RateLimitMode) {
+	case "local":
+		return ratelimit.NewLocal(ratelimit.DefaultMaxBuckets), nil
+	case "redis":
+		return ratelimit.NewRedis(redisClient, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit mode: %s", cfg.RateLimitMode)
 	}
 }
 
 // newCommandQueue creates a new command queue based on the provided configuration.
-// It supports SQS, Redis, and in-memory queue modes, depending on the QueueMode setting in the config.
-func newCommandQueue(ctx context.Context, redisClient redis.UniversalClient, channelLocker manager.ChannelLocker, cfg *config.Config, logger *Logger) (manager.FifoQueue, error) {
+// It supports SQS, Redis, NATS JetStream and in-memory queue modes, depending on the QueueMode setting in the config.
+// The queue is wrapped with the injected failures in QueueChaos, if any, and with the host instrumentation.
+// The returned function closes the connection of the queue, if it has one, and must be called on shutdown.
+func newCommandQueue(ctx context.Context, redisClient redis.UniversalClient, channelLocker manager.ChannelLocker, inst *instrumentation, cfg *config.Config, logger *hostkit.Logger) (manager.FifoQueue, func(), error) {
+	var queue manager.FifoQueue
+	var err error
+
+	closeQueue := func() {}
+
 	switch strings.ToLower(cfg.QueueMode) {
 	case "sqs":
-		return newSQSClient(ctx, &cfg.Aws, &cfg.Aws.CommandQueue, logger)
+		queue, err = newSQSQueue(ctx, &cfg.Aws, &cfg.Aws.CommandQueue, logger)
 	case "redis":
-		return manager.NewRedisFifoQueue(redisClient, channelLocker, "commands", logger).Init()
+		queue, err = newRedisQueue(redisClient, channelLocker, "commands", logger.WithComponent("queue"))
+	case "nats":
+		queue, closeQueue, err = newNATSQueue(ctx, &cfg.Nats, cfg.Nats.CommandStream, logger)
 	case "in-memory":
-		return types.NewInMemoryFifoQueue("commands", 1000, 5*time.Second), nil
+		queue = &envelopeQueue{queue: types.NewInMemoryFifoQueue("commands", 1000, 5*time.Second)}
 	case "":
-		return nil, errors.New("queue mode is not set (QUEUE_MODE=<mode>)")
+		return nil, nil, errors.New("queue mode is not set (QUEUE_MODE=<mode>)")
 	default:
-		return nil, fmt.Errorf("unknown queue mode: %s", cfg.QueueMode)
+		return nil, nil, fmt.Errorf("unknown queue mode: %s", cfg.QueueMode)
 	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queue = withQueueChaos(queue, &cfg.QueueChaos, logger)
+
+	return inst.wrapQueue(queue, strings.ToLower(cfg.QueueMode)), closeQueue, nil
 }
 
-// newSQSClient creates a new SQS client based on the provided AWS and SQS queue configuration.
+// newSQSQueue creates a new SQS queue based on the provided AWS and SQS queue configuration.
 // Only relevant if SQS is used as the queue mode.
-func newSQSClient(ctx context.Context, cfg *config.AwsConfig, queueCfg *config.SqsQueueConfig, logger *Logger) (*sqs.Client, error) {
+func newSQSQueue(ctx context.Context, cfg *config.AwsConfig, queueCfg *config.SqsQueueConfig, logger *hostkit.Logger) (*sqsHeaderQueue, error) {
 	awsCfg, err := createAwsCfg(ctx, cfg, logger)
 	if err != nil {
 		return nil, err
@@ -102,27 +175,110 @@ func newSQSClient(ctx context.Context, cfg *config.AwsConfig, queueCfg *config.S
 		sqs.WithSqsAPIMaxRetryBackoffDelay(cfg.MaxRetryBackoffDelay),
 	}
 
-	return sqs.New(awsCfg, queueCfg.QueueName, logger, opts...).Init(ctx)
+	// The API client is created here, with the same retry settings as the plugin would use, so that it can be wrapped
+	// to send the message headers as message attributes.
+	api := awssqs.NewFromConfig(*awsCfg, func(o *awssqs.Options) {
+		o.Retryer = retry.AddWithMaxBackoffDelay(o.Retryer, cfg.MaxRetryBackoffDelay)
+		o.Retryer = retry.AddWithMaxAttempts(o.Retryer, cfg.MaxRetryAttempts)
+	})
+
+	return newSQSHeaderQueue(ctx, awsCfg, queueCfg.QueueName, api, logger.WithComponent("queue"), opts...)
+}
+
+// newRedisQueue creates and initializes a Redis queue, which sends the message headers as a stream field.
+// Only relevant if Redis is used as the queue mode.
+func newRedisQueue(client redis.UniversalClient, locker manager.ChannelLocker, name string, logger types.Logger, opts ...manager.RedisFifoQueueOption) (*redisheaders.Queue, error) {
+	headerClient := redisheaders.NewClient(client)
+
+	queue, err := manager.NewRedisFifoQueue(headerClient, locker, name, logger, opts...).Init()
+	if err != nil {
+		return nil, err
+	}
+
+	return redisheaders.Wrap(queue, headerClient), nil
+}
+
+// newNATSQueue connects to NATS and creates a JetStream queue on the named stream. Each queue has its own connection.
+// The returned function drains the connection, so that pending acks are sent before it is closed, and waits for it to
+// close. The channel consumers are deleted by the server once they have been unused for the inactive threshold.
+func newNATSQueue(ctx context.Context, cfg *config.NatsConfig, streamName string, logger *hostkit.Logger) (*natsqueue.Queue, func(), error) {
+	closed := make(chan struct{})
+
+	opts := []nats.Option{
+		nats.Name("slack-manager"),
+		nats.MaxReconnects(-1),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	}
+
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredentialsFile))
+	}
+
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	queue, err := natsqueue.New(js, streamName, logger.WithComponent("queue"),
+		natsqueue.WithConsumerName(cfg.ConsumerName),
+		natsqueue.WithAckWait(cfg.AckWait),
+		natsqueue.WithChannelIdleTimeout(cfg.IdleTimeout),
+		natsqueue.WithInactiveThreshold(cfg.InactiveThreshold),
+		natsqueue.WithReplicas(cfg.Replicas),
+	).Init(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	closeConn := func() {
+		if err := conn.Drain(); err != nil {
+			logger.WithField("queue", streamName).Errorf("Failed to drain NATS connection: %s", err)
+			conn.Close()
+		}
+
+		<-closed
+	}
+
+	return queue, closeConn, nil
 }
 
 // newDatabase creates a new database client based on the provided configuration.
-// It supports DynamoDB and Postgres, depending on the DatabaseMode setting in the config.
-func newDatabase(ctx context.Context, cfg *config.Config, logger *Logger) (types.DB, error) {
+// It supports DynamoDB, Postgres and SQLite, depending on the DatabaseMode setting in the config.
+// The database is wrapped with the host instrumentation.
+func newDatabase(ctx context.Context, inst *instrumentation, cfg *config.Config, logger *hostkit.Logger) (types.DB, error) {
+	var db types.DB
+	var err error
+
 	switch strings.ToLower(cfg.DatabaseMode) {
 	case "dynamodb":
-		return newDynamoDBClient(ctx, &cfg.Aws, logger)
+		db, err = newDynamoDBClient(ctx, &cfg.Aws, logger)
 	case "postgres":
-		return newPostgresClient(ctx, &cfg.Postgres, logger)
+		db, err = newPostgresClient(ctx, &cfg.Postgres, logger)
+	case "sqlite":
+		db, err = newSqliteDB(ctx, &cfg.Sqlite, logger)
 	case "":
 		return nil, errors.New("database mode is not set (DATABASE_MODE=<mode>)")
 	default:
 		return nil, fmt.Errorf("unknown database mode: %s", cfg.DatabaseMode)
 	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.wrapDB(db, strings.ToLower(cfg.DatabaseMode)), nil
 }
 
 // newPostgresClient creates a new Postgres client based on the provided Postgres configuration.
 // Only relevant if Postgres is used as the database.
-func newPostgresClient(ctx context.Context, cfg *config.PostgresConfig, logger *Logger) (*postgres.Client, error) {
+func newPostgresClient(ctx context.Context, cfg *config.PostgresConfig, logger *hostkit.Logger) (*postgres.Client, error) {
 	if cfg.Host == "" {
 		return nil, errors.New("postgres host is empty")
 	}
@@ -153,7 +309,7 @@ func newPostgresClient(ctx context.Context, cfg *config.PostgresConfig, logger *
 		opts = append(opts, postgres.WithSSLKey(cfg.SSLKey))
 	}
 
-	client := postgres.New(logger, opts...)
+	client := postgres.New(logger.WithComponent("database"), opts...)
 
 	if err := client.Connect(ctx); err != nil {
 		return nil, err
@@ -170,9 +326,38 @@ func newPostgresClient(ctx context.Context, cfg *config.PostgresConfig, logger *
 	return client, nil
 }
 
+// newSqliteDB opens the SQLite database file, and applies any pending schema migrations.
+// Only relevant if SQLite is used as the database.
+func newSqliteDB(ctx context.Context, cfg *config.SqliteConfig, logger *hostkit.Logger) (*sqlitestore.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("sqlite path is empty")
+	}
+
+	db, err := sqlitestore.Open(cfg.Path,
+		sqlitestore.WithIssuesTable(cfg.IssuesTable),
+		sqlitestore.WithAlertsTable(cfg.AlertsTable),
+		sqlitestore.WithMoveMappingsTable(cfg.MoveMappingsTable),
+		sqlitestore.WithChannelProcessingStateTable(cfg.ChannelProcessingStateTable),
+		sqlitestore.WithSchemaMigrationsTable(cfg.SchemaMigrationsTable),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Opened SQLite database %s", cfg.Path)
+
+	if err := db.Init(ctx, false); err != nil {
+		return nil, fmt.Errorf("failed to initialize SQLite database: %w", err)
+	}
+
+	logger.Infof("Initialized SQLite database %s", cfg.Path)
+
+	return db, nil
+}
+
 // newDynamoDBClient creates a new DynamoDB client based on the provided AWS configuration.
 // Only relevant if DynamoDB is used as the database.
-func newDynamoDBClient(ctx context.Context, cfg *config.AwsConfig, logger *Logger) (*dynamodb.Client, error) {
+func newDynamoDBClient(ctx context.Context, cfg *config.AwsConfig, logger *hostkit.Logger) (*dynamodb.Client, error) {
 	awsCfg, err := createAwsCfg(ctx, cfg, logger)
 	if err != nil {
 		return nil, err
@@ -198,7 +383,7 @@ func newDynamoDBClient(ctx context.Context, cfg *config.AwsConfig, logger *Logge
 // createAwsCfg creates an AWS configuration based.
 // It handles static credentials, assumed roles, and default credentials.
 // Only relevant if AWS services (e.g., SQS, DynamoDB) are used.
-func createAwsCfg(ctx context.Context, c *config.AwsConfig, logger *Logger) (*aws.Config, error) {
+func createAwsCfg(ctx context.Context, c *config.AwsConfig, logger *hostkit.Logger) (*aws.Config, error) {
 	if c.Region == "" {
 		return &aws.Config{}, errors.New("cannot create AWS config with empty region")
 	}
@@ -218,7 +403,7 @@ func createAwsCfg(ctx context.Context, c *config.AwsConfig, logger *Logger) (*aw
 	// If we have a key, use static credentials
 	if c.Key != "" {
 		cfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(c.Key, c.SecretKey, c.SessionToken))
-		logger.Infof("Using static AWS credentials with key %s", c.Key)
+		logger.Info("Using static AWS credentials")
 	}
 
 	// If we have a role, assume it (possibly using the static credentials from the previous step)
@@ -235,42 +420,40 @@ func createAwsCfg(ctx context.Context, c *config.AwsConfig, logger *Logger) (*aw
 }
 
 // readManagerSettings reads and unmarshals the manager settings from the specified yaml file.
+// The file also holds the default log levels, which are not part of the core manager settings.
 // It also returns a hash of the settings for change detection, for hot-reloading purposes.
-func readManagerSettings(filename string) (*managerconfig.ManagerSettings, string, error) {
-	settingsYaml, err := os.ReadFile(filepath.Clean(filename))
+func readManagerSettings(filename string) (*managerconfig.ManagerSettings, *hostkit.LogLevelSet, string, error) {
+	var settings managerconfig.ManagerSettings
+	var logSettings hostkit.LogLevelSettings
+
+	hash, err := hostkit.ReadSettingsFile(filename, &settings, &logSettings)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read manager settings file %s: %w", filename, err)
+		return nil, nil, "", err
 	}
 
-	var settings managerconfig.ManagerSettings
-
-	if err := yaml.Unmarshal(settingsYaml, &settings); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal manager settings from %s: %w", filename, err)
+	logLevels, err := logSettings.Parse(logComponents)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid log levels in %s: %w", filename, err)
 	}
 
-	return &settings, hash(settingsYaml), nil
+	return &settings, logLevels, hash, nil
 }
 
-// readAPISettings reads and unmarshals the API settings from the specified yaml file.
+// readAPISettings reads and unmarshals the API settings (i.e. the routing rules) from the specified yaml file.
+// The settings are initialized and validated, so that invalid matcher patterns are reported when the file is loaded.
+// Rule schedules are evaluated in the given location.
 // It also returns a hash of the settings for change detection, for hot-reloading purposes.
-func readAPISettings(filename string) (*managerconfig.APISettings, string, error) {
-	settingsYaml, err := os.ReadFile(filepath.Clean(filename))
+func readAPISettings(filename string, location *time.Location) (*routing.Settings, string, error) {
+	var settings routing.Settings
+
+	hash, err := hostkit.ReadSettingsFile(filename, &settings)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read API settings file %s: %w", filename, err)
+		return nil, "", err
 	}
 
-	var settings managerconfig.APISettings
-
-	if err := yaml.Unmarshal(settingsYaml, &settings); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal API settings from %s: %w", filename, err)
+	if err := settings.InitAndValidate(location); err != nil {
+		return nil, "", fmt.Errorf("invalid API settings in %s: %w", filename, err)
 	}
 
-	return &settings, hash(settingsYaml), nil
-}
-
-func hash(input []byte) string {
-	h := sha256.New()
-	h.Write(input)
-	bs := h.Sum(nil)
-	return hex.EncodeToString(bs)
+	return &settings, hash, nil
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	managerconfig "github.com/slackmgr/core/config"
@@ -11,23 +13,74 @@ import (
 
 type Config struct {
 	LogJSON                 bool
+	LogSinks                string
+	LogStderrLevel          string
+	LogFilePath             string
+	LogFileMaxSizeMB        int
+	LogFileMaxAgeDays       int
+	LogFileMaxBackups       int
+	LogFileCompress         bool
+	LogFileLevel            string
+	LogFileJSON             bool
+	LogSyslogNetwork        string
+	LogSyslogAddr           string
+	LogSyslogTag            string
+	LogSyslogLevel          string
+	LogSyslogJSON           bool
+	LogSlogFormat           string
+	LogSlogLevel            string
 	Verbose                 bool
+	LogLevelRevertAfter     time.Duration
+	LogRedactFields         string
+	LogSampleBurst          int
+	LogSampleEvery          int
+	LogSamplePeriod         time.Duration
+	LogSampleLevels         string
+	LogDedupInterval        time.Duration
+	LogDedupLevels          string
 	Location                string
 	RestPort                string
+	APIInternalPort         string
 	EncryptionKey           string
 	SkipDatabaseCache       bool
 	EnableMetrics           bool
 	MetricsPort             string
+	MetricsBindAddr         string
+	MetricsTLSCertFile      string
+	MetricsTLSKeyFile       string
+	MetricsAuthToken        string // #nosec G117
+	MetricsAuthUsername     string
+	MetricsAuthPassword     string // #nosec G117
+	MetricsService          string
+	MetricsRole             string
+	MetricsInstance         string
+	MetricsGoCollectors     bool
+	MetricsMaxSeries        int
+	MetricsBackend          string
+	MetricsOTLPProtocol     string
+	MetricsOTLPInterval     time.Duration
+	MetricsStatsDAddr       string
+	MetricsStatsDInterval   time.Duration
+	TracingExporter         string
+	TracingOTLPProtocol     string
+	TracingSampleRatio      float64
+	AdminToken              string // #nosec G117
+	AdminPort               string
+	EnablePprof             bool
 	QueueMode               string
 	DatabaseMode            string
 	ManagerSettingsFilename string
 	APISettingsFilename     string
 	APIAlertsPerSecond      float64
 	APIAllowedBurst         int
+	RateLimitMode           string
 	Aws                     AwsConfig
 	Postgres                PostgresConfig
+	Sqlite                  SqliteConfig
 	Slack                   SlackConfig
 	Redis                   RedisConfig
+	Nats                    NatsConfig
+	QueueChaos              QueueChaosConfig
 }
 
 type AwsConfig struct {
@@ -73,6 +126,15 @@ type PostgresConfig struct {
 	SchemaMigrationsTable       string
 }
 
+type SqliteConfig struct {
+	Path                        string
+	IssuesTable                 string
+	AlertsTable                 string
+	MoveMappingsTable           string
+	ChannelProcessingStateTable string
+	SchemaMigrationsTable       string
+}
+
 type SlackConfig struct {
 	AppToken string
 	BotToken string
@@ -85,22 +147,92 @@ type RedisConfig struct {
 	DB       int
 }
 
+// NatsConfig is used by the nats queue mode, which runs the alert and command queues on NATS JetStream streams.
+type NatsConfig struct {
+	URL               string
+	CredentialsFile   string
+	AlertStream       string
+	CommandStream     string
+	ConsumerName      string
+	AckWait           time.Duration
+	IdleTimeout       time.Duration
+	InactiveThreshold time.Duration
+	Replicas          int
+}
+
+// QueueChaosConfig injects failures into the alert and command queues, to test how the manager copes with them.
+// All failures are disabled by default. Never enable them in production!
+type QueueChaosConfig struct {
+	MaxLatency    time.Duration
+	DropRate      float64
+	DuplicateRate float64
+	SendErrorRate float64
+}
+
 func New() *Config {
 	return &Config{
 		LogJSON:                 GetEnvBoolIfSet("LOG_JSON", true),
+		LogSinks:                GetEnvIfSet("LOG_SINKS", "stderr"),
+		LogStderrLevel:          GetEnvIfSet("LOG_STDERR_LEVEL", ""),
+		LogFilePath:             GetEnvIfSet("LOG_FILE_PATH", ""),
+		LogFileMaxSizeMB:        GetEnvIntIfSet("LOG_FILE_MAX_SIZE_MB", 100),
+		LogFileMaxAgeDays:       GetEnvIntIfSet("LOG_FILE_MAX_AGE_DAYS", 0),
+		LogFileMaxBackups:       GetEnvIntIfSet("LOG_FILE_MAX_BACKUPS", 5),
+		LogFileCompress:         GetEnvBoolIfSet("LOG_FILE_COMPRESS", true),
+		LogFileLevel:            GetEnvIfSet("LOG_FILE_LEVEL", ""),
+		LogFileJSON:             GetEnvBoolIfSet("LOG_FILE_JSON", true),
+		LogSyslogNetwork:        GetEnvIfSet("LOG_SYSLOG_NETWORK", ""),
+		LogSyslogAddr:           GetEnvIfSet("LOG_SYSLOG_ADDR", ""),
+		LogSyslogTag:            GetEnvIfSet("LOG_SYSLOG_TAG", "slackmgr"),
+		LogSyslogLevel:          GetEnvIfSet("LOG_SYSLOG_LEVEL", ""),
+		LogSyslogJSON:           GetEnvBoolIfSet("LOG_SYSLOG_JSON", true),
+		LogSlogFormat:           GetEnvIfSet("LOG_SLOG_FORMAT", "json"),
+		LogSlogLevel:            GetEnvIfSet("LOG_SLOG_LEVEL", ""),
 		Verbose:                 GetEnvBoolIfSet("VERBOSE", false),
+		LogLevelRevertAfter:     GetEnvSecondsIfSet("LOG_LEVEL_REVERT_SECONDS", 900),
+		LogRedactFields:         GetEnvIfSet("LOG_REDACT_FIELDS", ""),
+		LogSampleBurst:          GetEnvIntIfSet("LOG_SAMPLE_BURST", 0),
+		LogSampleEvery:          GetEnvIntIfSet("LOG_SAMPLE_EVERY", 100),
+		LogSamplePeriod:         GetEnvSecondsIfSet("LOG_SAMPLE_PERIOD_SECONDS", 1),
+		LogSampleLevels:         GetEnvIfSet("LOG_SAMPLE_LEVELS", "debug,info"),
+		LogDedupInterval:        GetEnvSecondsIfSet("LOG_DEDUP_INTERVAL_SECONDS", 0),
+		LogDedupLevels:          GetEnvIfSet("LOG_DEDUP_LEVELS", "debug,info"),
 		Location:                GetEnvIfSet("LOCATION", "Europe/Oslo"),
 		RestPort:                GetEnvIfSet("REST_PORT", "8080"),
+		APIInternalPort:         GetEnvIfSet("API_INTERNAL_PORT", "8081"),
 		EncryptionKey:           GetEnvIfSet("ENCRYPTION_KEY", ""),
 		SkipDatabaseCache:       GetEnvBoolIfSet("SKIP_DATABASE_CACHE", false),
 		EnableMetrics:           GetEnvBoolIfSet("ENABLE_METRICS", true),
 		MetricsPort:             GetEnvIfSet("METRICS_PORT", "9090"),
+		MetricsBindAddr:         GetEnvIfSet("METRICS_BIND_ADDR", ""),
+		MetricsTLSCertFile:      GetEnvIfSet("METRICS_TLS_CERT_FILE", ""),
+		MetricsTLSKeyFile:       GetEnvIfSet("METRICS_TLS_KEY_FILE", ""),
+		MetricsAuthToken:        GetEnvIfSet("METRICS_AUTH_TOKEN", ""),
+		MetricsAuthUsername:     GetEnvIfSet("METRICS_AUTH_USERNAME", ""),
+		MetricsAuthPassword:     GetEnvIfSet("METRICS_AUTH_PASSWORD", ""),
+		MetricsService:          GetEnvIfSet("METRICS_SERVICE", "slackmgr"),
+		MetricsRole:             GetEnvIfSet("METRICS_ROLE", ""),
+		MetricsInstance:         GetEnvIfSet("METRICS_INSTANCE", ""),
+		MetricsGoCollectors:     GetEnvBoolIfSet("METRICS_GO_COLLECTORS", true),
+		MetricsMaxSeries:        GetEnvIntIfSet("METRICS_MAX_SERIES", 1000),
+		MetricsBackend:          GetEnvIfSet("METRICS_BACKEND", "prometheus"),
+		MetricsOTLPProtocol:     GetEnvIfSet("METRICS_OTLP_PROTOCOL", "grpc"),
+		MetricsOTLPInterval:     GetEnvSecondsIfSet("METRICS_OTLP_INTERVAL_SECONDS", 60),
+		MetricsStatsDAddr:       GetEnvIfSet("METRICS_STATSD_ADDR", "127.0.0.1:8125"),
+		MetricsStatsDInterval:   GetEnvSecondsIfSet("METRICS_STATSD_FLUSH_INTERVAL_SECONDS", 10),
+		TracingExporter:         GetEnvIfSet("TRACING_EXPORTER", "none"),
+		TracingOTLPProtocol:     GetEnvIfSet("TRACING_OTLP_PROTOCOL", "grpc"),
+		TracingSampleRatio:      GetEnvFloat64IfSet("TRACING_SAMPLE_RATIO", 1),
+		AdminToken:              GetEnvIfSet("ADMIN_TOKEN", ""),
+		AdminPort:               GetEnvIfSet("ADMIN_PORT", ""),
+		EnablePprof:             GetEnvBoolIfSet("ENABLE_PPROF", false),
 		QueueMode:               GetEnvIfSet("QUEUE_MODE", "redis"),
 		DatabaseMode:            GetEnvIfSet("DATABASE_MODE", "postgres"),
 		ManagerSettingsFilename: GetEnvIfSet("MANAGER_SETTINGS_FILENAME", "manager-settings.yaml"),
 		APISettingsFilename:     GetEnvIfSet("API_SETTINGS_FILENAME", "api-settings.yaml"),
 		APIAlertsPerSecond:      GetEnvFloat64IfSet("API_ALERTS_PER_SECOND", 1),
 		APIAllowedBurst:         GetEnvIntIfSet("API_ALLOWED_BURST", 5),
+		RateLimitMode:           GetEnvIfSet("RATE_LIMIT_MODE", "local"),
 		Aws: AwsConfig{
 			Region:               GetEnvIfSet("AWS_REGION", ""),
 			Key:                  GetEnvIfSet("AWS_ACCESS_KEY_ID", ""),
@@ -143,6 +275,14 @@ func New() *Config {
 			ChannelProcessingStateTable: GetEnvIfSet("POSTGRES_CHANNEL_PROCESSING_STATE_TABLE", "channel_processing_state"),
 			SchemaMigrationsTable:       GetEnvIfSet("POSTGRES_SCHEMA_MIGRATIONS_TABLE", "schema_migrations"),
 		},
+		Sqlite: SqliteConfig{
+			Path:                        GetEnvIfSet("SQLITE_PATH", ""),
+			IssuesTable:                 GetEnvIfSet("SQLITE_ISSUES_TABLE", "issues"),
+			AlertsTable:                 GetEnvIfSet("SQLITE_ALERTS_TABLE", "alerts"),
+			MoveMappingsTable:           GetEnvIfSet("SQLITE_MOVE_MAPPINGS_TABLE", "move_mappings"),
+			ChannelProcessingStateTable: GetEnvIfSet("SQLITE_CHANNEL_PROCESSING_STATE_TABLE", "channel_processing_state"),
+			SchemaMigrationsTable:       GetEnvIfSet("SQLITE_SCHEMA_MIGRATIONS_TABLE", "schema_migrations"),
+		},
 		Slack: SlackConfig{
 			AppToken: GetEnvIfSet("SLACK_APP_TOKEN", ""),
 			BotToken: GetEnvIfSet("SLACK_BOT_TOKEN", ""),
@@ -153,9 +293,91 @@ func New() *Config {
 			Username: GetEnvIfSet("REDIS_USERNAME", ""),
 			DB:       GetEnvIntIfSet("REDIS_DB", 0),
 		},
+		Nats: NatsConfig{
+			URL:               GetEnvIfSet("NATS_URL", "nats://127.0.0.1:4222"),
+			CredentialsFile:   GetEnvIfSet("NATS_CREDENTIALS_FILE", ""),
+			AlertStream:       GetEnvIfSet("NATS_ALERT_STREAM", "SLACK_MANAGER_ALERTS"),
+			CommandStream:     GetEnvIfSet("NATS_COMMAND_STREAM", "SLACK_MANAGER_COMMANDS"),
+			ConsumerName:      GetEnvIfSet("NATS_CONSUMER_NAME", "slack-manager"),
+			AckWait:           GetEnvSecondsIfSet("NATS_ACK_WAIT_SECONDS", 120),
+			IdleTimeout:       GetEnvSecondsIfSet("NATS_CHANNEL_IDLE_TIMEOUT_SECONDS", 600),
+			InactiveThreshold: GetEnvSecondsIfSet("NATS_CONSUMER_INACTIVE_THRESHOLD_SECONDS", 86400),
+			Replicas:          GetEnvIntIfSet("NATS_REPLICAS", 1),
+		},
+		QueueChaos: QueueChaosConfig{
+			MaxLatency:    time.Duration(GetEnvIntIfSet("QUEUE_CHAOS_MAX_LATENCY_MS", 0)) * time.Millisecond,
+			DropRate:      GetEnvFloat64IfSet("QUEUE_CHAOS_DROP_RATE", 0),
+			DuplicateRate: GetEnvFloat64IfSet("QUEUE_CHAOS_DUPLICATE_RATE", 0),
+			SendErrorRate: GetEnvFloat64IfSet("QUEUE_CHAOS_SEND_ERROR_RATE", 0),
+		},
 	}
 }
 
+// MetricsBackends returns the metrics backends from the comma-separated METRICS_BACKEND list, in lower case.
+// "both" is kept as an alias for prometheus and otlp. The list is empty if metrics are disabled.
+func (c *Config) MetricsBackends() []string {
+	if !c.EnableMetrics {
+		return nil
+	}
+
+	names := []string{}
+
+	for name := range strings.SplitSeq(strings.ToLower(c.MetricsBackend), ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "both" {
+			names = append(names, "prometheus", "otlp")
+		} else {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
+
+// AdminListenPort returns the port for the admin endpoints, which defaults to the metrics port.
+func (c *Config) AdminListenPort() string {
+	if c.AdminPort == "" {
+		return c.MetricsPort
+	}
+
+	return c.AdminPort
+}
+
+// Secrets returns the non-empty secret values in the config, which must never be written to the log.
+func (c *Config) Secrets() []string {
+	values := []string{
+		c.EncryptionKey,
+		c.AdminToken,
+		c.MetricsAuthToken,
+		c.MetricsAuthPassword,
+		c.Aws.Key,
+		c.Aws.SecretKey,
+		c.Aws.SessionToken,
+		c.Postgres.Password,
+		c.Slack.AppToken,
+		c.Slack.BotToken,
+		c.Redis.Password,
+	}
+
+	return slices.DeleteFunc(values, func(value string) bool { return value == "" })
+}
+
+// RedactedFields returns the extra log field names from the comma-separated LOG_REDACT_FIELDS list, in lower case.
+func (c *Config) RedactedFields() []string {
+	fields := []string{}
+
+	for field := range strings.SplitSeq(strings.ToLower(c.LogRedactFields), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
 func (c *Config) GetManagerCfg() *managerconfig.ManagerConfig {
 	managerCfg := managerconfig.NewDefaultManagerConfig()
 
@@ -173,10 +395,15 @@ func (c *Config) GetAPICfg() *managerconfig.APIConfig {
 
 	apiCfg.Verbose = c.Verbose
 	apiCfg.LogJSON = c.LogJSON
-	apiCfg.RestPort = c.RestPort
+	apiCfg.RestPort = c.APIInternalPort // The public REST port is served by the ingress, which forwards to this port
 	apiCfg.SlackClient.BotToken = c.Slack.BotToken
 	apiCfg.SlackClient.AppToken = c.Slack.AppToken
 	apiCfg.EncryptionKey = c.EncryptionKey
+
+	// The per-channel rate limits (API_ALERTS_PER_SECOND, API_ALLOWED_BURST and the overrides in the API settings)
+	// are enforced by the ingress. The core limiter uses the same default, so that requests that bypass the ingress
+	// routing, such as Prometheus webhooks or requests sent directly to API_INTERNAL_PORT, are limited as well.
+	// The caller raises it if the API settings have higher overrides, since the core limiter can't be changed at runtime.
 	apiCfg.RateLimitPerAlertChannel = &managerconfig.RateLimitConfig{
 		AlertsPerSecond: c.APIAlertsPerSecond,
 		AllowedBurst:    c.APIAllowedBurst,
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rtpprof "runtime/pprof"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultCPUProfileSeconds is the CPU profile duration used when the seconds parameter is not set.
+	defaultCPUProfileSeconds = 30
+
+	// maxCPUProfileSeconds is the maximum CPU profile and execution trace duration accepted by the debug endpoints.
+	maxCPUProfileSeconds = 300
+)
+
+// registerDebugHandlers adds the pprof and runtime debug endpoints to the admin mux, behind the admin token.
+//
+// The standard pprof endpoints are served on /debug/pprof/, so that `go tool pprof` works against the admin port.
+// The /admin/debug endpoints are shortcuts for the most common cases: a full goroutine dump, a heap profile,
+// and a CPU profile for a given number of seconds.
+func registerDebugHandlers(mux *http.ServeMux, token string) {
+	mux.Handle("/debug/pprof/", requireAdminToken(token, http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", requireAdminToken(token, http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", requireAdminToken(token, withoutWriteTimeout(http.HandlerFunc(pprof.Profile))))
+	mux.Handle("/debug/pprof/symbol", requireAdminToken(token, http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", requireAdminToken(token, withoutWriteTimeout(http.HandlerFunc(pprof.Trace))))
+
+	mux.Handle("GET /admin/debug/goroutines", requireAdminToken(token, http.HandlerFunc(handleGoroutineDump)))
+	mux.Handle("GET /admin/debug/heap", requireAdminToken(token, pprof.Handler("heap")))
+	mux.Handle("GET /admin/debug/cpu-profile", requireAdminToken(token, withoutWriteTimeout(http.HandlerFunc(handleCPUProfile))))
+}
+
+// handleGoroutineDump writes the stack traces of all goroutines, in the same format as an unrecovered panic.
+func handleGoroutineDump(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Goroutine-Count", strconv.Itoa(runtime.NumGoroutine()))
+
+	_ = rtpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// handleCPUProfile records a CPU profile for the number of seconds in the seconds query parameter, and returns it
+// as a download for `go tool pprof`. Only one CPU profile can be recorded at a time.
+func handleCPUProfile(w http.ResponseWriter, r *http.Request) {
+	seconds := defaultCPUProfileSeconds
+
+	if s := r.URL.Query().Get("seconds"); s != "" {
+		var err error
+
+		if seconds, err = strconv.Atoi(s); err != nil || seconds < 1 || seconds > maxCPUProfileSeconds {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The seconds parameter must be an integer between 1 and " + strconv.Itoa(maxCPUProfileSeconds)})
+			return
+		}
+	}
+
+	query := r.URL.Query()
+	query.Set("seconds", strconv.Itoa(seconds))
+	r.URL.RawQuery = query.Encode()
+
+	pprof.Profile(w, r)
+}
+
+// withoutWriteTimeout removes the server write timeout for long-running profile requests, up to maxCPUProfileSeconds.
+// Requests for longer durations are rejected.
+//
+// The write deadline of the connection is extended to cover the profile duration, and the server in the request
+// context is replaced with an empty one, since the pprof handlers refuse durations longer than the server write timeout.
+func withoutWriteTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The pprof handlers fall back to their default duration if the parameter is missing or not a number.
+		seconds, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64)
+		if err == nil && (seconds > maxCPUProfileSeconds || math.IsNaN(seconds)) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "The seconds parameter must be at most " + strconv.Itoa(maxCPUProfileSeconds)})
+			return
+		}
+
+		deadline := time.Duration(max(seconds, defaultCPUProfileSeconds)+10) * time.Second
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(deadline))
+
+		ctx := context.WithValue(r.Context(), http.ServerContextKey, &http.Server{})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
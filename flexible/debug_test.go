@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandlersDuration(t *testing.T) {
+	mux := http.NewServeMux()
+	registerDebugHandlers(mux, "secret")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "profile too long", path: "/debug/pprof/profile?seconds=1000000", wantStatus: http.StatusBadRequest},
+		{name: "trace too long", path: "/debug/pprof/trace?seconds=1000000", wantStatus: http.StatusBadRequest},
+		{name: "fractional trace too long", path: "/debug/pprof/trace?seconds=300.5", wantStatus: http.StatusBadRequest},
+		{name: "cpu profile too long", path: "/admin/debug/cpu-profile?seconds=301", wantStatus: http.StatusBadRequest},
+		{name: "trace of NaN seconds", path: "/debug/pprof/trace?seconds=NaN", wantStatus: http.StatusBadRequest},
+		{name: "short trace", path: "/debug/pprof/trace?seconds=0.1", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/flexible/routing"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/ratelimit"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ingressServer is the public HTTP entry point for alerts. It sits in front of the core API server,
+// which listens on an internal port.
+//
+// Alerts posted to /alert and /alerts without a Slack channel ID are routed with the host routing rules,
+// which support more matchers than the core library. The ingress sets the channel ID on each routed alert,
+// fans out copies of alerts matching rules with multiple target channels, applies the per-channel and
+// per-rule rate limits, and forwards the request to the core API server, which handles validation and queueing.
+// All other requests are forwarded unchanged.
+type ingressServer struct {
+	cfg      *config.Config
+	logger   *hostkit.Logger
+	metrics  types.Metrics
+	settings atomic.Pointer[routing.Settings]
+	limiter  ratelimit.Limiter
+	inst     *instrumentation
+	proxy    *httputil.ReverseProxy
+}
+
+// alertsInput mirrors the input formats accepted by the core alerts endpoint:
+// either a single alert with all fields at the root level, or an object with an array of alerts.
+type alertsInput struct {
+	types.Alert
+
+	Alerts []*types.Alert `json:"alerts"`
+}
+
+func newIngressServer(cfg *config.Config, settings *routing.Settings, limiter ratelimit.Limiter, inst *instrumentation, metrics types.Metrics, logger *hostkit.Logger) *ingressServer {
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", cfg.APIInternalPort)}
+
+	s := &ingressServer{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metrics,
+		limiter: limiter,
+		inst:    inst,
+		proxy:   httputil.NewSingleHostReverseProxy(target),
+	}
+
+	metrics.RegisterCounter(ingressAlertsRateLimitedMetric, "Total alerts rejected by the ingress rate limiter", "channel", "rule")
+
+	s.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.WithTraceContext(r.Context()).Errorf("Failed to forward request to API server: %s", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "API server unavailable"})
+	}
+
+	s.settings.Store(settings)
+
+	return s
+}
+
+// UpdateSettings replaces the routing rules and rate limit overrides used by the ingress.
+// The settings must be initialized and validated by the caller.
+func (s *ingressServer) UpdateSettings(settings *routing.Settings) {
+	s.settings.Store(settings)
+}
+
+// Run starts the ingress HTTP server, and blocks until the context is cancelled or a server error occurs.
+func (s *ingressServer) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              ":" + s.cfg.RestPort,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       40 * time.Second,
+		WriteTimeout:      40 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on ingress port %s: %w", s.cfg.RestPort, err)
+	}
+
+	s.logger.Infof("Ingress listening on port %s, forwarding to API server on port %s", s.cfg.RestPort, s.cfg.APIInternalPort)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil { //nolint:contextcheck // ctx is already cancelled here
+			s.logger.Errorf("Failed to shut down ingress server: %s", err)
+		}
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// handler returns the ingress request handler. Alerts posted to the alert endpoints are routed, and all other
+// requests are forwarded unchanged.
+func (s *ingressServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /alert", s.handleAlerts)
+	mux.HandleFunc("POST /alert/{slackChannelId}", s.handleAlerts)
+	mux.HandleFunc("POST /alerts", s.handleAlerts)
+	mux.HandleFunc("POST /alerts/{slackChannelId}", s.handleAlerts)
+	mux.Handle("/", s.proxy)
+
+	return mux
+}
+
+// handleAlerts routes the alerts in the request body, and forwards the rewritten request to the API server.
+// Bodies that can't be parsed are forwarded unchanged, so that the API server reports the error in its usual format.
+//
+// The request is traced with a server span, continuing the trace of the client (if any). The trace context is added
+// to the metadata of each forwarded alert, so that the queue send span becomes a child of the request span.
+func (s *ingressServer) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx := traceContextPropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	ctx, span := s.inst.tracer.Start(ctx, r.Method+" "+r.Pattern,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", r.Pattern),
+			attribute.String("url.path", r.URL.Path),
+		),
+	)
+	defer span.End()
+
+	r = r.WithContext(ctx)
+	w = &statusRecorder{ResponseWriter: w, span: span}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to read POST body"})
+		return
+	}
+
+	if alerts, err := parseAlertInput(body); err == nil && len(alerts) > 0 {
+		channelIDFromURLParam := r.PathValue("slackChannelId")
+		routed := s.routeAlerts(ctx, alerts, channelIDFromURLParam)
+
+		span.SetAttributes(attribute.Int("slackmgr.alerts.received", len(alerts)), attribute.Int("slackmgr.alerts.routed", len(routed)))
+
+		// If the routing rules dropped every alert, there is nothing to forward. Forwarding an empty list would
+		// make the API server respond as if the request was empty.
+		if len(routed) == 0 {
+			writeJSON(w, http.StatusOK, map[string]string{"message": fmt.Sprintf("All %d alerts were dropped by the routing rules", len(alerts))})
+			return
+		}
+
+		if !s.checkRateLimits(w, r, routed, channelIDFromURLParam) {
+			return
+		}
+
+		alerts = make([]*types.Alert, len(routed))
+
+		for i, ra := range routed {
+			alerts[i] = ra.alert
+			setTraceMetadata(ctx, ra.alert)
+		}
+
+		if data, err := json.Marshal(alerts); err == nil {
+			body = data
+		}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	traceContextPropagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	s.proxy.ServeHTTP(w, r)
+}
+
+// statusRecorder records the response status code on the request span.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	span trace.Span
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	w.span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+
+	if statusCode >= http.StatusInternalServerError {
+		w.span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap returns the underlying response writer, for http.ResponseController.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// defaultRateLimit returns the per-channel rate limit for channels without an override.
+func defaultRateLimit(cfg *config.Config) routing.RateLimit {
+	return routing.RateLimit{AlertsPerSecond: cfg.APIAlertsPerSecond, AllowedBurst: cfg.APIAllowedBurst}
+}
+
+// coreRateLimit returns the per-channel rate limit of the core API server. It is the default limit, raised to the
+// highest override in the settings, so that the core limiter never rejects alerts that the ingress has accepted.
+func coreRateLimit(cfg *config.Config, settings *routing.Settings) routing.RateLimit {
+	return settings.MaxRateLimit(defaultRateLimit(cfg))
+}
+
+// checkRateLimits applies the rate limits to the routed alerts, and writes an error response if any limit is exceeded.
+// All alerts in a channel count against the channel limit, and alerts routed by a rule with a rate limit override
+// also count against the rule limit for that channel. The request is rejected as a whole, like in the core API server.
+// Alerts without a channel are not limited here, since the API server rejects them anyway.
+func (s *ingressServer) checkRateLimits(w http.ResponseWriter, r *http.Request, routed []*routedAlert, channelIDFromURLParam string) bool {
+	settings := s.settings.Load()
+	defaultLimit := defaultRateLimit(s.cfg)
+	bucketsByKey := make(map[string]*rateLimitBucket)
+	buckets := []*rateLimitBucket{}
+
+	addToBucket := func(key, channel, rule string, limit routing.RateLimit) {
+		if b, ok := bucketsByKey[key]; ok {
+			b.count++
+			return
+		}
+
+		b := &rateLimitBucket{key: key, channel: channel, rule: rule, limit: limit, count: 1}
+		bucketsByKey[key] = b
+		buckets = append(buckets, b)
+	}
+
+	for _, ra := range routed {
+		channel := ra.alert.SlackChannelID
+		if channel == "" {
+			channel = strings.ToUpper(channelIDFromURLParam)
+		}
+
+		if channel == "" {
+			continue
+		}
+
+		limit := defaultLimit
+		if l := settings.ChannelRateLimit(channel); l != nil {
+			limit = *l
+		}
+
+		addToBucket("channel:"+channel, channel, "", limit)
+
+		if l := settings.RuleRateLimit(ra.rule); l != nil {
+			addToBucket("rule:"+ra.rule+":"+channel, channel, ra.rule, *l)
+		}
+	}
+
+	for _, b := range buckets {
+		if b.count > b.limit.AllowedBurst {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Too many alerts for channel %s: %d alerts (limit: %d)", b.channel, b.count, b.limit.AllowedBurst)})
+			return false
+		}
+	}
+
+	index, retryAfter := s.limiter.Allow(r.Context(), limiterBuckets(buckets), time.Now())
+	if index < 0 {
+		return true
+	}
+
+	b := buckets[index]
+
+	retrySecs := int((retryAfter + time.Second - 1) / time.Second)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retrySecs))
+	w.Header().Set("Ratelimit-Limit", strconv.Itoa(b.limit.AllowedBurst))
+	w.Header().Set("Ratelimit-Remaining", "0")
+	w.Header().Set("Ratelimit-Reset", strconv.Itoa(retrySecs))
+
+	s.metrics.CounterAdd(ingressAlertsRateLimitedMetric, float64(b.count), b.channel, b.rule)
+
+	logger := s.logger.WithTraceContext(r.Context())
+
+	if b.rule != "" {
+		logger.Infof("Rate limit exceeded for %d alerts in channel %s routed by rule %s", b.count, b.channel, b.rule)
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("Rate limit exceeded for %d alerts in channel %s routed by rule %s", b.count, b.channel, b.rule)})
+	} else {
+		logger.Infof("Rate limit exceeded for %d alerts in channel %s", b.count, b.channel)
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": fmt.Sprintf("Rate limit exceeded for %d alerts in channel %s", b.count, b.channel)})
+	}
+
+	return false
+}
+
+// routedAlert is an alert after routing, with the name of the rule that routed it (empty if no rule applied).
+type routedAlert struct {
+	alert *types.Alert
+	rule  string
+}
+
+// routeDecision describes how a single alert is routed by the ingress.
+type routeDecision struct {
+	RouteKey  string   `json:"routeKey"`
+	AlertType string   `json:"alertType,omitempty"`
+	Severity  string   `json:"severity"`
+	Rule      string   `json:"rule,omitempty"`
+	Channels  []string `json:"channels"`
+	Reason    string   `json:"reason"`
+}
+
+// routeAlerts sets the Slack channel ID on each alert that has no explicit channel, using the routing rules.
+// Rule schedules are evaluated at ingestion time.
+//
+// Alerts matching a rule with multiple targets are copied, once per accepting target channel.
+// Alerts matching a rule where no target accepts the alert severity are dropped.
+// Alerts that don't match any rule are left unchanged, and are routed by the API server (if possible).
+func (s *ingressServer) routeAlerts(ctx context.Context, alerts []*types.Alert, channelIDFromURLParam string) []*routedAlert {
+	logger := s.logger.WithTraceContext(ctx)
+	now := time.Now()
+	routed := make([]*routedAlert, 0, len(alerts))
+
+	for _, alert := range alerts {
+		if alert == nil {
+			continue
+		}
+
+		decision := s.route(alert, channelIDFromURLParam, now)
+
+		if decision.Rule == "" {
+			logger.Debugf("No routing rule applied for route key '%s' and alert type '%s': %s", decision.RouteKey, decision.AlertType, decision.Reason)
+			routed = append(routed, &routedAlert{alert: alert})
+			continue
+		}
+
+		if len(decision.Channels) == 0 {
+			logger.Infof("Dropped alert with route key '%s' and severity '%s': %s", decision.RouteKey, decision.Severity, decision.Reason)
+			continue
+		}
+
+		for i, channel := range decision.Channels {
+			target := alert
+
+			if i > 0 {
+				target = cloneAlert(alert)
+			}
+
+			target.SlackChannelID = channel
+			routed = append(routed, &routedAlert{alert: target, rule: decision.Rule})
+		}
+
+		logger.Debugf("Routed alert with route key '%s' and alert type '%s' to rule %s (channels %v): %s", decision.RouteKey, decision.AlertType, decision.Rule, decision.Channels, decision.Reason)
+	}
+
+	return routed
+}
+
+// route finds the routing decision for a single alert at the given time, without modifying the alert channel.
+// Alerts with an explicit channel in the body or in the URL are not routed.
+func (s *ingressServer) route(alert *types.Alert, channelIDFromURLParam string, now time.Time) *routeDecision {
+	alert.Clean()
+
+	decision := &routeDecision{
+		RouteKey:  alert.RouteKey,
+		AlertType: alert.Type,
+		Severity:  string(alert.Severity),
+		Channels:  []string{},
+	}
+
+	switch {
+	case alert.SlackChannelID != "":
+		decision.Channels = append(decision.Channels, alert.SlackChannelID)
+		decision.Reason = "explicit channel in alert body"
+	case channelIDFromURLParam != "":
+		decision.Channels = append(decision.Channels, channelIDFromURLParam)
+		decision.Reason = "explicit channel in URL"
+	default:
+		rule, reason := s.settings.Load().Match(alert, now)
+		if rule != nil {
+			decision.Rule = rule.Name
+			decision.Channels = rule.TargetChannels(alert)
+
+			if len(decision.Channels) == 0 {
+				reason += ", but no target accepts the alert severity"
+			}
+		}
+
+		decision.Reason = reason
+	}
+
+	return decision
+}
+
+// cloneAlert returns a copy of the alert, with its own fields, escalations, webhooks and metadata, so that the copies
+// sent to different channels don't share any slices or maps. Values nested inside the metadata and the webhook
+// payloads are shared, since they are never modified after parsing.
+func cloneAlert(alert *types.Alert) *types.Alert {
+	c := *alert
+
+	c.Fields = clonePointers(alert.Fields, func(f types.Field) types.Field { return f })
+	c.IgnoreIfTextContains = slices.Clone(alert.IgnoreIfTextContains)
+	c.Metadata = maps.Clone(alert.Metadata)
+
+	c.Escalation = clonePointers(alert.Escalation, func(e types.Escalation) types.Escalation {
+		e.SlackMentions = slices.Clone(e.SlackMentions)
+		return e
+	})
+
+	c.Webhooks = clonePointers(alert.Webhooks, func(w types.Webhook) types.Webhook {
+		w.Payload = maps.Clone(w.Payload)
+		w.PlainTextInput = clonePointers(w.PlainTextInput, func(i types.WebhookPlainTextInput) types.WebhookPlainTextInput { return i })
+		w.CheckboxInput = clonePointers(w.CheckboxInput, func(i types.WebhookCheckboxInput) types.WebhookCheckboxInput {
+			i.Options = clonePointers(i.Options, func(o types.WebhookCheckboxOption) types.WebhookCheckboxOption { return o })
+			return i
+		})
+
+		return w
+	})
+
+	return &c
+}
+
+// clonePointers returns a new slice with a copy of each element, made by the clone function. Nil elements stay nil.
+func clonePointers[T any](items []*T, clone func(T) T) []*T {
+	if items == nil {
+		return nil
+	}
+
+	result := make([]*T, len(items))
+
+	for i, item := range items {
+		if item != nil {
+			c := clone(*item)
+			result[i] = &c
+		}
+	}
+
+	return result
+}
+
+// parseAlertInput parses the alerts request body, using the same rules as the core alerts endpoint.
+func parseAlertInput(body []byte) ([]*types.Alert, error) {
+	var alerts []*types.Alert
+
+	// The input is an array of alerts, i.e. the root level is an array.
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		if err := json.Unmarshal(body, &alerts); err != nil {
+			return nil, err
+		}
+
+		return alerts, nil
+	}
+
+	var input *alertsInput
+
+	if err := json.Unmarshal(body, &input); err != nil {
+		return nil, err
+	}
+
+	if input == nil {
+		return nil, errors.New("input is null")
+	}
+
+	// If the input contains an array of alerts, use that. Any other fields on the root level are ignored.
+	if len(input.Alerts) > 0 {
+		return input.Alerts, nil
+	}
+
+	return []*types.Alert{&input.Alert}, nil
+}
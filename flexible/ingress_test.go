@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/flexible/routing"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/ratelimit"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// apiServerStub records the alerts forwarded by the ingress, and responds like the core API server.
+type apiServerStub struct {
+	mu       sync.Mutex
+	requests [][]*types.Alert
+}
+
+func (a *apiServerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var alerts []*types.Alert
+
+	body, _ := io.ReadAll(r.Body)
+	_ = json.Unmarshal(body, &alerts)
+
+	a.mu.Lock()
+	a.requests = append(a.requests, alerts)
+	a.mu.Unlock()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (a *apiServerStub) forwarded() [][]*types.Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.requests
+}
+
+// newTestIngress starts an ingress in front of an API server stub, with the given routing rules.
+func newTestIngress(t *testing.T, rules []*routing.Rule) (*httptest.Server, *apiServerStub) {
+	t.Helper()
+
+	stub := &apiServerStub{}
+
+	apiServer := httptest.NewServer(stub)
+	t.Cleanup(apiServer.Close)
+
+	_, port, err := net.SplitHostPort(apiServer.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &routing.Settings{RoutingRules: rules}
+	if err := settings.InitAndValidate(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := hostkit.NewLogger(hostkit.LoggerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{APIInternalPort: port, APIAlertsPerSecond: 100, APIAllowedBurst: 100}
+	metrics := &types.NoopMetrics{}
+	ingress := newIngressServer(cfg, settings, ratelimit.NewLocal(0), newInstrumentation(noop.NewTracerProvider(), metrics), metrics, logger)
+
+	server := httptest.NewServer(ingress.handler())
+	t.Cleanup(server.Close)
+
+	return server, stub
+}
+
+func TestIngressRouting(t *testing.T) {
+	rules := []*routing.Rule{
+		{Name: "dropped", Matcher: routing.Matcher{Equals: []string{"noise"}}, Channels: []*routing.Target{{Channel: "CNOISE0001", Severities: []string{"panic"}}}},
+		{
+			Name:     "fan-out",
+			Matcher:  routing.Matcher{Equals: []string{"db"}},
+			Channel:  "CTEAM00001",
+			Channels: []*routing.Target{{Channel: "CONCALL001", Severities: []string{"error"}}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		wantStatus    int
+		wantForwarded [][]string
+	}{
+		{
+			name:       "all alerts dropped",
+			path:       "/alerts",
+			body:       `{"alerts": [{"routeKey": "noise", "severity": "warning"}, {"routeKey": "noise", "severity": "error"}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:          "some alerts dropped",
+			path:          "/alerts",
+			body:          `{"alerts": [{"routeKey": "noise", "severity": "warning"}, {"routeKey": "db", "severity": "warning"}]}`,
+			wantStatus:    http.StatusAccepted,
+			wantForwarded: [][]string{{"CTEAM00001"}},
+		},
+		{
+			name:          "fan-out",
+			path:          "/alert",
+			body:          `{"routeKey": "db", "severity": "error", "header": "Disk full", "fields": [{"title": "host", "value": "db1"}]}`,
+			wantStatus:    http.StatusAccepted,
+			wantForwarded: [][]string{{"CTEAM00001", "CONCALL001"}},
+		},
+		{
+			name:          "explicit channel in the URL",
+			path:          "/alert/CEXPLICIT1",
+			body:          `{"routeKey": "noise", "severity": "warning"}`,
+			wantStatus:    http.StatusAccepted,
+			wantForwarded: [][]string{{""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, stub := newTestIngress(t, rules)
+
+			resp, err := http.Post(server.URL+tt.path, "application/json", strings.NewReader(tt.body)) //nolint:noctx
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			forwarded := stub.forwarded()
+			if len(forwarded) != len(tt.wantForwarded) {
+				t.Fatalf("got %d forwarded requests, want %d", len(forwarded), len(tt.wantForwarded))
+			}
+
+			for i, alerts := range forwarded {
+				channels := make([]string, 0, len(alerts))
+				for _, alert := range alerts {
+					channels = append(channels, alert.SlackChannelID)
+				}
+
+				if !slices.Equal(channels, tt.wantForwarded[i]) {
+					t.Errorf("got forwarded channels %v, want %v", channels, tt.wantForwarded[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCloneAlert(t *testing.T) {
+	alert := &types.Alert{
+		Header:               "Disk full",
+		SlackChannelID:       "CTEAM00001",
+		Fields:               []*types.Field{{Title: "host", Value: "db1"}},
+		IgnoreIfTextContains: []string{"test"},
+		Escalation:           []*types.Escalation{{Severity: types.AlertPanic, SlackMentions: []string{"@oncall"}}},
+		Webhooks: []*types.Webhook{{
+			ID:            "restart",
+			Payload:       map[string]any{"host": "db1"},
+			CheckboxInput: []*types.WebhookCheckboxInput{{ID: "confirm", Options: []*types.WebhookCheckboxOption{{Value: "yes"}}}},
+		}},
+		Metadata: map[string]any{"team": "db"},
+	}
+
+	c := cloneAlert(alert)
+
+	c.SlackChannelID = "CONCALL001"
+	c.Fields[0].Value = "changed"
+	c.IgnoreIfTextContains[0] = "changed"
+	c.Escalation[0].SlackMentions[0] = "changed"
+	c.Webhooks[0].Payload["host"] = "changed"
+	c.Webhooks[0].CheckboxInput[0].Options[0].Value = "changed"
+	c.Metadata["team"] = "changed"
+
+	if c.Header != alert.Header {
+		t.Errorf("got header %q in the copy, want %q", c.Header, alert.Header)
+	}
+
+	original, _ := json.Marshal(alert)
+
+	if strings.Contains(string(original), "changed") || alert.SlackChannelID != "CTEAM00001" {
+		t.Errorf("changing the copy changed the original alert: %s", original)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// hostQueueOperationDurationMetric is the latency of queue sends, and the time from receive to ack or nack.
+	hostQueueOperationDurationMetric = "slackmgr_host_queue_operation_duration_seconds"
+
+	// hostQueueOperationErrorsMetric counts failed queue sends and receives, and nacked messages.
+	hostQueueOperationErrorsMetric = "slackmgr_host_queue_operation_errors_total"
+
+	// hostQueueMessagesMetric counts queue messages by event: sent, received, acked, nacked or dropped.
+	hostQueueMessagesMetric = "slackmgr_host_queue_messages_total"
+
+	// hostDBOperationDurationMetric is the latency of database calls.
+	hostDBOperationDurationMetric = "slackmgr_host_db_operation_duration_seconds"
+
+	// hostDBOperationErrorsMetric counts failed database calls.
+	hostDBOperationErrorsMetric = "slackmgr_host_db_operation_errors_total"
+)
+
+// instrumentation holds what the host needs to instrument the queues, the database and the ingress.
+// The queue and database decorators measure all backends the same way, independently of the core library metrics.
+type instrumentation struct {
+	tracer  trace.Tracer
+	metrics types.Metrics
+}
+
+func newInstrumentation(tracerProvider trace.TracerProvider, metrics types.Metrics) *instrumentation {
+	queueBuckets := []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	dbBuckets := []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+	metrics.RegisterHistogram(hostQueueOperationDurationMetric, "Duration of queue operations in seconds (send, and receive to ack or nack as process)", queueBuckets, "queue", "backend", "operation")
+	metrics.RegisterCounter(hostQueueOperationErrorsMetric, "Total failed queue operations (send, receive, and nacked messages as process)", "queue", "backend", "operation")
+	metrics.RegisterCounter(hostQueueMessagesMetric, "Total queue messages by event (sent, received, acked, nacked, dropped)", "queue", "backend", "event")
+	metrics.RegisterHistogram(hostDBOperationDurationMetric, "Duration of database calls in seconds", dbBuckets, "backend", "operation")
+	metrics.RegisterCounter(hostDBOperationErrorsMetric, "Total failed database calls", "backend", "operation")
+
+	return &instrumentation{
+		tracer:  tracerProvider.Tracer(tracerName),
+		metrics: metrics,
+	}
+}
+
+// wrapQueue returns the queue wrapped with tracing and metrics. The backend is the queue mode, e.g. "sqs".
+func (i *instrumentation) wrapQueue(queue manager.FifoQueue, backend string) manager.FifoQueue { //nolint:ireturn
+	return &instrumentedQueue{
+		queue:   queue,
+		backend: backend,
+		tracer:  i.tracer,
+		metrics: i.metrics,
+	}
+}
+
+// wrapDB returns the database wrapped with tracing and metrics. The backend is the database mode, e.g. "postgres".
+func (i *instrumentation) wrapDB(db types.DB, backend string) types.DB { //nolint:ireturn
+	return &instrumentedDB{
+		db:      db,
+		backend: backend,
+		tracer:  i.tracer,
+		metrics: i.metrics,
+	}
+}
+
+// endSpan records the error (if any) on the span, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// instrumentedQueue is a FifoQueue decorator, which traces and measures sent and received messages.
+//
+// The trace context of the sender is sent in the message headers, if the wrapped queue is a hostkit.HeaderFifoQueue.
+// Each received message gets a process span, which is a child of the send span and ends when the message is acked
+// or nacked. All queue modes of the host carry headers, see queueheaders.go and the hostkit redisheaders package. For
+// queues without headers, the process spans start new traces.
+type instrumentedQueue struct {
+	queue   manager.FifoQueue
+	backend string
+	tracer  trace.Tracer
+	metrics types.Metrics
+}
+
+func (q *instrumentedQueue) Name() string {
+	return q.queue.Name()
+}
+
+func (q *instrumentedQueue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	// The API server doesn't pass on the trace context of the request, so use the one added to the alert by the ingress.
+	body, carrier := takeTraceMetadata(body)
+	if carrier != nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = traceContextPropagator.Extract(ctx, carrier)
+	}
+
+	ctx, span := q.tracer.Start(ctx, q.queue.Name()+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(q.attributes("send", slackChannelID)...),
+	)
+
+	headers := propagation.MapCarrier{}
+	traceContextPropagator.Inject(ctx, headers)
+
+	started := time.Now()
+	err := hostkit.SendWithHeaders(ctx, q.queue, slackChannelID, dedupID, body, headers)
+
+	q.metrics.Observe(hostQueueOperationDurationMetric, time.Since(started).Seconds(), q.queue.Name(), q.backend, "send")
+
+	if err != nil {
+		q.metrics.CounterInc(hostQueueOperationErrorsMetric, q.queue.Name(), q.backend, "send")
+	} else {
+		q.metrics.CounterInc(hostQueueMessagesMetric, q.queue.Name(), q.backend, "sent")
+	}
+
+	endSpan(span, err)
+
+	return err
+}
+
+func (q *instrumentedQueue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	ch := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- hostkit.ReceiveWithHeaders(ctx, q.queue, ch)
+	}()
+
+	defer close(sinkCh)
+
+	// Forward the items until the wrapped queue closes its channel. Once the context is cancelled, the remaining
+	// items are dropped and nacked, so that the queue delivers them again.
+	for msg := range ch {
+		if msg == nil || msg.Item == nil {
+			continue
+		}
+
+		item, drop := q.traceItem(msg)
+
+		select {
+		case sinkCh <- item:
+		case <-ctx.Done():
+			drop()
+		}
+	}
+
+	err := <-errCh
+
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		q.metrics.CounterInc(hostQueueOperationErrorsMetric, q.queue.Name(), q.backend, "receive")
+	}
+
+	return err
+}
+
+// traceItem starts the process span for a received message, and ends it when the item is acked or nacked.
+// The time from receive to ack or nack is recorded as the process duration. The returned function ends the span
+// and nacks the item, for items that are dropped before they reach the receiver.
+func (q *instrumentedQueue) traceItem(msg *hostkit.FifoQueueMessage) (*types.FifoQueueItem, func()) {
+	item := msg.Item
+	started := time.Now()
+
+	q.metrics.CounterInc(hostQueueMessagesMetric, q.queue.Name(), q.backend, "received")
+
+	parent := traceContextPropagator.Extract(context.Background(), propagation.MapCarrier(msg.Headers))
+
+	_, span := q.tracer.Start(parent, q.queue.Name()+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(q.attributes("process", item.SlackChannelID)...),
+		trace.WithAttributes(attribute.String("messaging.message.id", item.MessageID)),
+	)
+
+	var once sync.Once
+
+	ack, nack := item.Ack, item.Nack
+
+	item.Ack = func() {
+		once.Do(func() {
+			q.metrics.Observe(hostQueueOperationDurationMetric, time.Since(started).Seconds(), q.queue.Name(), q.backend, "process")
+			q.metrics.CounterInc(hostQueueMessagesMetric, q.queue.Name(), q.backend, "acked")
+			span.End()
+		})
+
+		if ack != nil {
+			ack()
+		}
+	}
+
+	item.Nack = func() {
+		once.Do(func() {
+			q.metrics.Observe(hostQueueOperationDurationMetric, time.Since(started).Seconds(), q.queue.Name(), q.backend, "process")
+			q.metrics.CounterInc(hostQueueMessagesMetric, q.queue.Name(), q.backend, "nacked")
+			q.metrics.CounterInc(hostQueueOperationErrorsMetric, q.queue.Name(), q.backend, "process")
+			span.SetStatus(codes.Error, "message nacked")
+			span.End()
+		})
+
+		if nack != nil {
+			nack()
+		}
+	}
+
+	drop := func() {
+		once.Do(func() {
+			q.metrics.CounterInc(hostQueueMessagesMetric, q.queue.Name(), q.backend, "dropped")
+			span.SetStatus(codes.Error, "message dropped on shutdown")
+			span.End()
+		})
+
+		if nack != nil {
+			nack()
+		}
+	}
+
+	return item, drop
+}
+
+func (q *instrumentedQueue) attributes(operation, slackChannelID string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", q.backend),
+		attribute.String("messaging.destination.name", q.queue.Name()),
+		attribute.String("messaging.operation.name", operation),
+		attribute.String("slack.channel_id", slackChannelID),
+	}
+}
+
+// instrumentedDB is a DB decorator, which creates a span and records the latency and errors of each database call.
+type instrumentedDB struct {
+	db      types.DB
+	backend string
+	tracer  trace.Tracer
+	metrics types.Metrics
+}
+
+// start starts the span for a database call. The returned function must be called with the result of the call,
+// to record the metrics and end the span.
+func (d *instrumentedDB) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	started := time.Now()
+
+	ctx, span := d.tracer.Start(ctx, "db "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", d.backend),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+
+	return ctx, func(err error) {
+		d.metrics.Observe(hostDBOperationDurationMetric, time.Since(started).Seconds(), d.backend, operation)
+
+		if err != nil {
+			d.metrics.CounterInc(hostDBOperationErrorsMetric, d.backend, operation)
+		}
+
+		endSpan(span, err)
+	}
+}
+
+func (d *instrumentedDB) Init(ctx context.Context, skipSchemaValidation bool) error {
+	ctx, done := d.start(ctx, "Init")
+	err := d.db.Init(ctx, skipSchemaValidation)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) SaveAlert(ctx context.Context, alert *types.Alert) error {
+	ctx, done := d.start(ctx, "SaveAlert")
+	err := d.db.SaveAlert(ctx, alert)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) SaveIssue(ctx context.Context, issue types.Issue) error {
+	ctx, done := d.start(ctx, "SaveIssue")
+	err := d.db.SaveIssue(ctx, issue)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) SaveIssues(ctx context.Context, issues ...types.Issue) error {
+	ctx, done := d.start(ctx, "SaveIssues")
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("db.operation.batch.size", len(issues)))
+	err := d.db.SaveIssues(ctx, issues...)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) MoveIssue(ctx context.Context, issue types.Issue, sourceChannelID, targetChannelID string) error {
+	ctx, done := d.start(ctx, "MoveIssue")
+	err := d.db.MoveIssue(ctx, issue, sourceChannelID, targetChannelID)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) FindOpenIssueByCorrelationID(ctx context.Context, channelID, correlationID string) (string, json.RawMessage, error) {
+	ctx, done := d.start(ctx, "FindOpenIssueByCorrelationID")
+	id, issue, err := d.db.FindOpenIssueByCorrelationID(ctx, channelID, correlationID)
+	done(err)
+
+	return id, issue, err
+}
+
+func (d *instrumentedDB) FindIssueBySlackPostID(ctx context.Context, channelID, postID string) (string, json.RawMessage, error) {
+	ctx, done := d.start(ctx, "FindIssueBySlackPostID")
+	id, issue, err := d.db.FindIssueBySlackPostID(ctx, channelID, postID)
+	done(err)
+
+	return id, issue, err
+}
+
+func (d *instrumentedDB) FindActiveChannels(ctx context.Context) ([]string, error) {
+	ctx, done := d.start(ctx, "FindActiveChannels")
+	channels, err := d.db.FindActiveChannels(ctx)
+	done(err)
+
+	return channels, err
+}
+
+func (d *instrumentedDB) LoadOpenIssuesInChannel(ctx context.Context, channelID string) (map[string]json.RawMessage, error) {
+	ctx, done := d.start(ctx, "LoadOpenIssuesInChannel")
+	issues, err := d.db.LoadOpenIssuesInChannel(ctx, channelID)
+	done(err)
+
+	return issues, err
+}
+
+func (d *instrumentedDB) SaveMoveMapping(ctx context.Context, moveMapping types.MoveMapping) error {
+	ctx, done := d.start(ctx, "SaveMoveMapping")
+	err := d.db.SaveMoveMapping(ctx, moveMapping)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) FindMoveMapping(ctx context.Context, channelID, correlationID string) (json.RawMessage, error) {
+	ctx, done := d.start(ctx, "FindMoveMapping")
+	moveMapping, err := d.db.FindMoveMapping(ctx, channelID, correlationID)
+	done(err)
+
+	return moveMapping, err
+}
+
+func (d *instrumentedDB) DeleteMoveMapping(ctx context.Context, channelID, correlationID string) error {
+	ctx, done := d.start(ctx, "DeleteMoveMapping")
+	err := d.db.DeleteMoveMapping(ctx, channelID, correlationID)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) SaveChannelProcessingState(ctx context.Context, state *types.ChannelProcessingState) error {
+	ctx, done := d.start(ctx, "SaveChannelProcessingState")
+	err := d.db.SaveChannelProcessingState(ctx, state)
+	done(err)
+
+	return err
+}
+
+func (d *instrumentedDB) FindChannelProcessingState(ctx context.Context, channelID string) (*types.ChannelProcessingState, error) {
+	ctx, done := d.start(ctx, "FindChannelProcessingState")
+	state, err := d.db.FindChannelProcessingState(ctx, channelID)
+	done(err)
+
+	return state, err
+}
+
+func (d *instrumentedDB) DropAllData(ctx context.Context) error {
+	ctx, done := d.start(ctx, "DropAllData")
+	err := d.db.DropAllData(ctx)
+	done(err)
+
+	return err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// headerQueueStub is an in-memory hostkit.HeaderFifoQueue, which delivers each message once.
+type headerQueueStub struct {
+	messages chan *hostkit.FifoQueueMessage
+}
+
+func newHeaderQueueStub() *headerQueueStub {
+	return &headerQueueStub{messages: make(chan *hostkit.FifoQueueMessage, 10)}
+}
+
+func (q *headerQueueStub) Name() string {
+	return "stub"
+}
+
+func (q *headerQueueStub) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.SendWithHeaders(ctx, slackChannelID, dedupID, body, nil)
+}
+
+func (q *headerQueueStub) SendWithHeaders(_ context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	item := &types.FifoQueueItem{MessageID: dedupID, SlackChannelID: slackChannelID, Body: body, Ack: func() {}, Nack: func() {}}
+	q.messages <- &hostkit.FifoQueueMessage{Item: item, Headers: headers}
+
+	return nil
+}
+
+func (q *headerQueueStub) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+func (q *headerQueueStub) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	defer close(sinkCh)
+
+	for {
+		select {
+		case msg := <-q.messages:
+			select {
+			case sinkCh <- msg:
+			case <-ctx.Done():
+				msg.Item.Nack()
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ingressAlertBody returns an alert message body, like the API server sends it, with the trace context of an
+// ingress span. The ended ingress span is returned too.
+func ingressAlertBody(t *testing.T, provider *sdktrace.TracerProvider) (string, sdktrace.ReadOnlySpan) {
+	t.Helper()
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "POST /alerts")
+
+	alert := &types.Alert{SlackChannelID: "C1", Header: "Disk full", Metadata: map[string]any{"team": "db"}}
+	setTraceMetadata(ctx, alert)
+	span.End()
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body), span.(sdktrace.ReadOnlySpan) //nolint:forcetypeassert
+}
+
+// endedSpan returns the ended span with the name suffix, or fails the test.
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder, suffix string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	for _, span := range recorder.Ended() {
+		if strings.HasSuffix(span.Name(), suffix) {
+			return span
+		}
+	}
+
+	t.Fatalf("found no ended span named *%s", suffix)
+
+	return nil
+}
+
+func TestInstrumentedQueueTracePropagation(t *testing.T) {
+	tests := []struct {
+		name       string
+		queue      manager.FifoQueue
+		wantLinked bool
+	}{
+		{name: "queue with headers", queue: newHeaderQueueStub(), wantLinked: true},
+		{name: "queue without headers", queue: types.NewInMemoryFifoQueue("in-memory", 10, time.Second), wantLinked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			queue := newInstrumentation(provider, &types.NoopMetrics{}).wrapQueue(tt.queue, "test")
+
+			body, ingressSpan := ingressAlertBody(t, provider)
+
+			if err := queue.Send(context.Background(), "C1", "d1", body); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			sinkCh := make(chan *types.FifoQueueItem)
+			errCh := make(chan error, 1)
+
+			go func() { errCh <- queue.Receive(ctx, sinkCh) }()
+
+			item := <-sinkCh
+			item.Ack()
+
+			cancel()
+			<-errCh
+
+			if strings.Contains(item.Body, traceMetadataKey) || !strings.Contains(item.Body, `"team":"db"`) {
+				t.Errorf("got body %s, want the alert metadata without the trace context", item.Body)
+			}
+
+			sendSpan := endedSpan(t, recorder, " send")
+			processSpan := endedSpan(t, recorder, " process")
+
+			if sendSpan.Parent().SpanID() != ingressSpan.SpanContext().SpanID() {
+				t.Errorf("got send span parent %s, want the ingress span %s", sendSpan.Parent().SpanID(), ingressSpan.SpanContext().SpanID())
+			}
+
+			if linked := processSpan.Parent().SpanID() == sendSpan.SpanContext().SpanID(); linked != tt.wantLinked {
+				t.Errorf("got process span parent %s with send span %s, want linked %t", processSpan.Parent().SpanID(), sendSpan.SpanContext().SpanID(), tt.wantLinked)
+			}
+		})
+	}
+}
+
+func TestInstrumentedQueueDropOnShutdown(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	stub := newHeaderQueueStub()
+	queue := newInstrumentation(provider, &types.NoopMetrics{}).wrapQueue(stub, "test")
+
+	if err := queue.Send(context.Background(), "C1", "d1", `{"header": "Disk full"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+
+	// Nobody reads from the sink channel, so the received item is dropped when the context is canceled.
+	go func() { errCh <- queue.Receive(ctx, make(chan *types.FifoQueueItem)) }()
+
+	for deadline := time.Now().Add(5 * time.Second); len(recorder.Started()) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("the process span was never started")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-errCh
+
+	processSpan := endedSpan(t, recorder, " process")
+
+	if status := processSpan.Status(); status.Code != codes.Error || status.Description != "message dropped on shutdown" {
+		t.Errorf("got process span status %v, want an error for the dropped message", status)
+	}
+}
+
+func TestTakeTraceMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantBody    string
+		wantCarrier bool
+	}{
+		{
+			name:     "command body",
+			body:     `{"action": "resolve"}`,
+			wantBody: `{"action": "resolve"}`,
+		},
+		{
+			name:        "alert with trace context",
+			body:        `{"header": "Disk full", "metadata": {"team": "db", "slackmgrTraceContext": {"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}}`,
+			wantBody:    `{"header":"Disk full","metadata":{"team":"db"}}`,
+			wantCarrier: true,
+		},
+		{
+			name:     "key outside the metadata",
+			body:     `{"header": "slackmgrTraceContext"}`,
+			wantBody: `{"header": "slackmgrTraceContext"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, carrier := takeTraceMetadata(tt.body)
+
+			if body != tt.wantBody {
+				t.Errorf("got body %s, want %s", body, tt.wantBody)
+			}
+
+			if (carrier.Get("traceparent") != "") != tt.wantCarrier {
+				t.Errorf("got carrier %v, want a trace context %t", carrier, tt.wantCarrier)
+			}
+		})
+	}
+}
@@ -1,95 +1,86 @@
 package main
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
-	"time"
+	"strings"
 
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 	"github.com/slackmgr/examples/flexible/config"
-	"github.com/slackmgr/types"
+	"github.com/slackmgr/examples/hostkit"
 )
 
-type Logger struct {
-	logger zerolog.Logger
-}
-
-func newLogger(cfg *config.Config) *Logger {
-	zerolog.TimestampFieldName = "timestamp"
-	zerolog.TimeFieldFormat = time.RFC3339Nano
-	zerolog.DurationFieldInteger = true
-	zerolog.DurationFieldUnit = time.Millisecond
+// logComponents are the components that can have their own log level.
+var logComponents = []string{"api", "bootstrap", "database", "manager", "queue"}
 
-	var level zerolog.Level
-
-	if cfg.Verbose {
-		level = zerolog.DebugLevel
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	} else {
-		level = zerolog.InfoLevel
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+// newLogger creates the root logger from the config.
+func newLogger(cfg *config.Config) (*hostkit.Logger, error) {
+	slogHandler, err := newSlogHandler(cfg.LogSlogFormat)
+	if err != nil {
+		return nil, err
 	}
 
-	var loggerInstance zerolog.Logger
-
-	if cfg.LogJSON {
-		loggerInstance = zerolog.New(os.Stderr).Level(level).With().Timestamp().Logger()
-	} else {
-		output := zerolog.ConsoleWriter{Out: os.Stderr}
-		log.Logger = log.Output(output)
-		loggerInstance = zerolog.New(output).Level(level).With().Timestamp().Logger()
+	logger, err := hostkit.NewLogger(hostkit.LoggerOptions{
+		JSON:         cfg.LogJSON,
+		Verbose:      cfg.Verbose,
+		Secrets:      cfg.Secrets(),
+		RedactFields: cfg.RedactedFields(),
+		Sinks:        strings.Split(cfg.LogSinks, ","),
+		StderrLevel:  cfg.LogStderrLevel,
+		File: hostkit.FileSinkOptions{
+			Path:       cfg.LogFilePath,
+			MaxSizeMB:  cfg.LogFileMaxSizeMB,
+			MaxAgeDays: cfg.LogFileMaxAgeDays,
+			MaxBackups: cfg.LogFileMaxBackups,
+			Compress:   cfg.LogFileCompress,
+			Level:      cfg.LogFileLevel,
+			JSON:       cfg.LogFileJSON,
+		},
+		Syslog: hostkit.SyslogSinkOptions{
+			Network: cfg.LogSyslogNetwork,
+			Addr:    cfg.LogSyslogAddr,
+			Tag:     cfg.LogSyslogTag,
+			Level:   cfg.LogSyslogLevel,
+			JSON:    cfg.LogSyslogJSON,
+		},
+		Slog: hostkit.SlogSinkOptions{
+			Handler: slogHandler,
+			Level:   cfg.LogSlogLevel,
+		},
+		Sampling: hostkit.SamplingOptions{
+			Burst:  cfg.LogSampleBurst,
+			Every:  cfg.LogSampleEvery,
+			Period: cfg.LogSamplePeriod,
+			Levels: cfg.LogSampleLevels,
+		},
+		Dedup: hostkit.DedupOptions{
+			Interval: cfg.LogDedupInterval,
+			Levels:   cfg.LogDedupLevels,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid log config: %w", err)
 	}
 
-	return &Logger{logger: loggerInstance}
-}
-
-func (l *Logger) Debug(msg string) {
-	l.logger.Debug().Msg(msg)
-}
-
-func (l *Logger) Debugf(format string, args ...any) {
-	l.logger.Debug().Msgf(format, args...)
-}
-
-func (l *Logger) Info(msg string) {
-	l.logger.Info().Msg(msg)
-}
-
-func (l *Logger) Infof(format string, args ...any) {
-	l.logger.Info().Msgf(format, args...)
-}
+	// Libraries that log with the default slog logger, or with the standard library log package, are routed through
+	// the root logger, so that their entries get the same sinks, levels and redaction. The handler passes all levels,
+	// since the levels are checked by the logger. This doesn't loop with the slog sink, which has its own handler.
+	slog.SetDefault(slog.New(hostkit.NewSlogHandler(logger, slog.LevelDebug)))
 
-func (l *Logger) Error(msg string) {
-	l.logger.Error().Msg(msg)
+	return logger, nil
 }
 
-func (l *Logger) Errorf(format string, args ...any) {
-	l.logger.Error().Msgf(format, args...)
-}
+// newSlogHandler creates the handler for the slog log sink, which writes to stderr in the given format.
+// The handler logs all levels, since the levels are checked by the logger and the sink.
+func newSlogHandler(format string) (slog.Handler, error) { //nolint:ireturn
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
 
-func (l *Logger) WithField(key string, value any) types.Logger { //nolint:ireturn
-	switch v := value.(type) {
-	case string:
-		return &Logger{logger: l.logger.With().Str(key, v).Logger()}
-	case int:
-		return &Logger{logger: l.logger.With().Int(key, v).Logger()}
-	case int32:
-		return &Logger{logger: l.logger.With().Int32(key, v).Logger()}
-	case int64:
-		return &Logger{logger: l.logger.With().Int64(key, v).Logger()}
-	case float64:
-		return &Logger{logger: l.logger.With().Float64(key, v).Logger()}
-	case bool:
-		return &Logger{logger: l.logger.With().Bool(key, v).Logger()}
-	case time.Time:
-		return &Logger{logger: l.logger.With().Time(key, v).Logger()}
-	case time.Duration:
-		return &Logger{logger: l.logger.With().Dur(key, v).Logger()}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.NewJSONHandler(os.Stderr, opts), nil
+	case "text":
+		return slog.NewTextHandler(os.Stderr, opts), nil
 	default:
-		return &Logger{logger: l.logger.With().Any(key, value).Logger()}
+		return nil, fmt.Errorf("invalid LOG_SLOG_FORMAT '%s' (expected json or text)", format)
 	}
 }
-
-func (l *Logger) WithFields(fields map[string]any) types.Logger { //nolint:ireturn
-	return &Logger{logger: l.logger.With().Fields(fields).Logger()}
-}
@@ -6,22 +6,30 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"runtime/debug"
-	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	managerpkg "github.com/slackmgr/core/manager"
 	api "github.com/slackmgr/core/restapi"
 	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/hostmetrics"
 	common "github.com/slackmgr/types"
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
-	exitMain(mainImpl())
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case dbConformanceCommand:
+			hostkit.ExitMain(runDBConformance(os.Args[2:]))
+		case queueConformanceCommand:
+			hostkit.ExitMain(runQueueConformance())
+		}
+	}
+
+	hostkit.ExitMain(mainImpl())
 }
 
 func mainImpl() (retErr error) {
@@ -34,13 +42,73 @@ func mainImpl() (retErr error) {
 		}
 	}()
 
-	go handleSignals(ctx, cancel)
-
 	cfg := config.New()
-	logger := newLogger(cfg)
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+
+	// Report the log entries collapsed by the optional deduplication.
+	go logger.Run(ctx)
+
+	// Loggers for the main components. Each component in logComponents can have its own log level.
+	bootstrapLogger := logger.WithComponent("bootstrap")
+	apiLogger := logger.WithComponent("api")
+
+	// SIGHUP forces an immediate settings reload. The signal is handled from the start, so that an early SIGHUP
+	// doesn't terminate the process. The reload itself happens once the settings refresher is running.
+	// SIGUSR1 and SIGUSR2 set and clear a debug log level override.
+	reloadCh := make(chan struct{}, 1)
+
+	go hostkit.HandleSignals(ctx, cancel, hostkit.SignalOptions{
+		Reload:              reloadCh,
+		LogLevels:           logger.Levels(),
+		LogLevelRevertAfter: cfg.LogLevelRevertAfter,
+	})
+
+	// Create the metrics server, which serves the metrics and admin endpoints. The listeners are bound here,
+	// so that startup fails if a port is unavailable. The server is started with the other components below.
+	metricsServer, err := newMetricsServer(ctx, cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics server: %w", err)
+	}
 
 	// Create the metrics instance. If metrics are disabled in the config, this will return a no-op metrics instance.
-	metrics := createMetrics(cfg, logger)
+	metrics, shutdownMetrics, err := createMetrics(ctx, cfg, metricsServer.metricsMux)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics: %w", err)
+	}
+
+	// Flush any pushed metrics (OTLP and StatsD) on exit.
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownMetrics(shutdownCtx); err != nil {
+			logger.Errorf("Failed to shut down metrics: %s", err)
+		}
+	}()
+
+	// Create the tracer provider. If tracing is disabled in the config, this will return a no-op tracer provider.
+	tracerProvider, shutdownTracing, err := newTracerProvider(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create tracer provider: %w", err)
+	}
+
+	// Flush any buffered spans on exit.
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			logger.Errorf("Failed to shut down tracing: %s", err)
+		}
+	}()
+
+	// The instrumentation wraps the queues and the database with tracing and metrics, and connects the ingress spans
+	// to the queue spans.
+	inst := newInstrumentation(tracerProvider, metrics)
 
 	// Create the redis client. This is used for both the cache store and the channel locker.
 	redisClient, err := newRedisClient(&cfg.Redis)
@@ -58,19 +126,23 @@ func mainImpl() (retErr error) {
 	channelLocker := managerpkg.NewRedisChannelLocker(redisClient)
 
 	// Create an alert queue. The type of queue created depends on the QueueMode setting in the config.
-	alertQueue, err := newAlertQueue(ctx, redisClient, channelLocker, cfg, logger)
+	alertQueue, closeAlertQueue, err := newAlertQueue(ctx, redisClient, channelLocker, inst, cfg, bootstrapLogger)
 	if err != nil {
 		return fmt.Errorf("failed to create alert queue: %w", err)
 	}
 
+	defer closeAlertQueue()
+
 	// Create a command queue. The type of queue created depends on the QueueMode setting in the config.
-	commandQueue, err := newCommandQueue(ctx, redisClient, channelLocker, cfg, logger)
+	commandQueue, closeCommandQueue, err := newCommandQueue(ctx, redisClient, channelLocker, inst, cfg, bootstrapLogger)
 	if err != nil {
 		return fmt.Errorf("failed to create command queue: %w", err)
 	}
 
+	defer closeCommandQueue()
+
 	// Create the database client. The type of database created depends on the DatabaseMode setting in the config.
-	db, err := newDatabase(ctx, cfg, logger)
+	db, err := newDatabase(ctx, inst, cfg, bootstrapLogger)
 	if err != nil {
 		return fmt.Errorf("failed to create database client: %w", err)
 	}
@@ -85,38 +157,71 @@ func mainImpl() (retErr error) {
 
 	// Read the manager settings from the yaml file specified in the config.
 	// Unlike the config, these settings can be changed at runtime and hot-reloaded.
-	managerSettings, managerSettingsHash, err := readManagerSettings(cfg.ManagerSettingsFilename)
+	managerSettings, logLevels, managerSettingsHash, err := readManagerSettings(cfg.ManagerSettingsFilename)
 	if err != nil {
 		return fmt.Errorf("failed to read manager settings: %w", err)
 	}
 
-	// Create the API configuration, using the defaults and overriding with values from the config.
-	apiCfg := cfg.GetAPICfg()
+	// Apply the default log levels from the manager settings file.
+	logger.Levels().SetDefaults(logLevels)
 
-	// Validate the API configuration.
-	if err := apiCfg.Validate(); err != nil {
-		return fmt.Errorf("invalid API configuration: %w", err)
+	// Load the location used to evaluate routing rule schedules. This is the same location as used by the manager.
+	location, err := time.LoadLocation(cfg.Location)
+	if err != nil {
+		return fmt.Errorf("failed to load location %s: %w", cfg.Location, err)
 	}
 
-	// Read the API settings from the yaml file specified in the config.
+	// Read the API settings (i.e. the routing rules) from the yaml file specified in the config.
 	// Unlike the config, these settings can be changed at runtime and hot-reloaded.
-	apiSettings, apiSettingsHash, err := readAPISettings(cfg.APISettingsFilename)
+	apiSettings, apiSettingsHash, err := readAPISettings(cfg.APISettingsFilename, location)
 	if err != nil {
 		return fmt.Errorf("failed to read API settings: %w", err)
 	}
 
+	// Create the API configuration, using the defaults and overriding with values from the config.
+	apiCfg := cfg.GetAPICfg()
+
+	// The core rate limit can't be changed at runtime, so it is raised to the highest rate limit override at startup.
+	// Reloaded settings with higher overrides are rejected.
+	coreLimit := coreRateLimit(cfg, apiSettings)
+	apiCfg.RateLimitPerAlertChannel.AlertsPerSecond = coreLimit.AlertsPerSecond
+	apiCfg.RateLimitPerAlertChannel.AllowedBurst = coreLimit.AllowedBurst
+
+	// Validate the API configuration.
+	if err := apiCfg.Validate(); err != nil {
+		return fmt.Errorf("invalid API configuration: %w", err)
+	}
+
 	// Create the manager instance. This is the main application component, which handles alert processing.
-	manager := managerpkg.New(db, alertQueue, commandQueue, logger, managerCfg).
+	manager := managerpkg.New(db, alertQueue, commandQueue, logger.WithComponent("manager"), managerCfg).
 		WithCacheStore(cacheStore).
 		WithLocker(channelLocker).
 		WithMetrics(metrics).
 		WithSettings(managerSettings)
 
 	// Create the API server instance. This provides the REST API, where clients send alerts.
-	apiServer := api.New(alertQueue, logger, apiCfg).
+	// The API server listens on the internal API port, behind the ingress. It only sees the subset of the routing rules
+	// that the core library supports, which it uses for alerts that bypass the ingress routing (e.g. Prometheus webhooks).
+	apiServer := api.New(alertQueue, apiLogger, apiCfg).
 		WithCacheStore(cacheStore).
 		WithMetrics(metrics).
-		WithSettings(apiSettings)
+		WithSettings(coreSettings(apiSettings))
+
+	// Create the rate limiter used by the ingress. The type of limiter created depends on the RateLimitMode setting in the config.
+	limiter, err := newRateLimiter(redisClient, cfg, apiLogger)
+	if err != nil {
+		return fmt.Errorf("failed to create rate limiter: %w", err)
+	}
+
+	// Create the ingress. This is the public entry point for alerts, which routes and rate limits them with the full
+	// routing rules before forwarding them to the API server.
+	ingress := newIngressServer(cfg, apiSettings, limiter, inst, metrics, apiLogger)
+
+	// Create the settings reloader, used by the settings refresher, the SIGHUP handler and the admin reload endpoint.
+	reloader := newSettingsReloader(cfg, location, manager, logger.Levels(), managerSettingsHash, apiServer, ingress, apiSettingsHash, coreLimit)
+
+	// Register the admin endpoints. These are only enabled if an admin token is configured.
+	registerAdminHandlers(metricsServer.adminMux, cfg, reloader, ingress, logger.Levels(), logger)
 
 	// Start the manager and API server in separate goroutines.
 	// Also start a goroutine to periodically check for changes in the settings files and hot-reload them.
@@ -130,105 +235,124 @@ func mainImpl() (retErr error) {
 		return apiServer.Run(ctx)
 	})
 
+	// Start the ingress in front of the API server.
+	errg.Go(func() error {
+		return ingress.Run(ctx)
+	})
+
 	// Start the manager.
 	errg.Go(func() error {
 		return manager.Run(ctx)
 	})
 
+	// Start the metrics and admin server.
+	errg.Go(func() error {
+		return metricsServer.Run(ctx)
+	})
+
 	// Start the settings refresher.
 	errg.Go(func() error {
-		return refreshSettings(ctx, cfg, manager, managerSettingsHash, apiServer, apiSettingsHash)
+		return refreshSettings(ctx, reloader, reloadCh)
 	})
 
 	return errg.Wait()
 }
 
-func createMetrics(cfg *config.Config, logger common.Logger) common.Metrics { //nolint:ireturn
-	if !cfg.EnableMetrics {
-		return &common.NoopMetrics{}
+// createMetrics creates the metrics instance. If metrics are disabled in the config, a no-op metrics instance is returned.
+// The metrics backends are selected with METRICS_BACKEND, a comma-separated list: Prometheus metrics are served
+// on /metrics on the given mux, OTLP metrics are pushed to the configured collector, and StatsD metrics are sent
+// to the StatsD agent.
+// The returned function flushes and stops the push backends (OTLP and StatsD), and must be called before exiting.
+func createMetrics(ctx context.Context, cfg *config.Config, mux *http.ServeMux) (common.Metrics, func(context.Context) error, error) {
+	var backends hostmetrics.MultiMetrics
+	var shutdowns []func(context.Context) error
+
+	constLabels := map[string]string{
+		"service":  cfg.MetricsService,
+		"role":     cfg.MetricsRole,
+		"instance": cfg.MetricsInstance,
 	}
 
-	metrics := NewPrometheusMetrics()
-
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", promhttp.Handler())
-		srv := &http.Server{
-			Addr:         ":" + cfg.MetricsPort,
-			Handler:      mux,
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-			IdleTimeout:  60 * time.Second,
-		}
-		if err := srv.ListenAndServe(); err != nil {
-			logger.Errorf("Metrics server error: %s", err)
-		}
-	}()
-
-	return metrics
-}
-
-// refreshSettings periodically checks for changes in the manager and API settings files.
-// If changes are detected, it hot-reloads the settings into the running manager and API server.
-func refreshSettings(ctx context.Context, cfg *config.Config, manager *managerpkg.Manager, managerSettingsHash string, apiServer *api.Server, apiSettingsHash string) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(10 * time.Second):
-			managerSettings, hash, err := readManagerSettings(cfg.ManagerSettingsFilename)
+	for _, name := range cfg.MetricsBackends() {
+		switch name {
+		case "prometheus":
+			prometheusMetrics := hostmetrics.NewPrometheusMetrics(hostmetrics.PrometheusMetricsOptions{
+				ConstLabels:          constLabels,
+				RuntimeCollectors:    cfg.MetricsGoCollectors,
+				MaxLabelCombinations: cfg.MetricsMaxSeries,
+			})
+
+			backends = append(backends, prometheusMetrics)
+			mux.Handle("/metrics", requireMetricsAuth(cfg, prometheusMetrics.Handler()))
+		case "otlp":
+			otlpMetrics, err := hostmetrics.NewOTLPMetrics(ctx, hostmetrics.OTLPMetricsOptions{
+				Protocol: cfg.MetricsOTLPProtocol,
+				Interval: cfg.MetricsOTLPInterval,
+				ResourceAttributes: map[string]string{
+					"service.name":        cfg.MetricsService,
+					"service.role":        cfg.MetricsRole,
+					"service.instance.id": cfg.MetricsInstance,
+				},
+				MaxLabelCombinations: cfg.MetricsMaxSeries,
+			})
 			if err != nil {
-				log.Error().Msgf("Failed to read manager settings: %s", err)
-			} else if hash != managerSettingsHash {
-				if err := manager.UpdateSettings(managerSettings); err != nil {
-					log.Error().Msgf("Failed to update manager settings: %s", err)
-				}
-
-				managerSettingsHash = hash
+				return nil, nil, err
 			}
 
-			apiSettings, hash, err := readAPISettings(cfg.APISettingsFilename)
+			backends = append(backends, otlpMetrics)
+			shutdowns = append(shutdowns, otlpMetrics.Shutdown)
+		case "statsd":
+			statsdMetrics, err := hostmetrics.NewStatsDMetrics(hostmetrics.StatsDMetricsOptions{
+				Addr:                 cfg.MetricsStatsDAddr,
+				FlushInterval:        cfg.MetricsStatsDInterval,
+				ConstTags:            constLabels,
+				MaxLabelCombinations: cfg.MetricsMaxSeries,
+			})
 			if err != nil {
-				log.Error().Msgf("Failed to read API settings: %s", err)
-			} else if hash != apiSettingsHash {
-				if err := apiServer.UpdateSettings(apiSettings); err != nil {
-					log.Error().Msgf("Failed to update API settings: %s", err)
-				}
-
-				apiSettingsHash = hash
+				return nil, nil, err
 			}
+
+			backends = append(backends, statsdMetrics)
+			shutdowns = append(shutdowns, statsdMetrics.Shutdown)
+		default:
+			return nil, nil, fmt.Errorf("unknown metrics backend: %s", name)
 		}
 	}
-}
 
-// handleSignals listens for OS signals and cancels the context when a termination signal is received.
-func handleSignals(ctx context.Context, cancel context.CancelFunc) {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
-	defer signal.Stop(signals)
+	shutdown := func(ctx context.Context) error {
+		var errs []error
 
-	select {
-	case <-ctx.Done():
-	case sig := <-signals:
-		log.Info().Msgf("Signal %s received", sig)
-		cancel()
-	}
-}
+		for _, s := range shutdowns {
+			errs = append(errs, s(ctx))
+		}
 
-// exitMain handles the application exit logic based on the provided error.
-func exitMain(err error) {
-	var returnCode int
+		return errors.Join(errs...)
+	}
 
-	switch {
-	case err == nil:
-		returnCode = 0
-	case errors.Is(err, context.Canceled):
-		returnCode = 0
-		log.Info().Msgf("Application canceled: %s", err)
+	switch len(backends) {
+	case 0:
+		return &common.NoopMetrics{}, shutdown, nil
+	case 1:
+		return backends[0], shutdown, nil
 	default:
-		returnCode = 1
-		log.Error().Msgf("Application failed: %s", err)
+		return backends, shutdown, nil
 	}
+}
 
-	os.Exit(returnCode)
+// refreshSettings periodically checks for changes in the manager and API settings files.
+// If changes are detected, it hot-reloads the settings into the running manager, API server and ingress.
+// A message on reloadCh (e.g. from a SIGHUP) forces an immediate reload, regardless of changes.
+func refreshSettings(ctx context.Context, reloader *settingsReloader, reloadCh <-chan struct{}) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-reloadCh:
+			if err := reloader.reload(true).Err(); err == nil {
+				log.Info().Msg("Settings reloaded")
+			}
+		case <-time.After(10 * time.Second):
+			reloader.reload(false)
+		}
+	}
 }
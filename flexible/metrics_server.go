@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/hostkit"
+	"golang.org/x/sync/errgroup"
+)
+
+// metricsServer serves the Prometheus metrics endpoint and the admin endpoints.
+//
+// By default, both are served on METRICS_PORT. If ADMIN_PORT is set to a different port, the admin endpoints get
+// their own listener, so that the metrics port can be exposed to the scraper without exposing the admin endpoints.
+// Both listeners use the same bind address and TLS settings.
+type metricsServer struct {
+	metricsMux *http.ServeMux
+	adminMux   *http.ServeMux
+	logger     *hostkit.Logger
+	listeners  []*metricsListener
+}
+
+type metricsListener struct {
+	name string
+	srv  *http.Server
+	ln   net.Listener
+}
+
+// newMetricsServer creates the metrics server and binds its listeners, so that startup fails if a port can't be bound.
+// A listener is only created if something is served on it: the metrics endpoint if the Prometheus backend is enabled,
+// and the admin endpoints if an admin token is configured. The handlers are added to the muxes by the caller.
+func newMetricsServer(ctx context.Context, cfg *config.Config, logger *hostkit.Logger) (*metricsServer, error) {
+	s := &metricsServer{
+		metricsMux: http.NewServeMux(),
+		logger:     logger,
+	}
+
+	s.adminMux = s.metricsMux
+
+	if cfg.AdminListenPort() != cfg.MetricsPort {
+		s.adminMux = http.NewServeMux()
+	}
+
+	tlsConfig, err := newMetricsTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	serveMetrics := slices.Contains(cfg.MetricsBackends(), "prometheus")
+	serveAdmin := cfg.AdminToken != ""
+
+	if s.adminMux == s.metricsMux {
+		if serveMetrics || serveAdmin {
+			if err := s.listen(ctx, "metrics", cfg.MetricsBindAddr, cfg.MetricsPort, s.metricsMux, tlsConfig); err != nil {
+				return nil, err
+			}
+		}
+
+		return s, nil
+	}
+
+	if serveMetrics {
+		if err := s.listen(ctx, "metrics", cfg.MetricsBindAddr, cfg.MetricsPort, s.metricsMux, tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	if serveAdmin {
+		if err := s.listen(ctx, "admin", cfg.MetricsBindAddr, cfg.AdminPort, s.adminMux, tlsConfig); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// newMetricsTLSConfig loads the TLS certificate for the metrics and admin listeners. It returns nil if TLS is not configured.
+func newMetricsTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.MetricsTLSCertFile == "" && cfg.MetricsTLSKeyFile == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	if cfg.MetricsTLSCertFile == "" || cfg.MetricsTLSKeyFile == "" {
+		return nil, errors.New("both METRICS_TLS_CERT_FILE and METRICS_TLS_KEY_FILE must be set to enable TLS")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.MetricsTLSCertFile, cfg.MetricsTLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metrics TLS certificate: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func (s *metricsServer) listen(ctx context.Context, name, bindAddr, port string, handler http.Handler, tlsConfig *tls.Config) error {
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(bindAddr, port),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s port %s: %w", name, port, err)
+	}
+
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	s.listeners = append(s.listeners, &metricsListener{name: name, srv: srv, ln: ln})
+
+	return nil
+}
+
+// close closes the listeners, for when the server is never run.
+func (s *metricsServer) close() {
+	for _, l := range s.listeners {
+		_ = l.ln.Close()
+	}
+}
+
+// Run serves the listeners, and blocks until the context is cancelled or a server error occurs.
+func (s *metricsServer) Run(ctx context.Context) error {
+	errg, ctx := errgroup.WithContext(ctx)
+
+	for _, l := range s.listeners {
+		errg.Go(func() error {
+			return s.serve(ctx, l)
+		})
+	}
+
+	return errg.Wait()
+}
+
+func (s *metricsServer) serve(ctx context.Context, l *metricsListener) error {
+	scheme := "http"
+	if l.srv.TLSConfig != nil {
+		scheme = "https"
+	}
+
+	s.logger.Infof("Serving %s endpoints on %s://%s", l.name, scheme, l.srv.Addr)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		if err := l.srv.Shutdown(shutdownCtx); err != nil { //nolint:contextcheck // ctx is already cancelled here
+			s.logger.Errorf("Failed to shut down %s server: %s", l.name, err)
+		}
+	}()
+
+	if err := l.srv.Serve(l.ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s server failed: %w", l.name, err)
+	}
+
+	return ctx.Err()
+}
+
+// requireMetricsAuth wraps the metrics handler, rejecting requests without valid credentials.
+// Bearer auth is used if METRICS_AUTH_TOKEN is set, basic auth if METRICS_AUTH_USERNAME is set, and no auth otherwise.
+func requireMetricsAuth(cfg *config.Config, next http.Handler) http.Handler {
+	switch {
+	case cfg.MetricsAuthToken != "":
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(cfg.MetricsAuthToken)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	case cfg.MetricsAuthUsername != "":
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+
+			// Both values are compared, so that the response time doesn't reveal which of them is wrong.
+			usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.MetricsAuthUsername)) == 1
+			passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(cfg.MetricsAuthPassword)) == 1
+
+			if !ok || !usernameOK || !passwordOK {
+				w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	default:
+		return next
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	redis "github.com/redis/go-redis/v9"
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/natsqueue"
+	"github.com/slackmgr/examples/hostkit/queueconformance"
+	"github.com/slackmgr/types"
+)
+
+const (
+	// queueConformanceCommand is the command line argument that runs the queue conformance checks instead of the host.
+	queueConformanceCommand = "queue-conformance"
+
+	// conformanceNATSURLEnv is the environment variable with the URL of the NATS server to check, if any. The checks
+	// create a stream per check, with a unique name per run, and delete the streams when they are done.
+	conformanceNATSURLEnv = "CONFORMANCE_NATS_URL"
+)
+
+// conformanceClaimMinIdleTime is the Redis queue claim time used by the conformance checks: the shortest that the
+// queue accepts, so that nacked messages are redelivered quickly.
+const conformanceClaimMinIdleTime = 10 * time.Second
+
+// conformanceNakBackoff is the NATS queue redelivery delay after a nack used by the conformance checks.
+const conformanceNakBackoff = time.Second
+
+// runQueueConformance runs the queue conformance checks, including the chaos checks, against the in-memory queue, so
+// that it runs fully offline. If REDIS_ADDR is set, the Redis queue is also checked against that server, with a unique
+// key prefix per run, and if CONFORMANCE_NATS_URL is set, the NATS queue is checked against that server. The Redis and
+// NATS queues are checked offline, against miniredis and an embedded NATS server, by the tests of the hostkit module.
+func runQueueConformance() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go hostkit.HandleSignals(ctx, cancel, hostkit.SignalOptions{})
+
+	cfg := config.New()
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+
+	queueLogger := logger.WithComponent("queue")
+
+	type backend struct {
+		name    string
+		factory queueconformance.Factory
+		opts    queueconformance.Options
+	}
+
+	// The in-memory queue drops nacked messages and ignores dedup IDs.
+	backends := []backend{
+		{
+			name: "in-memory",
+			factory: func(context.Context) (hostkit.FifoQueue, error) {
+				return &envelopeQueue{queue: types.NewInMemoryFifoQueue("conformance", 1000, 5*time.Second)}, nil
+			},
+		},
+	}
+
+	if cfg.Redis.Addr != "" {
+		redisClient, err := newRedisClient(&cfg.Redis)
+		if err != nil {
+			return fmt.Errorf("failed to create Redis client: %w", err)
+		}
+
+		defer func() { _ = redisClient.Close() }()
+
+		backends = append(backends, backend{
+			name:    "redis",
+			factory: redisConformanceFactory(redisClient, queueLogger),
+			opts:    redisConformanceOptions(),
+		})
+	}
+
+	if natsURL := os.Getenv(conformanceNATSURLEnv); natsURL != "" {
+		opts := []nats.Option{nats.Name("slack-manager-conformance")}
+
+		if cfg.Nats.CredentialsFile != "" {
+			opts = append(opts, nats.UserCredentials(cfg.Nats.CredentialsFile))
+		}
+
+		natsConn, err := nats.Connect(natsURL, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+
+		defer natsConn.Close()
+
+		js, err := jetstream.New(natsConn)
+		if err != nil {
+			return fmt.Errorf("failed to create JetStream context: %w", err)
+		}
+
+		factory, deleteStreams := natsConformanceFactory(js, queueLogger)
+		defer deleteStreams()
+
+		backends = append(backends, backend{
+			name:    "nats",
+			factory: factory,
+			opts: queueconformance.Options{
+				RedeliveryTimeout: conformanceNakBackoff + 5*time.Second,
+				Deduplication:     true,
+			},
+		})
+	}
+
+	failed := 0
+
+	for _, b := range backends {
+		backendLogger := logger.WithField("backend", b.name)
+
+		results := queueconformance.Run(ctx, b.factory, b.opts)
+
+		for _, result := range results {
+			resultLogger := backendLogger.WithField("check", result.Check).WithField("duration", result.Duration)
+
+			switch {
+			case result.Err != nil:
+				resultLogger.Errorf("Check failed: %s", result.Err)
+			case result.Skipped:
+				resultLogger.Info("Check skipped")
+			default:
+				resultLogger.Info("Check passed")
+			}
+		}
+
+		backendLogger.Infof("%d of %d checks passed or skipped", len(results)-queueconformance.Failed(results), len(results))
+
+		failed += queueconformance.Failed(results)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d queue conformance checks failed", failed)
+	}
+
+	return nil
+}
+
+// redisConformanceFactory returns a factory for Redis queues, with headers like the host uses them, with a unique key prefix per queue, so that each check
+// starts with an empty queue without flushing the server. The timings are the shortest that the queue accepts.
+func redisConformanceFactory(client *redis.Client, logger *hostkit.Logger) queueconformance.Factory {
+	runID := uuid.NewString()
+	count := 0
+
+	return func(context.Context) (hostkit.FifoQueue, error) {
+		count++
+
+		keyPrefix := fmt.Sprintf("slack-manager-conformance:%s:%d", runID, count)
+
+		queue, err := newRedisQueue(client, manager.NewRedisChannelLocker(client), "conformance", logger,
+			manager.WithKeyPrefix(keyPrefix),
+			manager.WithPollInterval(time.Second),
+			manager.WithStreamRefreshInterval(5*time.Second),
+			manager.WithClaimMinIdleTime(conformanceClaimMinIdleTime),
+			manager.WithLockTTL(30*time.Second),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Redis queue: %w", err)
+		}
+
+		return queue, nil
+	}
+}
+
+// redisConformanceOptions describes the Redis queue: nacked messages are reclaimed once they have been idle for the
+// claim time, and picked up on the next poll. Dedup IDs are ignored.
+func redisConformanceOptions() queueconformance.Options {
+	return queueconformance.Options{
+		RedeliveryTimeout: conformanceClaimMinIdleTime + 5*time.Second,
+	}
+}
+
+// natsConformanceFactory returns a factory for NATS queues on a new stream per queue, with a unique name per run, so
+// that each check starts with an empty queue. Nacked messages are redelivered after conformanceNakBackoff. The returned
+// function deletes the streams.
+func natsConformanceFactory(js jetstream.JetStream, logger *hostkit.Logger) (queueconformance.Factory, func()) {
+	runID := strings.ToUpper(strings.ReplaceAll(uuid.NewString(), "-", ""))[:12]
+
+	var streams []string
+
+	factory := func(ctx context.Context) (hostkit.FifoQueue, error) {
+		stream := fmt.Sprintf("SLACK_MANAGER_CONFORMANCE_%s_%d", runID, len(streams)+1)
+		streams = append(streams, stream)
+
+		queue, err := natsqueue.New(js, stream, logger,
+			natsqueue.WithNakBackoff(conformanceNakBackoff),
+			natsqueue.WithRefreshInterval(time.Second),
+		).Init(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize NATS queue: %w", err)
+		}
+
+		return queue, nil
+	}
+
+	deleteStreams := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, stream := range streams {
+			if err := js.DeleteStream(ctx, stream); err != nil {
+				logger.WithField("stream", stream).Errorf("Failed to delete conformance stream: %s", err)
+			}
+		}
+	}
+
+	return factory, deleteStreams
+}
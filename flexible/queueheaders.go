@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/hostkit"
+	sqs "github.com/slackmgr/plugins/sqs"
+	"github.com/slackmgr/types"
+)
+
+// The SQS and in-memory queues come from other modules, and only implement manager.FifoQueue. The wrappers in this
+// file add the hostkit.HeaderFifoQueue methods to them, so that the instrumentation can send the trace context of
+// each message in its headers. SQS sends the headers as message attributes, through a wrapper of the SQS API client of
+// the plugin, and the in-memory queue sends each body in a JSON envelope with its headers. The Redis queue gets its
+// headers from the redisheaders package of the hostkit module.
+
+// sendHeadersKey is the context key of the headers of the message that is being sent.
+type sendHeadersKey struct{}
+
+// withSendHeaders returns a context that carries the headers of a message to the client wrapper of the queue.
+func withSendHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, sendHeadersKey{}, headers)
+}
+
+// sendHeaders returns the headers added to the context with withSendHeaders, or nil if there are none.
+func sendHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(sendHeadersKey{}).(map[string]string)
+	return headers
+}
+
+// headerStore keeps the headers of the messages read by the SQS API client wrapper, until the queue wrapper forwards
+// the messages. The headers of messages that are never forwarded, e.g. because the receiver stopped, are kept until the
+// message is read again.
+type headerStore struct {
+	mu      sync.Mutex
+	headers map[string]map[string]string
+}
+
+func (s *headerStore) put(key string, headers map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.headers == nil {
+		s.headers = map[string]map[string]string{}
+	}
+
+	s.headers[key] = headers
+}
+
+func (s *headerStore) take(key string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	headers := s.headers[key]
+	delete(s.headers, key)
+
+	return headers
+}
+
+// sqsAPI is the part of the SQS API that the SQS queue plugin uses. The plugin accepts any implementation with
+// sqs.WithSQSClient.
+type sqsAPI interface {
+	GetQueueUrl(ctx context.Context, params *awssqs.GetQueueUrlInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueUrlOutput, error)
+	SendMessage(ctx context.Context, params *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *awssqs.ChangeMessageVisibilityInput, optFns ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error)
+}
+
+// sqsHeaderAPI is an SQS API client that sends the headers in the context as message attributes, and keeps the
+// string attributes of the received messages by message ID.
+type sqsHeaderAPI struct {
+	sqsAPI
+
+	received headerStore
+}
+
+func (a *sqsHeaderAPI) SendMessage(ctx context.Context, params *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error) {
+	if headers := sendHeaders(ctx); len(headers) > 0 {
+		input := *params
+		input.MessageAttributes = make(map[string]sqstypes.MessageAttributeValue, len(headers))
+
+		for key, value := range headers {
+			// SQS rejects attributes with empty values.
+			if value != "" {
+				input.MessageAttributes[key] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+			}
+		}
+
+		params = &input
+	}
+
+	return a.sqsAPI.SendMessage(ctx, params, optFns...)
+}
+
+func (a *sqsHeaderAPI) ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+	input := *params
+	input.MessageAttributeNames = []string{"All"}
+
+	output, err := a.sqsAPI.ReceiveMessage(ctx, &input, optFns...)
+	if err != nil {
+		return output, err
+	}
+
+	for _, m := range output.Messages {
+		headers := map[string]string{}
+
+		for key, value := range m.MessageAttributes {
+			if aws.ToString(value.DataType) == "String" {
+				headers[key] = aws.ToString(value.StringValue)
+			}
+		}
+
+		if len(headers) > 0 {
+			a.received.put(aws.ToString(m.MessageId), headers)
+		}
+	}
+
+	return output, nil
+}
+
+// sqsHeaderQueue is the SQS queue of the plugin, with the headers sent as SQS message attributes.
+type sqsHeaderQueue struct {
+	*sqs.Client
+
+	api *sqsHeaderAPI
+}
+
+// newSQSHeaderQueue creates the SQS queue, with the given SQS API client wrapped by a sqsHeaderAPI.
+func newSQSHeaderQueue(ctx context.Context, awsCfg *aws.Config, queueName string, api sqsAPI, logger types.Logger, opts ...sqs.Option) (*sqsHeaderQueue, error) {
+	headerAPI := &sqsHeaderAPI{sqsAPI: api}
+
+	client, err := sqs.New(awsCfg, queueName, logger, append(slices.Clone(opts), sqs.WithSQSClient(headerAPI))...).Init(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqsHeaderQueue{Client: client, api: headerAPI}, nil
+}
+
+func (q *sqsHeaderQueue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	return q.Client.Send(withSendHeaders(ctx, headers), slackChannelID, dedupID, body)
+}
+
+func (q *sqsHeaderQueue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+func (q *sqsHeaderQueue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	return hostkit.ReceiveMessages(ctx, q.Client, sinkCh, func(item *types.FifoQueueItem) *hostkit.FifoQueueMessage {
+		return &hostkit.FifoQueueMessage{Item: item, Headers: q.api.received.take(item.MessageID)}
+	})
+}
+
+// messageEnvelope is the body of a message sent by envelopeQueue.
+type messageEnvelope struct {
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body"`
+}
+
+// envelopeQueue adds headers to a queue that can only carry a body, by sending each body in a JSON envelope with its
+// headers. Every message must be sent through the envelopeQueue. It is used for the in-memory queue.
+type envelopeQueue struct {
+	queue manager.FifoQueue
+}
+
+func (q *envelopeQueue) Name() string {
+	return q.queue.Name()
+}
+
+func (q *envelopeQueue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.SendWithHeaders(ctx, slackChannelID, dedupID, body, nil)
+}
+
+func (q *envelopeQueue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	envelope, err := json.Marshal(&messageEnvelope{Headers: headers, Body: body})
+	if err != nil {
+		return fmt.Errorf("failed to encode message envelope: %w", err)
+	}
+
+	return q.queue.Send(ctx, slackChannelID, dedupID, string(envelope))
+}
+
+func (q *envelopeQueue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+// ReceiveWithHeaders receives the messages with the body and headers from their envelope. A body that isn't an
+// envelope is passed on unchanged, without headers.
+func (q *envelopeQueue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	return hostkit.ReceiveMessages(ctx, q.queue, sinkCh, func(item *types.FifoQueueItem) *hostkit.FifoQueueMessage {
+		var envelope messageEnvelope
+
+		decoder := json.NewDecoder(strings.NewReader(item.Body))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&envelope); err != nil {
+			return &hostkit.FifoQueueMessage{Item: item}
+		}
+
+		item.Body = envelope.Body
+
+		return &hostkit.FifoQueueMessage{Item: item, Headers: envelope.Headers}
+	})
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/slackmgr/examples/hostkit"
+	sqs "github.com/slackmgr/plugins/sqs"
+	"github.com/slackmgr/types"
+)
+
+// fakeSQS is an in-memory SQS API, which delivers each message once. Like SQS, it only returns the message
+// attributes if the receive request asks for them.
+type fakeSQS struct {
+	mu       sync.Mutex
+	messages []sqstypes.Message
+	sent     int
+}
+
+func (f *fakeSQS) GetQueueUrl(_ context.Context, params *awssqs.GetQueueUrlInput, _ ...func(*awssqs.Options)) (*awssqs.GetQueueUrlOutput, error) {
+	return &awssqs.GetQueueUrlOutput{QueueUrl: aws.String("https://sqs.local/" + aws.ToString(params.QueueName))}, nil
+}
+
+func (f *fakeSQS) SendMessage(_ context.Context, params *awssqs.SendMessageInput, _ ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent++
+	id := fmt.Sprint(f.sent)
+
+	f.messages = append(f.messages, sqstypes.Message{
+		MessageId:         aws.String(id),
+		ReceiptHandle:     aws.String(id),
+		Body:              params.MessageBody,
+		Attributes:        map[string]string{string(sqstypes.MessageSystemAttributeNameMessageGroupId): aws.ToString(params.MessageGroupId)},
+		MessageAttributes: params.MessageAttributes,
+	})
+
+	return &awssqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, _ ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	messages := f.messages
+	f.messages = nil
+	f.mu.Unlock()
+
+	if len(messages) == 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return &awssqs.ReceiveMessageOutput{}, nil
+		}
+	}
+
+	if len(params.MessageAttributeNames) == 0 {
+		for i := range messages {
+			messages[i].MessageAttributes = nil
+		}
+	}
+
+	return &awssqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (f *fakeSQS) DeleteMessage(context.Context, *awssqs.DeleteMessageInput, ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error) {
+	return &awssqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeSQS) ChangeMessageVisibility(context.Context, *awssqs.ChangeMessageVisibilityInput, ...func(*awssqs.Options)) (*awssqs.ChangeMessageVisibilityOutput, error) {
+	return &awssqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+// receiveMessages receives count messages with ReceiveWithHeaders, acks them, and stops the receiver.
+func receiveMessages(t *testing.T, queue hostkit.FifoQueue, count int) []*hostkit.FifoQueueMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+
+	sinkCh := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- hostkit.ReceiveWithHeaders(ctx, queue, sinkCh) }()
+
+	messages := make([]*hostkit.FifoQueueMessage, 0, count)
+
+	for range count {
+		msg, ok := <-sinkCh
+		if !ok {
+			t.Fatalf("the sink channel was closed after %d messages: %v", len(messages), <-errCh)
+		}
+
+		msg.Item.Ack()
+		messages = append(messages, msg)
+	}
+
+	cancel()
+
+	for range sinkCh {
+		t.Error("got an unexpected message")
+	}
+
+	<-errCh
+
+	return messages
+}
+
+func TestHeaderQueues(t *testing.T) {
+	tests := []struct {
+		name     string
+		newQueue func(t *testing.T) hostkit.HeaderFifoQueue
+	}{
+		{
+			name: "sqs",
+			newQueue: func(t *testing.T) hostkit.HeaderFifoQueue {
+				queue, err := newSQSHeaderQueue(context.Background(), &aws.Config{}, "alerts.fifo", &fakeSQS{}, &types.NoopLogger{},
+					sqs.WithDisableMessageExtension())
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return queue
+			},
+		},
+		{
+			name: "in-memory",
+			newQueue: func(*testing.T) hostkit.HeaderFifoQueue {
+				return &envelopeQueue{queue: types.NewInMemoryFifoQueue("alerts", 10, time.Second)}
+			},
+		},
+	}
+
+	headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := tt.newQueue(t)
+
+			if err := queue.SendWithHeaders(context.Background(), "C1", "d1", `{"header": "first"}`, headers); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := queue.Send(context.Background(), "C1", "d2", `{"header": "second"}`); err != nil {
+				t.Fatal(err)
+			}
+
+			messages := receiveMessages(t, queue, 2)
+
+			if got := messages[0].Item.Body; got != `{"header": "first"}` {
+				t.Errorf("got body %q for the message with headers, want the sent body", got)
+			}
+
+			if !maps.Equal(messages[0].Headers, headers) {
+				t.Errorf("got headers %v, want %v", messages[0].Headers, headers)
+			}
+
+			if got := messages[1].Item.Body; got != `{"header": "second"}` {
+				t.Errorf("got body %q for the message without headers, want the sent body", got)
+			}
+
+			if len(messages[1].Headers) != 0 {
+				t.Errorf("got headers %v for the message without headers, want none", messages[1].Headers)
+			}
+
+			// The manager receives with Receive, which gets the sent body without the headers.
+			if err := queue.SendWithHeaders(context.Background(), "C1", "d3", `{"header": "third"}`, headers); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+			defer cancel()
+
+			sinkCh := make(chan *types.FifoQueueItem)
+
+			go func() { _ = queue.Receive(ctx, sinkCh) }()
+
+			item := <-sinkCh
+			if item == nil || item.Body != `{"header": "third"}` {
+				t.Fatalf("got item %+v from Receive, want the sent body", item)
+			}
+
+			item.Ack()
+			cancel()
+
+			for range sinkCh {
+				t.Error("got an unexpected item from Receive")
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/slackmgr/examples/flexible/routing"
+	"github.com/slackmgr/examples/hostkit/ratelimit"
+)
+
+// ingressAlertsRateLimitedMetric counts alerts rejected by the ingress rate limiter.
+// The rule label is empty for channel limits, and set to the rule name for routing rule limits.
+const ingressAlertsRateLimitedMetric = "slackmgr_ingress_alerts_rate_limited_total"
+
+// rateLimitBucket is a single token bucket to check for a request, with the number of alerts to take from it.
+type rateLimitBucket struct {
+	key     string
+	channel string
+	rule    string
+	limit   routing.RateLimit
+	count   int
+}
+
+// limiterBuckets converts the buckets to the rate limiter buckets, in the same order.
+func limiterBuckets(buckets []*rateLimitBucket) []ratelimit.Bucket {
+	result := make([]ratelimit.Bucket, len(buckets))
+
+	for i, b := range buckets {
+		result[i] = ratelimit.Bucket{Key: b.key, Rate: b.limit.AlertsPerSecond, Burst: b.limit.AllowedBurst, Count: b.count}
+	}
+
+	return result
+}
@@ -0,0 +1,196 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Matcher matches a single string value against lists of exact values, prefixes, suffixes,
+// glob patterns and regular expressions. The value matches if any of the configured items match.
+//
+// All matching is case-insensitive. Glob patterns support '*' (any sequence of characters, including '/'),
+// '?' (any single character) and character classes such as '[abc]' and '[!abc]'.
+type Matcher struct {
+	Equals    []string `json:"equals,omitempty" yaml:"equals"`
+	HasPrefix []string `json:"hasPrefix,omitempty" yaml:"hasPrefix"`
+	HasSuffix []string `json:"hasSuffix,omitempty" yaml:"hasSuffix"`
+	Glob      []string `json:"glob,omitempty" yaml:"glob"`
+	Regex     []string `json:"regex,omitempty" yaml:"regex"`
+
+	globs   []*regexp.Regexp
+	regexes []*regexp.Regexp
+}
+
+// init normalizes the matcher values and compiles the glob and regex patterns.
+// The path is used as a prefix in error messages, e.g. "rule[2]" or "rule[2].fields.host".
+func (m *Matcher) init(path string) error {
+	if err := normalizeValues(m.Equals, path+".equals"); err != nil {
+		return err
+	}
+
+	if err := normalizeValues(m.HasPrefix, path+".hasPrefix"); err != nil {
+		return err
+	}
+
+	if err := normalizeValues(m.HasSuffix, path+".hasSuffix"); err != nil {
+		return err
+	}
+
+	m.globs = make([]*regexp.Regexp, 0, len(m.Glob))
+
+	for i, s := range m.Glob {
+		s = strings.TrimSpace(s)
+
+		if s == "" {
+			return fmt.Errorf("%s.glob[%d] cannot be empty", path, i)
+		}
+
+		regex, err := regexp.Compile(globToRegex(s))
+		if err != nil {
+			return fmt.Errorf("failed to compile %s.glob[%d] %q: %w", path, i, s, err)
+		}
+
+		m.Glob[i] = s
+		m.globs = append(m.globs, regex)
+	}
+
+	m.regexes = make([]*regexp.Regexp, 0, len(m.Regex))
+
+	for i, s := range m.Regex {
+		s = strings.TrimSpace(s)
+
+		if s == "" {
+			return fmt.Errorf("%s.regex[%d] cannot be empty", path, i)
+		}
+
+		// Ensure that the regex is case insensitive
+		if !strings.HasPrefix(s, "(?i)") {
+			s = "(?i)" + s
+		}
+
+		regex, err := regexp.Compile(s)
+		if err != nil {
+			return fmt.Errorf("failed to compile %s.regex[%d]: %w", path, i, err)
+		}
+
+		m.Regex[i] = s
+		m.regexes = append(m.regexes, regex)
+	}
+
+	return nil
+}
+
+// isEmpty returns true if the matcher has nothing to match on.
+func (m *Matcher) isEmpty() bool {
+	return len(m.Equals) == 0 && len(m.HasPrefix) == 0 && len(m.HasSuffix) == 0 && len(m.Glob) == 0 && len(m.Regex) == 0
+}
+
+// Match returns true if the value matches any of the configured items, regardless of match type.
+func (m *Matcher) Match(value string) bool {
+	value = strings.ToLower(value)
+
+	return m.matchEquals(value) || m.matchPrefix(value) || m.matchSuffix(value) || m.matchGlob(value) || m.matchRegex(value)
+}
+
+func (m *Matcher) matchEquals(value string) bool {
+	return slices.Contains(m.Equals, value)
+}
+
+func (m *Matcher) matchPrefix(value string) bool {
+	for _, s := range m.HasPrefix {
+		if strings.HasPrefix(value, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Matcher) matchSuffix(value string) bool {
+	for _, s := range m.HasSuffix {
+		if strings.HasSuffix(value, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Matcher) matchGlob(value string) bool {
+	for _, regex := range m.globs {
+		if regex.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Matcher) matchRegex(value string) bool {
+	for _, regex := range m.regexes {
+		if regex.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeValues trims and lowercases all values in place, and returns an error if any value is empty.
+func normalizeValues(values []string, path string) error {
+	for i, s := range values {
+		s = strings.ToLower(strings.TrimSpace(s))
+
+		if s == "" {
+			return fmt.Errorf("%s[%d] cannot be empty", path, i)
+		}
+
+		values[i] = s
+	}
+
+	return nil
+}
+
+// globToRegex translates a glob pattern to an anchored, case-insensitive regular expression.
+// Unterminated character classes are treated as literal '[' characters.
+func globToRegex(glob string) string {
+	var b strings.Builder
+
+	b.WriteString("(?i)^")
+
+	for i := 0; i < len(glob); {
+		r, size := utf8.DecodeRuneInString(glob[i:])
+
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				break
+			}
+
+			class := glob[i+1 : i+1+end]
+			if negated, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + negated
+			}
+
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			size += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+
+		i += size
+	}
+
+	b.WriteString("$")
+
+	return b.String()
+}
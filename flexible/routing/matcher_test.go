@@ -0,0 +1,39 @@
+package routing
+
+import "testing"
+
+func TestMatcherGlob(t *testing.T) {
+	tests := []struct {
+		name  string
+		glob  string
+		value string
+		want  bool
+	}{
+		{name: "star", glob: "db-*-eu", value: "db-orders-eu", want: true},
+		{name: "star matches slashes", glob: "svc/*", value: "svc/a/b", want: true},
+		{name: "question mark", glob: "db-?", value: "db-1", want: true},
+		{name: "question mark needs one character", glob: "db-?", value: "db-", want: false},
+		{name: "character class", glob: "db-[ab]", value: "db-b", want: true},
+		{name: "negated character class", glob: "db-[!ab]", value: "db-a", want: false},
+		{name: "unterminated character class", glob: "db-[a", value: "db-[a", want: true},
+		{name: "case-insensitive", glob: "DB-*", value: "db-orders", want: true},
+		{name: "regex characters are literal", glob: "a.b+c", value: "axb+c", want: false},
+		{name: "non-ASCII literal", glob: "café*", value: "café-prod", want: true},
+		{name: "non-ASCII question mark", glob: "caf?-prod", value: "café-prod", want: true},
+		{name: "non-ASCII mismatch", glob: "café*", value: "cafe-prod", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Matcher{Glob: []string{tt.glob}}
+
+			if err := m.init("test"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := m.Match(tt.value); got != tt.want {
+				t.Errorf("glob %q on %q: got %t, want %t", tt.glob, tt.value, got, tt.want)
+			}
+		})
+	}
+}
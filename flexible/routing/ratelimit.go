@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	managerconfig "github.com/slackmgr/core/config"
+)
+
+// RateLimit configures a token bucket rate limiter. The fields have the same meaning and
+// valid ranges as in the core RateLimitConfig.
+type RateLimit struct {
+	AlertsPerSecond float64 `json:"alertsPerSecond" yaml:"alertsPerSecond"`
+	AllowedBurst    int     `json:"allowedBurst" yaml:"allowedBurst"`
+}
+
+// RateLimits contains rate limit overrides, which replace the default per-channel rate limit.
+//
+// Channels maps Slack channel IDs to the rate limit for that channel. Rules maps routing rule names
+// to a rate limit, which applies to alerts routed by that rule, per target channel. Alerts routed
+// by a rule with an override must pass both the rule limit and the channel limit.
+type RateLimits struct {
+	Channels map[string]*RateLimit `json:"channels,omitempty" yaml:"channels"`
+	Rules    map[string]*RateLimit `json:"rules,omitempty" yaml:"rules"`
+}
+
+// init validates the rate limit overrides. Rule overrides must refer to existing rules.
+func (l *RateLimits) init(ruleNames map[string]struct{}) error {
+	channels := make(map[string]*RateLimit, len(l.Channels))
+
+	for channel, limit := range l.Channels {
+		channel = strings.ToUpper(strings.TrimSpace(channel))
+
+		if !slackChannelIDRegex.MatchString(channel) {
+			return fmt.Errorf("rateLimits.channels.%s is not a valid Slack channel ID", channel)
+		}
+
+		if err := limit.validate("rateLimits.channels." + channel); err != nil {
+			return err
+		}
+
+		channels[channel] = limit
+	}
+
+	l.Channels = channels
+
+	rules := make(map[string]*RateLimit, len(l.Rules))
+
+	for name, limit := range l.Rules {
+		name = strings.TrimSpace(name)
+
+		if _, ok := ruleNames[name]; !ok {
+			return fmt.Errorf("rateLimits.rules.%s does not refer to an existing routing rule", name)
+		}
+
+		if err := limit.validate("rateLimits.rules." + name); err != nil {
+			return err
+		}
+
+		rules[name] = limit
+	}
+
+	l.Rules = rules
+
+	return nil
+}
+
+func (l *RateLimit) validate(path string) error {
+	if l == nil {
+		return fmt.Errorf("%s cannot be empty", path)
+	}
+
+	if l.AlertsPerSecond < managerconfig.MinAlertsPerSecond || l.AlertsPerSecond > managerconfig.MaxAlertsPerSecond {
+		return fmt.Errorf("%s.alertsPerSecond must be between %v and %v", path, managerconfig.MinAlertsPerSecond, managerconfig.MaxAlertsPerSecond)
+	}
+
+	if l.AllowedBurst < managerconfig.MinAllowedBurst || l.AllowedBurst > managerconfig.MaxAllowedBurst {
+		return fmt.Errorf("%s.allowedBurst must be between %d and %d", path, managerconfig.MinAllowedBurst, managerconfig.MaxAllowedBurst)
+	}
+
+	return nil
+}
+
+// ChannelRateLimit returns the rate limit override for the channel, or nil if there is none.
+func (s *Settings) ChannelRateLimit(channel string) *RateLimit {
+	if s.RateLimits == nil {
+		return nil
+	}
+
+	return s.RateLimits.Channels[strings.ToUpper(channel)]
+}
+
+// RuleRateLimit returns the rate limit override for the routing rule, or nil if there is none.
+func (s *Settings) RuleRateLimit(rule string) *RateLimit {
+	if s.RateLimits == nil {
+		return nil
+	}
+
+	return s.RateLimits.Rules[rule]
+}
+
+// MaxRateLimit returns the highest alerts per second and the highest burst of the default limit and all the overrides.
+func (s *Settings) MaxRateLimit(defaultLimit RateLimit) RateLimit {
+	limit := defaultLimit
+
+	if s.RateLimits == nil {
+		return limit
+	}
+
+	for _, overrides := range []map[string]*RateLimit{s.RateLimits.Channels, s.RateLimits.Rules} {
+		for _, override := range overrides {
+			limit.AlertsPerSecond = max(limit.AlertsPerSecond, override.AlertsPerSecond)
+			limit.AllowedBurst = max(limit.AllowedBurst, override.AllowedBurst)
+		}
+	}
+
+	return limit
+}
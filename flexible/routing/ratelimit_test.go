@@ -0,0 +1,40 @@
+package routing
+
+import "testing"
+
+func TestMaxRateLimit(t *testing.T) {
+	defaultLimit := RateLimit{AlertsPerSecond: 1, AllowedBurst: 5}
+
+	tests := []struct {
+		name       string
+		rateLimits *RateLimits
+		want       RateLimit
+	}{
+		{name: "no overrides", want: defaultLimit},
+		{
+			name: "lower overrides",
+			rateLimits: &RateLimits{
+				Channels: map[string]*RateLimit{"C1": {AlertsPerSecond: 0.1, AllowedBurst: 1}},
+			},
+			want: defaultLimit,
+		},
+		{
+			name: "the highest rate and burst are taken separately",
+			rateLimits: &RateLimits{
+				Channels: map[string]*RateLimit{"C1": {AlertsPerSecond: 20, AllowedBurst: 2}},
+				Rules:    map[string]*RateLimit{"rule": {AlertsPerSecond: 0.5, AllowedBurst: 200}},
+			},
+			want: RateLimit{AlertsPerSecond: 20, AllowedBurst: 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &Settings{RateLimits: tt.rateLimits}
+
+			if got := settings.MaxRateLimit(defaultLimit); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// holidayDateFormat is the date format used for holidays, e.g. "2026-12-24".
+const holidayDateFormat = time.DateOnly
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule restricts a routing rule to certain times, in the location configured for the application.
+//
+// The rule is active if the current time is within at least one of the windows, and the window started
+// on a date that is not a holiday. For a window that wraps past midnight, the early morning part belongs
+// to the window that started the previous evening, so it is active if the previous date is not a holiday.
+//
+// Typically, a rule with a business hours schedule is placed before an otherwise identical rule without
+// a schedule, which then handles alerts outside business hours and on holidays.
+type Schedule struct {
+	Windows  []*ScheduleWindow `json:"windows" yaml:"windows"`
+	Holidays []string          `json:"holidays,omitempty" yaml:"holidays"`
+
+	holidays map[string]struct{}
+}
+
+// ScheduleWindow is a weekday and time range, e.g. mon-fri 08:00-16:00.
+//
+// Days are three-letter weekday names (mon, tue, ...). An empty list means every day.
+// From and To are times of day in HH:MM format, with To being exclusive. An empty From means 00:00,
+// and an empty To means 24:00. If To is before From, the window wraps past midnight into the next day.
+type ScheduleWindow struct {
+	Days []string `json:"days,omitempty" yaml:"days"`
+	From string   `json:"from,omitempty" yaml:"from"`
+	To   string   `json:"to,omitempty" yaml:"to"`
+
+	days []time.Weekday
+	from time.Duration
+	to   time.Duration
+}
+
+// init validates the schedule, and parses the weekdays, times of day and holidays.
+func (s *Schedule) init(path string) error {
+	if len(s.Windows) == 0 {
+		return fmt.Errorf("%s.windows cannot be empty", path)
+	}
+
+	for i, w := range s.Windows {
+		if w == nil {
+			return fmt.Errorf("%s.windows[%d] cannot be empty", path, i)
+		}
+
+		if err := w.init(fmt.Sprintf("%s.windows[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+
+	s.holidays = make(map[string]struct{}, len(s.Holidays))
+
+	for i, h := range s.Holidays {
+		h = strings.TrimSpace(h)
+
+		if _, err := time.Parse(holidayDateFormat, h); err != nil {
+			return fmt.Errorf("%s.holidays[%d] must be a date in YYYY-MM-DD format", path, i)
+		}
+
+		s.Holidays[i] = h
+		s.holidays[h] = struct{}{}
+	}
+
+	return nil
+}
+
+// activeAt returns true if the schedule is active at the given time, which must be in the application location.
+func (s *Schedule) activeAt(t time.Time) bool {
+	for _, w := range s.Windows {
+		start, ok := w.startAt(t)
+		if !ok {
+			continue
+		}
+
+		if _, holiday := s.holidays[start.Format(holidayDateFormat)]; !holiday {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *ScheduleWindow) init(path string) error {
+	w.days = make([]time.Weekday, 0, len(w.Days))
+
+	for j, d := range w.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+
+		day, ok := weekdays[d]
+		if !ok {
+			return fmt.Errorf("%s.days[%d] must be one of mon, tue, wed, thu, fri, sat, sun", path, j)
+		}
+
+		w.Days[j] = d
+		w.days = append(w.days, day)
+	}
+
+	var err error
+
+	if w.from, err = parseTimeOfDay(w.From, 0); err != nil {
+		return fmt.Errorf("%s.from: %w", path, err)
+	}
+
+	if w.to, err = parseTimeOfDay(w.To, 24*time.Hour); err != nil {
+		return fmt.Errorf("%s.to: %w", path, err)
+	}
+
+	if w.from == w.to {
+		return fmt.Errorf("%s.from and %s.to cannot be equal", path, path)
+	}
+
+	return nil
+}
+
+// startAt returns the day on which the window containing the given time started, and true, if the window is active
+// at that time. Otherwise it returns false.
+func (w *ScheduleWindow) startAt(t time.Time) (time.Time, bool) {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if w.from < w.to {
+		return t, w.includesDay(t.Weekday()) && sinceMidnight >= w.from && sinceMidnight < w.to
+	}
+
+	if sinceMidnight >= w.from {
+		return t, w.includesDay(t.Weekday())
+	}
+
+	// The window wraps past midnight, so the early morning part belongs to the window starting the previous day.
+	previous := t.AddDate(0, 0, -1)
+
+	return previous, sinceMidnight < w.to && w.includesDay(previous.Weekday())
+}
+
+func (w *ScheduleWindow) includesDay(day time.Weekday) bool {
+	return len(w.days) == 0 || slices.Contains(w.days, day)
+}
+
+// parseTimeOfDay parses a time of day in HH:MM format, and returns the duration since midnight.
+// 24:00 is allowed, to express the end of the day.
+func parseTimeOfDay(s string, defaultValue time.Duration) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid time of day in HH:MM format", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
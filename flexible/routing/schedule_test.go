@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActiveAt(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(value string) time.Time {
+		t.Helper()
+
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	businessHours := &ScheduleWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "08:00", To: "16:00"}
+	nights := &ScheduleWindow{Days: []string{"thu", "fri"}, From: "22:00", To: "06:00"}
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		at       string
+		want     bool
+	}{
+		// 2026-12-24 is a Thursday.
+		{name: "inside business hours", schedule: &Schedule{Windows: []*ScheduleWindow{businessHours}}, at: "2026-12-23 08:00", want: true},
+		{name: "end of business hours is exclusive", schedule: &Schedule{Windows: []*ScheduleWindow{businessHours}}, at: "2026-12-23 16:00", want: false},
+		{name: "business hours on a weekend", schedule: &Schedule{Windows: []*ScheduleWindow{businessHours}}, at: "2026-12-26 10:00", want: false},
+		{name: "business hours on a holiday", schedule: &Schedule{Windows: []*ScheduleWindow{businessHours}, Holidays: []string{"2026-12-24"}}, at: "2026-12-24 10:00", want: false},
+		{name: "night window before midnight", schedule: &Schedule{Windows: []*ScheduleWindow{nights}}, at: "2026-12-24 23:00", want: true},
+		{name: "night window after midnight", schedule: &Schedule{Windows: []*ScheduleWindow{nights}}, at: "2026-12-25 03:00", want: true},
+		{name: "night window after midnight on the day after the last day", schedule: &Schedule{Windows: []*ScheduleWindow{nights}}, at: "2026-12-26 05:59", want: true},
+		{name: "night window after midnight on the first day", schedule: &Schedule{Windows: []*ScheduleWindow{nights}}, at: "2026-12-24 03:00", want: false},
+		{name: "night window started on a holiday", schedule: &Schedule{Windows: []*ScheduleWindow{nights}, Holidays: []string{"2026-12-24"}}, at: "2026-12-25 03:00", want: false},
+		{name: "night window ending on a holiday", schedule: &Schedule{Windows: []*ScheduleWindow{nights}, Holidays: []string{"2026-12-25"}}, at: "2026-12-25 03:00", want: true},
+		{name: "night window starting on a holiday", schedule: &Schedule{Windows: []*ScheduleWindow{nights}, Holidays: []string{"2026-12-25"}}, at: "2026-12-25 23:00", want: false},
+		{name: "any window", schedule: &Schedule{Windows: []*ScheduleWindow{businessHours, nights}, Holidays: []string{"2026-12-24"}}, at: "2026-12-26 01:00", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.init("schedule"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := tt.schedule.activeAt(at(tt.at)); got != tt.want {
+				t.Errorf("got active %v at %s, want %v", got, tt.at, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+// Package routing implements the alert routing rules of the flexible example.
+//
+// The rules are a superset of the routing rules in the core library. In addition to the core
+// equals, hasPrefix, matchesRegex and matchAll matchers, a rule can match route keys with
+// hasSuffix, glob and regex, it can match other alert fields such as severity and host, and it
+// can be restricted to certain weekdays and times of day with a schedule. The default per-channel
+// rate limit can be overridden per channel and per rule.
+// The rules are evaluated by the ingress in front of the core API server, which sets the
+// Slack channel ID on each alert before it reaches the core library.
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	managerconfig "github.com/slackmgr/core/config"
+	"github.com/slackmgr/types"
+)
+
+// metadataFieldPrefix is the field name prefix used to match string values in the alert metadata.
+const metadataFieldPrefix = "metadata."
+
+var slackChannelIDRegex = regexp.MustCompile(`^[0-9a-zA-Z]{9,15}$`)
+
+// fieldValues maps the supported field names to functions returning the field value for an alert.
+// Field names are case-insensitive. Metadata values are matched with the "metadata.<key>" field name.
+var fieldValues = map[string]func(alert *types.Alert) string{
+	"severity":      func(alert *types.Alert) string { return string(alert.Severity) },
+	"host":          func(alert *types.Alert) string { return alert.Host },
+	"type":          func(alert *types.Alert) string { return alert.Type },
+	"author":        func(alert *types.Alert) string { return alert.Author },
+	"header":        func(alert *types.Alert) string { return alert.Header },
+	"correlationid": func(alert *types.Alert) string { return alert.CorrelationID },
+}
+
+// Settings contains the routing rules, as read from the API settings file.
+//
+// Rules are evaluated in precedence order: exact match, prefix match, suffix match, glob match,
+// regex match, then match-all. Within each precedence level, rules with a matching AlertType take
+// priority over rules with no AlertType specified, and earlier rules take priority over later rules.
+// Field matchers and schedules restrict a rule further; a rule whose field matchers don't match,
+// or whose schedule is inactive, is skipped.
+//
+// RateLimits optionally overrides the default per-channel rate limit, per channel and per rule.
+type Settings struct {
+	RoutingRules []*Rule     `json:"routingRules" yaml:"routingRules"`
+	RateLimits   *RateLimits `json:"rateLimits,omitempty" yaml:"rateLimits"`
+
+	location    *time.Location
+	initialized bool
+}
+
+// Rule defines a single rule for mapping alerts to a Slack channel.
+//
+// The route key matchers (equals, hasPrefix, hasSuffix, glob, regex) are inlined in the rule.
+// MatchesRegex is an alias for Regex, kept for compatibility with the core routing rule format.
+//
+// Fields maps alert field names to matchers. All field matchers must match for the rule to match.
+// Supported field names are severity, host, type, author, header, correlationId and metadata.<key>.
+//
+// Schedule optionally restricts the rule to certain weekdays and times of day. See Schedule for details.
+//
+// Channel is the single destination channel of the rule. Channels lists additional destination
+// channels, each with an optional severity filter. Matching alerts are sent to all accepting targets.
+type Rule struct {
+	Name         string `json:"name" yaml:"name"`
+	Description  string `json:"description,omitempty" yaml:"description"`
+	AlertType    string `json:"alertType,omitempty" yaml:"alertType"`
+	Matcher      `yaml:",inline"`
+	MatchesRegex []string            `json:"matchesRegex,omitempty" yaml:"matchesRegex"`
+	MatchAll     bool                `json:"matchAll,omitempty" yaml:"matchAll"`
+	Fields       map[string]*Matcher `json:"fields,omitempty" yaml:"fields"`
+	Schedule     *Schedule           `json:"schedule,omitempty" yaml:"schedule"`
+	Channel      string              `json:"channel,omitempty" yaml:"channel"`
+	Channels     []*Target           `json:"channels,omitempty" yaml:"channels"`
+
+	targets []*Target
+}
+
+// matchLevel is a single precedence level for route key matching.
+type matchLevel struct {
+	name  string
+	match func(r *Rule, key string) bool
+}
+
+// matchLevels lists the route key precedence levels, from highest to lowest precedence.
+// Match-all rules are evaluated after all of these levels.
+var matchLevels = []matchLevel{
+	{name: "exact", match: func(r *Rule, key string) bool { return r.matchEquals(key) }},
+	{name: "prefix", match: func(r *Rule, key string) bool { return r.matchPrefix(key) }},
+	{name: "suffix", match: func(r *Rule, key string) bool { return r.matchSuffix(key) }},
+	{name: "glob", match: func(r *Rule, key string) bool { return r.matchGlob(key) }},
+	{name: "regex", match: func(r *Rule, key string) bool { return r.matchRegex(key) }},
+}
+
+// InitAndValidate normalizes all rules, compiles the glob and regex patterns, and validates the rules.
+// The location is used to evaluate rule schedules.
+// It returns an error describing the first validation failure encountered, or nil if valid.
+//
+// This method is idempotent - calling it on already initialized settings has no effect.
+func (s *Settings) InitAndValidate(location *time.Location) error {
+	if s.initialized {
+		return nil
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	ruleNames := make(map[string]struct{})
+
+	for i, r := range s.RoutingRules {
+		if r == nil {
+			return fmt.Errorf("rule[%d] cannot be empty", i)
+		}
+
+		r.Name = strings.TrimSpace(r.Name)
+
+		if r.Name == "" {
+			return fmt.Errorf("rule[%d].name cannot be empty", i)
+		}
+
+		if _, ok := ruleNames[r.Name]; ok {
+			return fmt.Errorf("rule[%d].name is not unique", i)
+		}
+
+		ruleNames[r.Name] = struct{}{}
+
+		r.Description = strings.TrimSpace(r.Description)
+		r.AlertType = strings.ToLower(strings.TrimSpace(r.AlertType))
+
+		// Fold the core matchesRegex alias into the regex list.
+		r.Regex = append(r.Regex, r.MatchesRegex...)
+		r.MatchesRegex = nil
+
+		if err := r.init(fmt.Sprintf("rule[%d]", i)); err != nil {
+			return err
+		}
+
+		if !r.MatchAll && r.isEmpty() {
+			return fmt.Errorf("rule[%d] does not match anything", i)
+		}
+
+		fields := make(map[string]*Matcher, len(r.Fields))
+
+		for name, m := range r.Fields {
+			name = strings.ToLower(strings.TrimSpace(name))
+			path := fmt.Sprintf("rule[%d].fields.%s", i, name)
+
+			if _, ok := fieldValues[name]; !ok && (!strings.HasPrefix(name, metadataFieldPrefix) || name == metadataFieldPrefix) {
+				return fmt.Errorf("%s is not a supported alert field", path)
+			}
+
+			if m == nil || m.isEmpty() {
+				return fmt.Errorf("%s does not match anything", path)
+			}
+
+			if err := m.init(path); err != nil {
+				return err
+			}
+
+			fields[name] = m
+		}
+
+		r.Fields = fields
+
+		if r.Schedule != nil {
+			if err := r.Schedule.init(fmt.Sprintf("rule[%d].schedule", i)); err != nil {
+				return err
+			}
+		}
+
+		if err := r.initTargets(fmt.Sprintf("rule[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	if s.RateLimits != nil {
+		if err := s.RateLimits.init(ruleNames); err != nil {
+			return err
+		}
+	}
+
+	s.location = location
+	s.initialized = true
+
+	return nil
+}
+
+// Match finds the routing rule for an alert, based on its route key, alert type and other fields.
+// Rules with a schedule are only considered if the schedule is active at the given time.
+// The alert should be cleaned (see types.Alert.Clean) before matching.
+//
+// Returns the matching rule and a human-readable reason, or nil if no rule matches.
+func (s *Settings) Match(alert *types.Alert, now time.Time) (*Rule, string) {
+	if len(s.RoutingRules) == 0 {
+		return nil, "no rules defined"
+	}
+
+	if s.location != nil {
+		now = now.In(s.location)
+	}
+
+	key := strings.ToLower(alert.RouteKey)
+	alertType := strings.ToLower(alert.Type)
+
+	if key != "" {
+		for _, level := range matchLevels {
+			if rule, reason := s.findRule(alert, alertType, now, level.name+" match for key", func(r *Rule) bool { return level.match(r, key) }); rule != nil {
+				return rule, reason
+			}
+		}
+	}
+
+	if rule, reason := s.findRule(alert, alertType, now, "match-all rule", func(r *Rule) bool { return r.MatchAll }); rule != nil {
+		return rule, reason
+	}
+
+	return nil, "no matching rule found"
+}
+
+// findRule returns the first active rule matching both the predicate and the alert fields.
+// A rule with the same alert type as the alert is returned immediately, otherwise the first
+// matching rule without an alert type is returned.
+func (s *Settings) findRule(alert *types.Alert, alertType string, now time.Time, reason string, match func(r *Rule) bool) (*Rule, string) {
+	var emptyAlertTypeMatch *Rule
+
+	for _, rule := range s.RoutingRules {
+		if !match(rule) || !rule.matchFields(alert) || !rule.activeAt(now) {
+			continue
+		}
+
+		if alertType == rule.AlertType {
+			return rule, reason + ", exact match for alert type"
+		} else if rule.AlertType == "" && emptyAlertTypeMatch == nil {
+			emptyAlertTypeMatch = rule
+		}
+	}
+
+	if emptyAlertTypeMatch != nil {
+		return emptyAlertTypeMatch, reason + ", no match for alert type"
+	}
+
+	return nil, ""
+}
+
+// matchFields returns true if all field matchers match the corresponding alert fields.
+func (r *Rule) matchFields(alert *types.Alert) bool {
+	for name, m := range r.Fields {
+		if !m.Match(fieldValue(alert, name)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// initTargets validates the rule channels, and combines them into a single list of targets.
+func (r *Rule) initTargets(path string) error {
+	r.Channel = strings.TrimSpace(r.Channel)
+
+	if r.Channel == "" && len(r.Channels) == 0 {
+		return fmt.Errorf("%s.channel cannot be empty", path)
+	}
+
+	r.targets = make([]*Target, 0, len(r.Channels)+1)
+
+	if r.Channel != "" {
+		if !slackChannelIDRegex.MatchString(r.Channel) {
+			return fmt.Errorf("%s.channel is not a valid Slack channel ID", path)
+		}
+
+		r.targets = append(r.targets, &Target{Channel: r.Channel})
+	}
+
+	for j, t := range r.Channels {
+		if t == nil {
+			return fmt.Errorf("%s.channels[%d] cannot be empty", path, j)
+		}
+
+		if err := t.init(fmt.Sprintf("%s.channels[%d]", path, j)); err != nil {
+			return err
+		}
+
+		if slices.ContainsFunc(r.targets, func(other *Target) bool { return other.Channel == t.Channel }) {
+			return fmt.Errorf("%s.channels[%d].channel is not unique within the rule", path, j)
+		}
+
+		r.targets = append(r.targets, t)
+	}
+
+	return nil
+}
+
+// TargetChannels returns the channels that the alert should be sent to, after applying the target severity filters.
+// The result is empty if no target accepts the alert.
+func (r *Rule) TargetChannels(alert *types.Alert) []string {
+	channels := make([]string, 0, len(r.targets))
+
+	for _, t := range r.targets {
+		if t.accepts(alert) {
+			channels = append(channels, t.Channel)
+		}
+	}
+
+	return channels
+}
+
+// isFanOut returns true if the rule has more than one target, or a severity filter.
+func (r *Rule) isFanOut() bool {
+	return len(r.targets) > 1 || len(r.targets[0].Severities) > 0
+}
+
+// activeAt returns true if the rule has no schedule, or if the schedule is active at the given time.
+func (r *Rule) activeAt(now time.Time) bool {
+	return r.Schedule == nil || r.Schedule.activeAt(now)
+}
+
+// CoreSettings converts the routing rules to the core API settings format.
+//
+// The core API server still routes alerts that bypass the ingress, such as Prometheus webhooks.
+// Suffix and glob matchers are translated to regular expressions. Since the core library evaluates all
+// regular expressions at the same precedence level, each rule is split into up to three core rules: one
+// with the exact, prefix, suffix and match-all matchers, one named "<name> (glob)" with the glob matchers
+// and one named "<name> (regex)" with the regex matchers. All suffix rules come before all glob rules,
+// which come before all regex rules, so that the precedence is the same as in the ingress.
+//
+// Rules with field matchers, schedules or multiple targets can't be translated, since the core library can
+// only match on route key and alert type, and only supports a single channel per rule. They are left out,
+// and the second return value describes each of them, so that the caller can log them. Alerts routed by the
+// core API server may therefore end up in a different channel than if they had been routed by the ingress.
+func (s *Settings) CoreSettings() (*managerconfig.APISettings, []string) {
+	var suffixRules, globRules, regexRules []*managerconfig.RoutingRule
+	var skipped []string
+
+	for _, r := range s.RoutingRules {
+		var reasons []string
+
+		if len(r.Fields) > 0 {
+			reasons = append(reasons, "field matchers")
+		}
+
+		if r.Schedule != nil {
+			reasons = append(reasons, "a schedule")
+		}
+
+		if r.isFanOut() {
+			reasons = append(reasons, "multiple targets or a severity filter")
+		}
+
+		if len(reasons) > 0 {
+			skipped = append(skipped, fmt.Sprintf("rule %s is not used by the core API server, since it has %s", r.Name, strings.Join(reasons, " and ")))
+			continue
+		}
+
+		newCoreRule := func(name string, regexes []string) *managerconfig.RoutingRule {
+			return &managerconfig.RoutingRule{
+				Name:         name,
+				Description:  r.Description,
+				AlertType:    r.AlertType,
+				MatchesRegex: regexes,
+				Channel:      r.targets[0].Channel,
+			}
+		}
+
+		if len(r.Equals) > 0 || len(r.HasPrefix) > 0 || len(r.HasSuffix) > 0 || r.MatchAll {
+			suffixes := make([]string, 0, len(r.HasSuffix))
+
+			for _, suffix := range r.HasSuffix {
+				suffixes = append(suffixes, "(?i)"+regexp.QuoteMeta(suffix)+"$")
+			}
+
+			rule := newCoreRule(r.Name, suffixes)
+			rule.Equals = r.Equals
+			rule.HasPrefix = r.HasPrefix
+			rule.MatchAll = r.MatchAll
+
+			suffixRules = append(suffixRules, rule)
+		}
+
+		if len(r.Glob) > 0 {
+			globs := make([]string, 0, len(r.Glob))
+
+			for _, glob := range r.Glob {
+				globs = append(globs, globToRegex(glob))
+			}
+
+			globRules = append(globRules, newCoreRule(r.Name+" (glob)", globs))
+		}
+
+		if len(r.Regex) > 0 {
+			regexRules = append(regexRules, newCoreRule(r.Name+" (regex)", r.Regex))
+		}
+	}
+
+	return &managerconfig.APISettings{RoutingRules: slices.Concat(suffixRules, globRules, regexRules)}, skipped
+}
+
+// fieldValue returns the value of the named alert field, or an empty string if the field is not set.
+func fieldValue(alert *types.Alert, name string) string {
+	if key, ok := strings.CutPrefix(name, metadataFieldPrefix); ok {
+		for k, v := range alert.Metadata {
+			if strings.EqualFold(k, key) {
+				return fmt.Sprint(v)
+			}
+		}
+
+		return ""
+	}
+
+	if value, ok := fieldValues[name]; ok {
+		return value(alert)
+	}
+
+	return ""
+}
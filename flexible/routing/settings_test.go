@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+func TestCoreSettings(t *testing.T) {
+	settings := &Settings{
+		RoutingRules: []*Rule{
+			{Name: "regex", Matcher: Matcher{Regex: []string{"^db-.*"}}, Channel: "CREGEX0001"},
+			{Name: "glob", Matcher: Matcher{Glob: []string{"db-*-eu"}}, Channel: "CGLOB00001"},
+			{Name: "suffix", Matcher: Matcher{HasSuffix: []string{"-prod"}, HasPrefix: []string{"web-"}}, Channel: "CSUFFIX001"},
+			{Name: "mixed", Matcher: Matcher{Equals: []string{"api"}, Glob: []string{"api-*"}, Regex: []string{"^api"}}, Channel: "CMIXED0001"},
+			{Name: "fields", Matcher: Matcher{Equals: []string{"cache"}}, Fields: map[string]*Matcher{"severity": {Equals: []string{"error"}}}, Channel: "CFIELDS001"},
+			{Name: "schedule", Matcher: Matcher{Equals: []string{"batch"}}, Schedule: &Schedule{Windows: []*ScheduleWindow{{Days: []string{"mon"}}}}, Channel: "CSCHED0001"},
+			{Name: "fan-out", Matcher: Matcher{Equals: []string{"queue"}}, Channels: []*Target{{Channel: "CFANOUT001"}, {Channel: "CFANOUT002"}}},
+			{Name: "default", MatchAll: true, Channel: "CDEFAULT01"},
+		},
+	}
+
+	if err := settings.InitAndValidate(time.UTC); err != nil {
+		t.Fatal(err)
+	}
+
+	core, skipped := settings.CoreSettings()
+
+	if err := core.InitAndValidate(&types.NoopLogger{}); err != nil {
+		t.Fatalf("invalid core settings: %s", err)
+	}
+
+	wantNames := []string{"suffix", "mixed", "default", "glob (glob)", "mixed (glob)", "regex (regex)", "mixed (regex)"}
+
+	names := make([]string, 0, len(core.RoutingRules))
+	for _, r := range core.RoutingRules {
+		names = append(names, r.Name)
+	}
+
+	if !slices.Equal(names, wantNames) {
+		t.Errorf("got core rules %v, want %v", names, wantNames)
+	}
+
+	wantSkipped := []string{
+		"rule fields is not used by the core API server, since it has field matchers",
+		"rule schedule is not used by the core API server, since it has a schedule",
+		"rule fan-out is not used by the core API server, since it has multiple targets or a severity filter",
+	}
+
+	if !slices.Equal(skipped, wantSkipped) {
+		t.Errorf("got skipped rules %q, want %q", skipped, wantSkipped)
+	}
+
+	// The core API server routes the keys of the translated rules like the ingress does.
+	tests := []struct {
+		routeKey string
+		want     string
+	}{
+		{routeKey: "db-main-prod", want: "CSUFFIX001"},
+		{routeKey: "db-main-eu", want: "CGLOB00001"},
+		{routeKey: "db-main", want: "CREGEX0001"},
+		{routeKey: "web-frontend", want: "CSUFFIX001"},
+		{routeKey: "api", want: "CMIXED0001"},
+		{routeKey: "api-gateway", want: "CMIXED0001"},
+		{routeKey: "apiserver", want: "CMIXED0001"},
+		{routeKey: "other", want: "CDEFAULT01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.routeKey, func(t *testing.T) {
+			rule, _ := settings.Match(&types.Alert{RouteKey: tt.routeKey}, time.Now())
+			if rule == nil || rule.Channel != tt.want {
+				t.Errorf("got ingress rule %v, want channel %s", rule, tt.want)
+			}
+
+			if channel, _ := core.Match(tt.routeKey, "", &types.NoopLogger{}); channel != tt.want {
+				t.Errorf("got core channel %s, want %s", channel, tt.want)
+			}
+		})
+	}
+}
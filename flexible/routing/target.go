@@ -0,0 +1,48 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/slackmgr/types"
+)
+
+// Target is a single destination channel for a routing rule, with an optional severity filter.
+//
+// A rule with multiple targets fans out each matching alert to all targets whose severity filter
+// accepts the alert. Each copy is tracked as an independent issue in its channel.
+type Target struct {
+	Channel    string   `json:"channel" yaml:"channel"`
+	Severities []string `json:"severities,omitempty" yaml:"severities"`
+}
+
+// init validates the target channel and severity filter.
+func (t *Target) init(path string) error {
+	t.Channel = strings.TrimSpace(t.Channel)
+
+	if t.Channel == "" {
+		return fmt.Errorf("%s.channel cannot be empty", path)
+	}
+
+	if !slackChannelIDRegex.MatchString(t.Channel) {
+		return fmt.Errorf("%s.channel is not a valid Slack channel ID", path)
+	}
+
+	for i, s := range t.Severities {
+		s = strings.ToLower(strings.TrimSpace(s))
+
+		if !types.SeverityIsValid(types.AlertSeverity(s)) {
+			return fmt.Errorf("%s.severities[%d] must be one of [%s]", path, i, strings.Join(types.ValidSeverities(), ", "))
+		}
+
+		t.Severities[i] = s
+	}
+
+	return nil
+}
+
+// accepts returns true if the target has no severity filter, or if the alert severity is in the filter.
+func (t *Target) accepts(alert *types.Alert) bool {
+	return len(t.Severities) == 0 || slices.Contains(t.Severities, strings.ToLower(string(alert.Severity)))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	managerconfig "github.com/slackmgr/core/config"
+	managerpkg "github.com/slackmgr/core/manager"
+	api "github.com/slackmgr/core/restapi"
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/flexible/routing"
+	"github.com/slackmgr/examples/hostkit"
+)
+
+// settingsReloader reads the manager and API settings files and applies them to the running manager, API server and ingress.
+// The default log levels in the manager settings file are applied to the log levels shared by all loggers.
+// It is shared by the periodic settings refresher, the SIGHUP handler and the admin reload endpoint.
+// A mutex serializes reloads, so that the settings hashes are never updated concurrently.
+type settingsReloader struct {
+	mu                  sync.Mutex
+	cfg                 *config.Config
+	location            *time.Location
+	manager             *managerpkg.Manager
+	logLevels           *hostkit.LogLevels
+	managerSettingsHash string
+	apiServer           *api.Server
+	ingress             *ingressServer
+	apiSettingsHash     string
+	coreRateLimit       routing.RateLimit
+}
+
+// settingsReloadResult describes the outcome of a single reload of both settings files.
+type settingsReloadResult struct {
+	Manager settingsFileReloadResult `json:"manager"`
+	API     settingsFileReloadResult `json:"api"`
+}
+
+// settingsFileReloadResult describes the outcome of reloading a single settings file.
+type settingsFileReloadResult struct {
+	Filename string `json:"filename"`
+	Hash     string `json:"hash,omitempty"`
+	Changed  bool   `json:"changed"`
+	Applied  bool   `json:"applied"`
+	Error    string `json:"error,omitempty"`
+}
+
+func newSettingsReloader(cfg *config.Config, location *time.Location, manager *managerpkg.Manager, logLevels *hostkit.LogLevels, managerSettingsHash string, apiServer *api.Server, ingress *ingressServer, apiSettingsHash string, coreRateLimit routing.RateLimit) *settingsReloader {
+	return &settingsReloader{
+		cfg:                 cfg,
+		location:            location,
+		manager:             manager,
+		logLevels:           logLevels,
+		managerSettingsHash: managerSettingsHash,
+		apiServer:           apiServer,
+		ingress:             ingress,
+		apiSettingsHash:     apiSettingsHash,
+		coreRateLimit:       coreRateLimit,
+	}
+}
+
+// reload reads both settings files and applies them if they have changed since the last reload.
+// If force is true, the settings are applied even if the files are unchanged.
+func (r *settingsReloader) reload(force bool) *settingsReloadResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &settingsReloadResult{
+		Manager: settingsFileReloadResult{Filename: r.cfg.ManagerSettingsFilename},
+		API:     settingsFileReloadResult{Filename: r.cfg.APISettingsFilename},
+	}
+
+	managerSettings, logLevels, hash, err := readManagerSettings(r.cfg.ManagerSettingsFilename)
+	if err != nil {
+		log.Error().Msgf("Failed to read manager settings: %s", err)
+		result.Manager.Error = err.Error()
+	} else {
+		result.Manager.Hash = hash
+		result.Manager.Changed = hash != r.managerSettingsHash
+
+		if force || result.Manager.Changed {
+			if err := r.manager.UpdateSettings(managerSettings); err != nil {
+				log.Error().Msgf("Failed to update manager settings: %s", err)
+				result.Manager.Error = err.Error()
+			} else {
+				r.logLevels.SetDefaults(logLevels)
+				result.Manager.Applied = true
+			}
+
+			r.managerSettingsHash = hash
+		}
+	}
+
+	apiSettings, hash, err := readAPISettings(r.cfg.APISettingsFilename, r.location)
+	if err != nil {
+		log.Error().Msgf("Failed to read API settings: %s", err)
+		result.API.Error = err.Error()
+	} else {
+		result.API.Hash = hash
+		result.API.Changed = hash != r.apiSettingsHash
+
+		if force || result.API.Changed {
+			// The core API server validates its subset of the rules first. The ingress is only updated if that succeeds.
+			if err := r.checkCoreRateLimit(apiSettings); err != nil {
+				log.Error().Msgf("Failed to update API settings: %s", err)
+				result.API.Error = err.Error()
+			} else if err := r.apiServer.UpdateSettings(coreSettings(apiSettings)); err != nil {
+				log.Error().Msgf("Failed to update API settings: %s", err)
+				result.API.Error = err.Error()
+			} else {
+				r.ingress.UpdateSettings(apiSettings)
+				result.API.Applied = true
+			}
+
+			r.apiSettingsHash = hash
+		}
+	}
+
+	return result
+}
+
+// coreSettings converts the routing rules to the core API settings, and logs the rules that the core API server can't use.
+func coreSettings(settings *routing.Settings) *managerconfig.APISettings {
+	core, skipped := settings.CoreSettings()
+
+	for _, msg := range skipped {
+		log.Info().Msg(msg)
+	}
+
+	return core
+}
+
+// checkCoreRateLimit returns an error if the settings have a rate limit override above the core rate limit, which
+// was set at startup. The core API server would otherwise reject alerts that the ingress has accepted.
+func (r *settingsReloader) checkCoreRateLimit(settings *routing.Settings) error {
+	limit := coreRateLimit(r.cfg, settings)
+
+	if limit.AlertsPerSecond > r.coreRateLimit.AlertsPerSecond || limit.AllowedBurst > r.coreRateLimit.AllowedBurst {
+		return fmt.Errorf("rate limit overrides above %v alerts per second or a burst of %d require a restart", r.coreRateLimit.AlertsPerSecond, r.coreRateLimit.AllowedBurst)
+	}
+
+	return nil
+}
+
+// Err returns an error if reloading either of the settings files failed, or nil otherwise.
+func (r *settingsReloadResult) Err() error {
+	var errs []error
+
+	if r.Manager.Error != "" {
+		errs = append(errs, fmt.Errorf("manager settings: %s", r.Manager.Error))
+	}
+
+	if r.API.Error != "" {
+		errs = append(errs, fmt.Errorf("API settings: %s", r.API.Error))
+	}
+
+	return errors.Join(errs...)
+}
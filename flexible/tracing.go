@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/slackmgr/examples/flexible/config"
+	"github.com/slackmgr/examples/hostkit/hostmetrics"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// tracerName is the instrumentation scope name used for all spans created by the host.
+	tracerName = "github.com/slackmgr/examples/flexible"
+
+	// traceMetadataKey is the alert metadata key holding the W3C trace context of the ingress request. The core API
+	// server doesn't pass on the request context when it sends an alert to the queue, so the trace context travels
+	// through it in the alert. The queue decorator removes it from the message body, and sends it as message headers.
+	traceMetadataKey = "slackmgrTraceContext"
+)
+
+// traceContextPropagator is the propagator used for HTTP requests and queue messages.
+var traceContextPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// newTracerProvider creates the tracer provider, based on the TracingExporter setting in the config.
+// If tracing is disabled, a no-op provider is returned. The exporter endpoint, headers and TLS settings are
+// read from the standard OTEL_EXPORTER_OTLP_* environment variables.
+// The returned function flushes and stops the exporter, and must be called before exiting.
+func newTracerProvider(ctx context.Context, cfg *config.Config) (trace.TracerProvider, func(context.Context) error, error) { //nolint:ireturn
+	noShutdown := func(context.Context) error { return nil }
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(cfg.TracingExporter) {
+	case "", "none":
+		return noop.NewTracerProvider(), noShutdown, nil
+	case "otlp":
+		switch strings.ToLower(cfg.TracingOTLPProtocol) {
+		case "grpc":
+			exporter, err = otlptracegrpc.New(ctx)
+		case "http":
+			exporter, err = otlptracehttp.New(ctx)
+		default:
+			return nil, nil, fmt.Errorf("unknown OTLP protocol: %s", cfg.TracingOTLPProtocol)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter: %s", cfg.TracingExporter)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := hostmetrics.NewOTelResource(map[string]string{
+		"service.name":        cfg.MetricsService,
+		"service.role":        cfg.MetricsRole,
+		"service.instance.id": cfg.MetricsInstance,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(traceContextPropagator)
+
+	return provider, provider.Shutdown, nil
+}
+
+// setTraceMetadata adds the trace context of ctx to the alert metadata, or removes any trace context set by the
+// client if ctx has no valid span.
+func setTraceMetadata(ctx context.Context, alert *types.Alert) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		delete(alert.Metadata, traceMetadataKey)
+		return
+	}
+
+	carrier := propagation.MapCarrier{}
+	traceContextPropagator.Inject(ctx, carrier)
+
+	if alert.Metadata == nil {
+		alert.Metadata = make(map[string]any)
+	}
+
+	alert.Metadata[traceMetadataKey] = carrier
+}
+
+// takeTraceMetadata removes the trace context added by setTraceMetadata from an alert message body, and returns
+// the body without it along with the trace context. Other bodies, e.g. commands, are returned unchanged.
+func takeTraceMetadata(body string) (string, propagation.MapCarrier) {
+	if !strings.Contains(body, traceMetadataKey) {
+		return body, nil
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return body, nil
+	}
+
+	var metadata map[string]json.RawMessage
+
+	if err := json.Unmarshal(fields["metadata"], &metadata); err != nil || metadata[traceMetadataKey] == nil {
+		return body, nil
+	}
+
+	var carrier propagation.MapCarrier
+
+	if err := json.Unmarshal(metadata[traceMetadataKey], &carrier); err != nil {
+		return body, nil
+	}
+
+	delete(metadata, traceMetadataKey)
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return body, nil
+	}
+
+	fields["metadata"] = data
+
+	result, err := json.Marshal(fields)
+	if err != nil {
+		return body, nil
+	}
+
+	return string(result), carrier
+}
@@ -0,0 +1,444 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/slackmgr/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+// schemaVersion is the version of the bucket layout. Bump it when the layout changes in an incompatible way.
+const schemaVersion = "1"
+
+var (
+	metaBucket                   = []byte("meta")
+	alertsBucket                 = []byte("alerts")
+	issuesBucket                 = []byte("issues")
+	moveMappingsBucket           = []byte("move_mappings")
+	channelProcessingStateBucket = []byte("channel_processing_states")
+
+	schemaVersionKey = []byte("schema_version")
+
+	dataBuckets = [][]byte{alertsBucket, issuesBucket, moveMappingsBucket, channelProcessingStateBucket}
+)
+
+// DB implements types.DB on top of a bbolt file, with the same behaviour as types.InMemoryDB.
+//
+// Issues are stored with the fields used for lookups next to the issue body, and the lookups scan the issues bucket.
+// This is fast enough for the number of issues a small team has, and keeps the file format simple.
+type DB struct {
+	bolt *bolt.DB
+}
+
+// issueRecord is an issue as stored in the issues bucket, keyed by the issue ID.
+type issueRecord struct {
+	ChannelID     string          `json:"channelId"`
+	CorrelationID string          `json:"correlationId"`
+	PostID        string          `json:"postId"`
+	IsOpen        bool            `json:"isOpen"`
+	Body          json.RawMessage `json:"body"`
+}
+
+// Init creates the buckets if they don't exist. Unless skipSchemaValidation is set, it also verifies that the
+// file was created with the current schema version.
+func (db *DB) Init(_ context.Context, skipSchemaValidation bool) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range dataBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		version := meta.Get(schemaVersionKey)
+		if version == nil {
+			return meta.Put(schemaVersionKey, []byte(schemaVersion))
+		}
+
+		if !skipSchemaValidation && string(version) != schemaVersion {
+			return fmt.Errorf("schema version is %s, expected %s", version, schemaVersion)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAlert creates or updates an alert.
+func (db *DB) SaveAlert(_ context.Context, alert *types.Alert) error {
+	if alert == nil {
+		return errors.New("alert is nil")
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(alertsBucket).Put([]byte(alert.UniqueID()), body)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+
+	return nil
+}
+
+// SaveIssue creates or updates a single issue.
+func (db *DB) SaveIssue(ctx context.Context, issue types.Issue) error {
+	return db.SaveIssues(ctx, issue)
+}
+
+// SaveIssues creates or updates multiple issues, in a single transaction.
+func (db *DB) SaveIssues(_ context.Context, issues ...types.Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	records := make(map[string][]byte, len(issues))
+
+	for _, issue := range issues {
+		if issue == nil {
+			return errors.New("issue is nil")
+		}
+
+		record, err := newIssueRecord(issue, issue.ChannelID())
+		if err != nil {
+			return err
+		}
+
+		records[issue.UniqueID()] = record
+	}
+
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(issuesBucket)
+
+		for id, record := range records {
+			if err := bucket.Put([]byte(id), record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save issues: %w", err)
+	}
+
+	return nil
+}
+
+// MoveIssue moves an issue from one channel to another.
+// Returns an error if sourceChannelID and targetChannelID are the same.
+// If the issue does not exist in the store, this is a no-op.
+func (db *DB) MoveIssue(_ context.Context, issue types.Issue, sourceChannelID, targetChannelID string) error {
+	if sourceChannelID == targetChannelID {
+		return errors.New("source and target channel IDs are the same")
+	}
+
+	if issue == nil {
+		return errors.New("issue is nil")
+	}
+
+	record, err := newIssueRecord(issue, targetChannelID)
+	if err != nil {
+		return err
+	}
+
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(issuesBucket)
+		id := []byte(issue.UniqueID())
+
+		if bucket.Get(id) == nil {
+			return nil
+		}
+
+		return bucket.Put(id, record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move issue: %w", err)
+	}
+
+	return nil
+}
+
+// FindOpenIssueByCorrelationID finds a single open issue by channel ID and correlation ID.
+// Returns an error if channelID or correlationID are empty, or if multiple open issues match.
+func (db *DB) FindOpenIssueByCorrelationID(_ context.Context, channelID, correlationID string) (string, json.RawMessage, error) {
+	if channelID == "" {
+		return "", nil, errors.New("channelID is required")
+	}
+
+	if correlationID == "" {
+		return "", nil, errors.New("correlationID is required")
+	}
+
+	var foundID string
+	var foundBody json.RawMessage
+
+	err := db.scanIssues(func(id string, record *issueRecord) error {
+		if record.ChannelID != channelID || record.CorrelationID != correlationID || !record.IsOpen {
+			return nil
+		}
+
+		if foundBody != nil {
+			return fmt.Errorf("multiple open issues found for channel %q and correlationID %q", channelID, correlationID)
+		}
+
+		foundID = id
+		foundBody = record.Body
+
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return foundID, foundBody, nil
+}
+
+// FindIssueBySlackPostID finds a single issue by channel ID and Slack post ID.
+// Returns an error if channelID or postID are empty.
+func (db *DB) FindIssueBySlackPostID(_ context.Context, channelID, postID string) (string, json.RawMessage, error) {
+	if channelID == "" {
+		return "", nil, errors.New("channelID is required")
+	}
+
+	if postID == "" {
+		return "", nil, errors.New("postID is required")
+	}
+
+	var foundID string
+	var foundBody json.RawMessage
+
+	err := db.scanIssues(func(id string, record *issueRecord) error {
+		if foundBody == nil && record.ChannelID == channelID && record.PostID == postID {
+			foundID = id
+			foundBody = record.Body
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return foundID, foundBody, nil
+}
+
+// FindActiveChannels returns a list of all channels that have at least one open issue.
+func (db *DB) FindActiveChannels(_ context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	channels := []string{}
+
+	err := db.scanIssues(func(_ string, record *issueRecord) error {
+		if _, ok := seen[record.ChannelID]; record.IsOpen && !ok {
+			seen[record.ChannelID] = struct{}{}
+			channels = append(channels, record.ChannelID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// LoadOpenIssuesInChannel loads all open issues for the specified channel.
+func (db *DB) LoadOpenIssuesInChannel(_ context.Context, channelID string) (map[string]json.RawMessage, error) {
+	result := make(map[string]json.RawMessage)
+
+	err := db.scanIssues(func(id string, record *issueRecord) error {
+		if record.ChannelID == channelID && record.IsOpen {
+			result[id] = record.Body
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SaveMoveMapping creates or updates a move mapping.
+func (db *DB) SaveMoveMapping(_ context.Context, moveMapping types.MoveMapping) error {
+	if moveMapping == nil {
+		return errors.New("moveMapping is nil")
+	}
+
+	body, err := moveMapping.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal move mapping: %w", err)
+	}
+
+	key := moveMappingKey(moveMapping.ChannelID(), moveMapping.GetCorrelationID())
+
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(moveMappingsBucket).Put(key, body)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save move mapping: %w", err)
+	}
+
+	return nil
+}
+
+// FindMoveMapping finds a move mapping by channel ID and correlation ID.
+// Returns an error if channelID or correlationID are empty.
+func (db *DB) FindMoveMapping(_ context.Context, channelID, correlationID string) (json.RawMessage, error) {
+	if channelID == "" {
+		return nil, errors.New("channelID is required")
+	}
+
+	if correlationID == "" {
+		return nil, errors.New("correlationID is required")
+	}
+
+	var body json.RawMessage
+
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		// The value is only valid during the transaction, so it must be copied.
+		if value := tx.Bucket(moveMappingsBucket).Get(moveMappingKey(channelID, correlationID)); value != nil {
+			body = append(json.RawMessage{}, value...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find move mapping: %w", err)
+	}
+
+	return body, nil
+}
+
+// DeleteMoveMapping deletes a move mapping. No error is returned if the mapping does not exist.
+func (db *DB) DeleteMoveMapping(_ context.Context, channelID, correlationID string) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(moveMappingsBucket).Delete(moveMappingKey(channelID, correlationID))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete move mapping: %w", err)
+	}
+
+	return nil
+}
+
+// SaveChannelProcessingState creates or updates a channel processing state.
+func (db *DB) SaveChannelProcessingState(_ context.Context, state *types.ChannelProcessingState) error {
+	if state == nil {
+		return errors.New("state is nil")
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channel processing state: %w", err)
+	}
+
+	err = db.bolt.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(channelProcessingStateBucket).Put([]byte(state.ChannelID), body)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save channel processing state: %w", err)
+	}
+
+	return nil
+}
+
+// FindChannelProcessingState finds a channel processing state by channel ID.
+// Returns nil without an error if no state is found.
+func (db *DB) FindChannelProcessingState(_ context.Context, channelID string) (*types.ChannelProcessingState, error) {
+	var state *types.ChannelProcessingState
+
+	err := db.bolt.View(func(tx *bolt.Tx) error {
+		body := tx.Bucket(channelProcessingStateBucket).Get([]byte(channelID))
+		if body == nil {
+			return nil
+		}
+
+		state = &types.ChannelProcessingState{}
+
+		return json.Unmarshal(body, state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find channel processing state: %w", err)
+	}
+
+	return state, nil
+}
+
+// DropAllData deletes all alerts, issues, move mappings and channel processing states. Queues are not affected.
+func (db *DB) DropAllData(_ context.Context) error {
+	err := db.bolt.Update(func(tx *bolt.Tx) error {
+		for _, name := range dataBuckets {
+			if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop all data: %w", err)
+	}
+
+	return nil
+}
+
+// scanIssues calls fn for each issue, until fn returns an error.
+func (db *DB) scanIssues(fn func(id string, record *issueRecord) error) error {
+	return db.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(issuesBucket).ForEach(func(k, v []byte) error {
+			// Unmarshalling copies the values, so the record can be used after the transaction.
+			record := &issueRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return fmt.Errorf("failed to unmarshal issue %s: %w", k, err)
+			}
+
+			return fn(string(k), record)
+		})
+	})
+}
+
+func newIssueRecord(issue types.Issue, channelID string) ([]byte, error) {
+	body, err := issue.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal issue: %w", err)
+	}
+
+	record, err := json.Marshal(&issueRecord{
+		ChannelID:     channelID,
+		CorrelationID: issue.GetCorrelationID(),
+		PostID:        issue.CurrentPostID(),
+		IsOpen:        issue.IsOpen(),
+		Body:          body,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal issue record: %w", err)
+	}
+
+	return record, nil
+}
+
+func moveMappingKey(channelID, correlationID string) []byte {
+	return []byte(channelID + "\x00" + correlationID)
+}
@@ -0,0 +1,26 @@
+package boltstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit/dbconformance"
+	"github.com/slackmgr/types"
+)
+
+func TestDBConformance(t *testing.T) {
+	factory := func(ctx context.Context) (types.DB, error) {
+		db := openTestStore(t, "").DB()
+		return db, db.Init(ctx, false)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, result := range dbconformance.Run(ctx, factory) {
+		if result.Err != nil {
+			t.Errorf("%s: %s", result.Check, result.Err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// receiveBatchSize is the maximum number of items read from the file in one transaction.
+	receiveBatchSize = 100
+
+	// defaultNackDelay is how long a nacked item waits before it is delivered again by default, to avoid busy
+	// redelivery loops.
+	defaultNackDelay = 5 * time.Second
+
+	// defaultVisibilityTimeout is how long a delivered item may go without an ack or nack by default.
+	defaultVisibilityTimeout = 2 * time.Minute
+)
+
+// FifoQueue implements manager.FifoQueue on top of a bbolt file.
+//
+// Items are delivered in the order they were sent, and are only removed from the file when acked.
+// Nacked items are delivered again after a short delay, and items that are neither acked nor nacked within the
+// visibility timeout are delivered again, like in SQS. Items that were not acked before a restart are delivered
+// again when the queue is next received from. Like types.InMemoryFifoQueue, the queue doesn't deduplicate items,
+// and it supports a single receiver at a time. It is a hostkit.HeaderFifoQueue, which stores the headers of each
+// item next to its body.
+type FifoQueue struct {
+	bolt              *bolt.DB
+	name              string
+	bucket            []byte
+	visibilityTimeout time.Duration
+	nackDelay         time.Duration
+	notify            chan struct{}
+
+	// A mutex is used to protect the fields below from concurrent access.
+	mu       sync.Mutex
+	inFlight map[uint64]*delivery
+	cursor   uint64
+	attempt  uint64
+}
+
+// delivery is an item in flight, with the time it is delivered again unless it is acked or nacked first.
+// The attempt number tells apart deliveries of the same item, so that a late nack can't release a later delivery.
+type delivery struct {
+	deadline time.Time
+	attempt  uint64
+}
+
+// QueueOption configures a FifoQueue.
+type QueueOption func(*FifoQueue)
+
+// WithVisibilityTimeout sets how long a delivered item may go without an ack or nack before it is delivered again,
+// for example because the receiver got stuck. Defaults to 2 minutes.
+func WithVisibilityTimeout(d time.Duration) QueueOption {
+	return func(q *FifoQueue) { q.visibilityTimeout = d }
+}
+
+// WithNackDelay sets how long a nacked item waits before it is delivered again. Defaults to 5 seconds.
+func WithNackDelay(d time.Duration) QueueOption {
+	return func(q *FifoQueue) { q.nackDelay = d }
+}
+
+// queueRecord is an item as stored in the queue bucket, keyed by a big-endian sequence number.
+type queueRecord struct {
+	SlackChannelID string            `json:"slackChannelId"`
+	Body           string            `json:"body"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Sent           time.Time         `json:"sent"`
+}
+
+func newFifoQueue(db *bolt.DB, name string, opts ...QueueOption) *FifoQueue {
+	q := &FifoQueue{
+		bolt:              db,
+		name:              name,
+		bucket:            []byte("queue_" + name),
+		visibilityTimeout: defaultVisibilityTimeout,
+		nackDelay:         defaultNackDelay,
+		notify:            make(chan struct{}, 1),
+		inFlight:          make(map[uint64]*delivery),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+// Name returns the name of the queue.
+func (q *FifoQueue) Name() string {
+	return q.name
+}
+
+// Send writes a message to the queue. The dedup ID is ignored.
+// An error is returned if the context is canceled or the write fails.
+func (q *FifoQueue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.SendWithHeaders(ctx, slackChannelID, dedupID, body, nil)
+}
+
+// SendWithHeaders writes a message to the queue like Send, with the headers stored next to the body.
+func (q *FifoQueue) SendWithHeaders(ctx context.Context, slackChannelID, _, body string, headers map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record, err := json.Marshal(&queueRecord{SlackChannelID: slackChannelID, Body: body, Headers: headers, Sent: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue item: %w", err)
+	}
+
+	err = q.bolt.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(q.bucket)
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(sequenceKey(seq), record)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write to queue %s: %w", q.name, err)
+	}
+
+	q.wake()
+
+	return nil
+}
+
+// Receive receives messages from the queue, to the specified sink channel.
+// An error is returned if the context is canceled.
+// The sink channel is closed when the function returns.
+func (q *FifoQueue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+// ReceiveWithHeaders receives messages like Receive, with their headers.
+// The sink channel is closed when the function returns.
+func (q *FifoQueue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	defer close(sinkCh)
+
+	for {
+		items, wait, err := q.next(time.Now())
+		if err != nil {
+			return err
+		}
+
+		for i, item := range items {
+			select {
+			case <-ctx.Done():
+				// Release the items that were never delivered, so that the next receiver gets them right away.
+				q.releaseUndelivered(items[i:])
+
+				return ctx.Err()
+			case sinkCh <- item:
+			}
+		}
+
+		if len(items) > 0 {
+			continue
+		}
+
+		// Wait for new or released items, or for the first in-flight item to time out.
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-q.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// next reads the oldest items that are not in flight, and marks them as in flight. In-flight items past their
+// deadline are delivered again. The scan starts after the cursor, which is the last item read, unless an item before
+// it was released. If there are no items, next returns how long to wait for the first in-flight item to time out.
+func (q *FifoQueue) next(now time.Time) ([]*hostkit.FifoQueueMessage, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wait := q.visibilityTimeout
+
+	for seq, d := range q.inFlight {
+		if !now.Before(d.deadline) {
+			delete(q.inFlight, seq)
+			q.rewind(seq)
+		} else {
+			wait = min(wait, d.deadline.Sub(now))
+		}
+	}
+
+	var items []*hostkit.FifoQueueMessage
+
+	err := q.bolt.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(q.bucket)
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+
+		for k, v := c.Seek(sequenceKey(q.cursor + 1)); k != nil && len(items) < receiveBatchSize; k, v = c.Next() {
+			seq := binary.BigEndian.Uint64(k)
+			q.cursor = seq
+
+			if _, ok := q.inFlight[seq]; ok {
+				continue
+			}
+
+			record := &queueRecord{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return fmt.Errorf("failed to unmarshal queue item %d: %w", seq, err)
+			}
+
+			q.attempt++
+			q.inFlight[seq] = &delivery{deadline: now.Add(q.visibilityTimeout), attempt: q.attempt}
+			items = append(items, q.newItem(seq, q.attempt, record))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read from queue %s: %w", q.name, err)
+	}
+
+	return items, wait, nil
+}
+
+func (q *FifoQueue) newItem(seq, attempt uint64, record *queueRecord) *hostkit.FifoQueueMessage {
+	var once sync.Once
+
+	item := &types.FifoQueueItem{
+		MessageID:        strconv.FormatUint(seq, 10),
+		SlackChannelID:   record.SlackChannelID,
+		ReceiveTimestamp: time.Now(),
+		Body:             record.Body,
+		Ack: func() {
+			once.Do(func() { q.ack(seq) })
+		},
+		Nack: func() {
+			once.Do(func() { time.AfterFunc(q.nackDelay, func() { q.releaseAttempt(seq, attempt) }) })
+		},
+	}
+
+	return &hostkit.FifoQueueMessage{Item: item, Headers: record.Headers}
+}
+
+// ack deletes the item from the file, even if it was delivered again after its visibility timeout.
+// If the delete fails, the item is delivered again when its visibility timeout expires.
+func (q *FifoQueue) ack(seq uint64) {
+	err := q.bolt.Update(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(q.bucket); bucket != nil {
+			return bucket.Delete(sequenceKey(seq))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	q.mu.Lock()
+	delete(q.inFlight, seq)
+	q.mu.Unlock()
+}
+
+// releaseUndelivered makes items that were read but never delivered available for delivery again, right away.
+func (q *FifoQueue) releaseUndelivered(items []*hostkit.FifoQueueMessage) {
+	for _, item := range items {
+		seq, err := strconv.ParseUint(item.Item.MessageID, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		q.mu.Lock()
+		d, ok := q.inFlight[seq]
+		q.mu.Unlock()
+
+		if ok {
+			q.releaseAttempt(seq, d.attempt)
+		}
+	}
+}
+
+// releaseAttempt makes a nacked item available for delivery again, unless it was acked or delivered again since.
+func (q *FifoQueue) releaseAttempt(seq, attempt uint64) {
+	q.mu.Lock()
+
+	d, ok := q.inFlight[seq]
+	if !ok || d.attempt != attempt {
+		q.mu.Unlock()
+		return
+	}
+
+	delete(q.inFlight, seq)
+	q.rewind(seq)
+	q.mu.Unlock()
+
+	q.wake()
+}
+
+// rewind moves the cursor back, so that the next scan includes the item. The mutex must be held.
+func (q *FifoQueue) rewind(seq uint64) {
+	q.cursor = min(q.cursor, seq-1)
+}
+
+// wake signals Receive that there may be new items, without blocking.
+func (q *FifoQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,184 @@
+package boltstore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/queueconformance"
+	"github.com/slackmgr/types"
+)
+
+// openTestStore opens a store in a temporary directory, which is closed when the test ends.
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "store.db")
+	}
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+
+	return store
+}
+
+// receiver receives from the queue until the test ends, and returns the sink channel.
+func receiver(t *testing.T, queue *FifoQueue) <-chan *hostkit.FifoQueueMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sinkCh := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.ReceiveWithHeaders(ctx, sinkCh) }()
+
+	t.Cleanup(func() {
+		cancel()
+		<-errCh
+	})
+
+	return sinkCh
+}
+
+// expectMessage waits for the next message, and fails the test if it doesn't have the body.
+func expectMessage(t *testing.T, sinkCh <-chan *hostkit.FifoQueueMessage, body string) *hostkit.FifoQueueMessage {
+	t.Helper()
+
+	select {
+	case msg := <-sinkCh:
+		if msg.Item.Body != body {
+			t.Fatalf("got body %q, want %q", msg.Item.Body, body)
+		}
+
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got no message, want %q", body)
+	}
+
+	return nil
+}
+
+// expectNoMessage fails the test if a message arrives within the wait time.
+func expectNoMessage(t *testing.T, sinkCh <-chan *hostkit.FifoQueueMessage, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case msg := <-sinkCh:
+		t.Fatalf("got unexpected message %q", msg.Item.Body)
+	case <-time.After(wait):
+	}
+}
+
+func send(t *testing.T, queue *FifoQueue, bodies ...string) {
+	t.Helper()
+
+	for _, body := range bodies {
+		if err := queue.Send(context.Background(), "C1", body, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFifoQueueConformance(t *testing.T) {
+	store := openTestStore(t, "")
+
+	var queues atomic.Int64
+
+	factory := func(context.Context) (hostkit.FifoQueue, error) {
+		return store.Queue(fmt.Sprintf("conformance%d", queues.Add(1)), WithNackDelay(100*time.Millisecond)), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, result := range queueconformance.Run(ctx, factory, queueconformance.Options{RedeliveryTimeout: 2 * time.Second}) {
+		if result.Err != nil {
+			t.Errorf("%s: %s", result.Check, result.Err)
+		}
+	}
+}
+
+func TestFifoQueueVisibilityTimeout(t *testing.T) {
+	queue := openTestStore(t, "").Queue("alerts", WithVisibilityTimeout(200*time.Millisecond))
+	sinkCh := receiver(t, queue)
+
+	send(t, queue, "a", "b")
+
+	first := expectMessage(t, sinkCh, "a")
+	expectMessage(t, sinkCh, "b").Item.Ack()
+
+	// The first item is neither acked nor nacked, so it is delivered again after the visibility timeout.
+	again := expectMessage(t, sinkCh, "a")
+
+	if again.Item.MessageID != first.Item.MessageID {
+		t.Errorf("got message ID %s for the redelivery, want %s", again.Item.MessageID, first.Item.MessageID)
+	}
+
+	// A late ack of the first delivery still removes the item.
+	first.Item.Ack()
+
+	expectNoMessage(t, sinkCh, 500*time.Millisecond)
+}
+
+func TestFifoQueueNackKeepsOrder(t *testing.T) {
+	queue := openTestStore(t, "").Queue("alerts", WithNackDelay(50*time.Millisecond))
+	sinkCh := receiver(t, queue)
+
+	send(t, queue, "a", "b", "c")
+
+	a := expectMessage(t, sinkCh, "a")
+	expectMessage(t, sinkCh, "b").Item.Ack()
+
+	a.Item.Nack()
+
+	// The nacked item is before the cursor, so it is delivered again before the items sent after it.
+	time.Sleep(200 * time.Millisecond)
+	send(t, queue, "d")
+
+	expectMessage(t, sinkCh, "c").Item.Ack()
+	expectMessage(t, sinkCh, "a").Item.Ack()
+	expectMessage(t, sinkCh, "d").Item.Ack()
+}
+
+func TestFifoQueueRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+	headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	store := openTestStore(t, path)
+	queue := store.Queue("alerts")
+
+	if err := queue.SendWithHeaders(context.Background(), "C1", "a", "a", headers); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sinkCh := make(chan *types.FifoQueueItem)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.Receive(ctx, sinkCh) }()
+
+	// The item is received but never acked before the store is closed.
+	<-sinkCh
+	cancel()
+	<-errCh
+
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := expectMessage(t, receiver(t, openTestStore(t, path).Queue("alerts")), "a")
+
+	if !maps.Equal(msg.Headers, headers) {
+		t.Errorf("got headers %v, want %v", msg.Headers, headers)
+	}
+}
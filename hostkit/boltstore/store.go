@@ -0,0 +1,46 @@
+// Package boltstore implements types.DB and a FIFO queue on top of a single bbolt file.
+//
+// It is meant for small deployments that want a single binary, without Postgres, DynamoDB, Redis or SQS.
+// Everything is stored in one file, so issues and queued messages survive restarts. The file is locked while open,
+// so only one process can use it at a time.
+package boltstore
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is how long Open waits for the file lock, e.g. when another instance is still shutting down.
+const openTimeout = 10 * time.Second
+
+// Store is an open bbolt file, holding the database and any number of queues.
+type Store struct {
+	bolt *bolt.DB
+}
+
+// Open opens the store file, creating it if it doesn't exist.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store file %s: %w", path, err)
+	}
+
+	return &Store{bolt: db}, nil
+}
+
+// Close closes the store file. Any queues or databases created from the store can't be used after this.
+func (s *Store) Close() error {
+	return s.bolt.Close()
+}
+
+// DB returns the types.DB implementation for this store.
+func (s *Store) DB() *DB {
+	return &DB{bolt: s.bolt}
+}
+
+// Queue returns the FIFO queue with the given name. The name must be unique within the store.
+func (s *Store) Queue(name string, opts ...QueueOption) *FifoQueue {
+	return newFifoQueue(s.bolt, name, opts...)
+}
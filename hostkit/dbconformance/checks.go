@@ -0,0 +1,585 @@
+package dbconformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+// concurrency is the number of goroutines used by the concurrency checks.
+const concurrency = 10
+
+func checkAlerts(ctx context.Context, db types.DB) error {
+	alert := newAlert(channelA, correlationID("alert"))
+
+	if err := db.SaveAlert(ctx, alert); err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+
+	// Alerts are saved again when they are reprocessed, so saving must be idempotent.
+	if err := db.SaveAlert(ctx, alert); err != nil {
+		return fmt.Errorf("failed to save the same alert again: %w", err)
+	}
+
+	if err := db.SaveAlert(ctx, newAlert(channelA, alert.CorrelationID)); err != nil {
+		return fmt.Errorf("failed to save a second alert with the same correlation ID: %w", err)
+	}
+
+	return nil
+}
+
+func checkRequiredArguments(ctx context.Context, db types.DB) error {
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"SaveAlert(nil)", func() error { return db.SaveAlert(ctx, nil) }},
+		{"SaveIssue(nil)", func() error { return db.SaveIssue(ctx, nil) }},
+		{"SaveMoveMapping(nil)", func() error { return db.SaveMoveMapping(ctx, nil) }},
+		{"SaveChannelProcessingState(nil)", func() error { return db.SaveChannelProcessingState(ctx, nil) }},
+		{"MoveIssue to the same channel", func() error { return db.MoveIssue(ctx, newIssue(channelA, "x"), channelA, channelA) }},
+		{"FindOpenIssueByCorrelationID without channel", func() error {
+			_, _, err := db.FindOpenIssueByCorrelationID(ctx, "", "x")
+			return err
+		}},
+		{"FindOpenIssueByCorrelationID without correlation ID", func() error {
+			_, _, err := db.FindOpenIssueByCorrelationID(ctx, channelA, "")
+			return err
+		}},
+		{"FindIssueBySlackPostID without channel", func() error {
+			_, _, err := db.FindIssueBySlackPostID(ctx, "", "1234.5678")
+			return err
+		}},
+		{"FindIssueBySlackPostID without post ID", func() error {
+			_, _, err := db.FindIssueBySlackPostID(ctx, channelA, "")
+			return err
+		}},
+		{"FindMoveMapping without channel", func() error {
+			_, err := db.FindMoveMapping(ctx, "", "x")
+			return err
+		}},
+		{"FindMoveMapping without correlation ID", func() error {
+			_, err := db.FindMoveMapping(ctx, channelA, "")
+			return err
+		}},
+	}
+
+	for _, c := range calls {
+		if err := c.call(); err == nil {
+			return fmt.Errorf("%s: expected an error", c.name)
+		}
+	}
+
+	return nil
+}
+
+func checkNotFound(ctx context.Context, db types.DB) error {
+	id, body, err := db.FindOpenIssueByCorrelationID(ctx, channelA, correlationID("missing"))
+	if err != nil || id != "" || body != nil {
+		return fmt.Errorf("FindOpenIssueByCorrelationID: got (%q, %s, %v), want nothing", id, body, err)
+	}
+
+	id, body, err = db.FindIssueBySlackPostID(ctx, channelA, "0000.0000")
+	if err != nil || id != "" || body != nil {
+		return fmt.Errorf("FindIssueBySlackPostID: got (%q, %s, %v), want nothing", id, body, err)
+	}
+
+	body, err = db.FindMoveMapping(ctx, channelA, correlationID("missing"))
+	if err != nil || body != nil {
+		return fmt.Errorf("FindMoveMapping: got (%s, %v), want nothing", body, err)
+	}
+
+	state, err := db.FindChannelProcessingState(ctx, channelA)
+	if err != nil || state != nil {
+		return fmt.Errorf("FindChannelProcessingState: got (%v, %v), want nothing", state, err)
+	}
+
+	issues, err := db.LoadOpenIssuesInChannel(ctx, channelA)
+	if err != nil || len(issues) != 0 {
+		return fmt.Errorf("LoadOpenIssuesInChannel: got (%d issues, %v), want none", len(issues), err)
+	}
+
+	return expectActiveChannels(ctx, db)
+}
+
+func checkIssueCRUD(ctx context.Context, db types.DB) error {
+	want := newIssue(channelA, correlationID("crud"))
+	want.PostID = "1111.0001"
+
+	if err := db.SaveIssue(ctx, want); err != nil {
+		return fmt.Errorf("failed to save issue: %w", err)
+	}
+
+	if err := expectOpenIssue(ctx, db, want); err != nil {
+		return err
+	}
+
+	if err := expectIssueByPostID(ctx, db, want); err != nil {
+		return err
+	}
+
+	if err := expectActiveChannels(ctx, db, channelA); err != nil {
+		return err
+	}
+
+	// The Slack post ID changes when the post is replaced.
+	oldPostID := want.PostID
+	want.PostID = "1111.0002"
+	want.Version++
+
+	if err := db.SaveIssue(ctx, want); err != nil {
+		return fmt.Errorf("failed to update issue: %w", err)
+	}
+
+	if err := expectIssueByPostID(ctx, db, want); err != nil {
+		return err
+	}
+
+	if id, _, err := db.FindIssueBySlackPostID(ctx, channelA, oldPostID); err != nil || id != "" {
+		return fmt.Errorf("FindIssueBySlackPostID with the old post ID: got (%q, %v), want nothing", id, err)
+	}
+
+	// Archived issues are no longer open, but can still be found by their post.
+	want.Open = false
+	want.Version++
+
+	if err := db.SaveIssue(ctx, want); err != nil {
+		return fmt.Errorf("failed to archive issue: %w", err)
+	}
+
+	if id, _, err := db.FindOpenIssueByCorrelationID(ctx, channelA, want.CorrelationID); err != nil || id != "" {
+		return fmt.Errorf("FindOpenIssueByCorrelationID after archiving: got (%q, %v), want nothing", id, err)
+	}
+
+	if err := expectIssueByPostID(ctx, db, want); err != nil {
+		return err
+	}
+
+	if err := expectOpenIssues(ctx, db, channelA); err != nil {
+		return err
+	}
+
+	return expectActiveChannels(ctx, db)
+}
+
+func checkIssueBodyRoundtrip(ctx context.Context, db types.DB) error {
+	// Correlation IDs are client defined, and may contain any characters.
+	want := newIssue(channelA, correlationID(`a/b c?d=e&f#g%h\i"j'k:l|m<n>o æøå 🔥`))
+	want.PostID = "2222.0001"
+
+	if err := db.SaveIssue(ctx, want); err != nil {
+		return fmt.Errorf("failed to save issue: %w", err)
+	}
+
+	if err := expectOpenIssue(ctx, db, want); err != nil {
+		return err
+	}
+
+	return expectOpenIssues(ctx, db, channelA, want)
+}
+
+func checkSaveIssuesBatch(ctx context.Context, db types.DB) error {
+	if err := db.SaveIssues(ctx); err != nil {
+		return fmt.Errorf("SaveIssues without issues: %w", err)
+	}
+
+	var issuesA, issuesB []*issue
+	var all []types.Issue
+
+	for i := range 30 {
+		a := newIssue(channelA, correlationID(fmt.Sprintf("batch-a-%d", i)))
+		b := newIssue(channelB, correlationID(fmt.Sprintf("batch-b-%d", i)))
+
+		// Closed issues in a third channel, which must not make it active.
+		c := newIssue(channelC, correlationID(fmt.Sprintf("batch-c-%d", i)))
+		c.Open = false
+
+		issuesA = append(issuesA, a)
+		issuesB = append(issuesB, b)
+		all = append(all, a, b, c)
+	}
+
+	if err := db.SaveIssues(ctx, all...); err != nil {
+		return fmt.Errorf("failed to save issues: %w", err)
+	}
+
+	if err := expectOpenIssues(ctx, db, channelA, issuesA...); err != nil {
+		return err
+	}
+
+	if err := expectOpenIssues(ctx, db, channelB, issuesB...); err != nil {
+		return err
+	}
+
+	if err := expectOpenIssues(ctx, db, channelC); err != nil {
+		return err
+	}
+
+	return expectActiveChannels(ctx, db, channelA, channelB)
+}
+
+func checkReopenedCorrelationID(ctx context.Context, db types.DB) error {
+	corr := correlationID("reopened")
+
+	archived := newIssue(channelA, corr)
+	archived.Open = false
+
+	if err := db.SaveIssue(ctx, archived); err != nil {
+		return fmt.Errorf("failed to save archived issue: %w", err)
+	}
+
+	// A new alert with the same correlation ID creates a new issue, once the old one is archived.
+	open := newIssue(channelA, corr)
+
+	if err := db.SaveIssue(ctx, open); err != nil {
+		return fmt.Errorf("failed to save new issue: %w", err)
+	}
+
+	if err := expectOpenIssue(ctx, db, open); err != nil {
+		return err
+	}
+
+	return expectOpenIssues(ctx, db, channelA, open)
+}
+
+func checkMoveIssue(ctx context.Context, db types.DB) error {
+	want := newIssue(channelA, correlationID("move"))
+	want.PostID = "3333.0001"
+
+	if err := db.SaveIssue(ctx, want); err != nil {
+		return fmt.Errorf("failed to save issue: %w", err)
+	}
+
+	// The manager updates the issue with the target channel and the new post before moving it.
+	want.Channel = channelB
+	want.PostID = "3333.0002"
+	want.Version++
+
+	if err := db.MoveIssue(ctx, want, channelA, channelB); err != nil {
+		return fmt.Errorf("failed to move issue: %w", err)
+	}
+
+	if id, _, err := db.FindOpenIssueByCorrelationID(ctx, channelA, want.CorrelationID); err != nil || id != "" {
+		return fmt.Errorf("FindOpenIssueByCorrelationID in the source channel: got (%q, %v), want nothing", id, err)
+	}
+
+	if err := expectOpenIssue(ctx, db, want); err != nil {
+		return err
+	}
+
+	if err := expectIssueByPostID(ctx, db, want); err != nil {
+		return err
+	}
+
+	if err := expectOpenIssues(ctx, db, channelA); err != nil {
+		return err
+	}
+
+	if err := expectOpenIssues(ctx, db, channelB, want); err != nil {
+		return err
+	}
+
+	return expectActiveChannels(ctx, db, channelB)
+}
+
+func checkMoveMappings(ctx context.Context, db types.DB) error {
+	mapping := &moveMapping{CorrelationID: correlationID("mapping"), OriginalChannel: channelA, TargetChannel: channelB}
+
+	if err := db.SaveMoveMapping(ctx, mapping); err != nil {
+		return fmt.Errorf("failed to save move mapping: %w", err)
+	}
+
+	if err := expectMoveMapping(ctx, db, mapping); err != nil {
+		return err
+	}
+
+	mapping.TargetChannel = channelC
+
+	if err := db.SaveMoveMapping(ctx, mapping); err != nil {
+		return fmt.Errorf("failed to update move mapping: %w", err)
+	}
+
+	if err := expectMoveMapping(ctx, db, mapping); err != nil {
+		return err
+	}
+
+	// Mappings are per channel.
+	if body, err := db.FindMoveMapping(ctx, channelB, mapping.CorrelationID); err != nil || body != nil {
+		return fmt.Errorf("FindMoveMapping in another channel: got (%s, %v), want nothing", body, err)
+	}
+
+	if err := db.DeleteMoveMapping(ctx, channelA, mapping.CorrelationID); err != nil {
+		return fmt.Errorf("failed to delete move mapping: %w", err)
+	}
+
+	if body, err := db.FindMoveMapping(ctx, channelA, mapping.CorrelationID); err != nil || body != nil {
+		return fmt.Errorf("FindMoveMapping after delete: got (%s, %v), want nothing", body, err)
+	}
+
+	if err := db.DeleteMoveMapping(ctx, channelA, mapping.CorrelationID); err != nil {
+		return fmt.Errorf("deleting a missing move mapping: %w", err)
+	}
+
+	return nil
+}
+
+func checkChannelProcessingState(ctx context.Context, db types.DB) error {
+	// Postgres stores timestamps with microsecond precision.
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	state := types.NewChannelProcessingState(channelA)
+	state.Created = now.Add(-time.Hour)
+	state.LastProcessed = now
+
+	if err := db.SaveChannelProcessingState(ctx, state); err != nil {
+		return fmt.Errorf("failed to save channel processing state: %w", err)
+	}
+
+	if err := expectChannelProcessingState(ctx, db, state); err != nil {
+		return err
+	}
+
+	state.LastProcessed = now.Add(time.Minute)
+
+	if err := db.SaveChannelProcessingState(ctx, state); err != nil {
+		return fmt.Errorf("failed to update channel processing state: %w", err)
+	}
+
+	if err := expectChannelProcessingState(ctx, db, state); err != nil {
+		return err
+	}
+
+	// States are per channel.
+	if other, err := db.FindChannelProcessingState(ctx, channelB); err != nil || other != nil {
+		return fmt.Errorf("FindChannelProcessingState for another channel: got (%v, %v), want nothing", other, err)
+	}
+
+	return nil
+}
+
+func checkLastWriteWins(ctx context.Context, db types.DB) error {
+	want := newIssue(channelA, correlationID("ordering"))
+
+	for version := 1; version <= 20; version++ {
+		want.Version = version
+
+		if err := db.SaveIssue(ctx, want); err != nil {
+			return fmt.Errorf("failed to save issue version %d: %w", version, err)
+		}
+	}
+
+	return expectOpenIssue(ctx, db, want)
+}
+
+func checkConcurrentIssueSaves(ctx context.Context, db types.DB) error {
+	const perWorker = 20
+
+	issues := make([][]*issue, concurrency)
+
+	err := runConcurrently(func(worker int) error {
+		for i := range perWorker {
+			issue := newIssue(channelA, correlationID(fmt.Sprintf("concurrent-%d-%d", worker, i)))
+
+			if err := db.SaveIssue(ctx, issue); err != nil {
+				return fmt.Errorf("failed to save issue: %w", err)
+			}
+
+			issues[worker] = append(issues[worker], issue)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return expectOpenIssues(ctx, db, channelA, slices.Concat(issues...)...)
+}
+
+func checkConcurrentIssueUpdates(ctx context.Context, db types.DB) error {
+	base := newIssue(channelA, correlationID("concurrent-update"))
+
+	if err := db.SaveIssue(ctx, base); err != nil {
+		return fmt.Errorf("failed to save issue: %w", err)
+	}
+
+	err := runConcurrently(func(worker int) error {
+		update := *base
+		update.Version = worker + 2
+
+		return db.SaveIssue(ctx, &update)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Any one of the updates may win, but there must still be exactly one issue.
+	id, body, err := db.FindOpenIssueByCorrelationID(ctx, channelA, base.CorrelationID)
+	if err != nil {
+		return fmt.Errorf("FindOpenIssueByCorrelationID: %w", err)
+	}
+
+	got := &issue{}
+
+	if err := json.Unmarshal(body, got); err != nil || id != base.ID {
+		return fmt.Errorf("FindOpenIssueByCorrelationID: got (%q, %s), want issue %q", id, body, base.ID)
+	}
+
+	if got.Version < 2 || got.Version > concurrency+1 {
+		return fmt.Errorf("got issue version %d, want one of the concurrent updates", got.Version)
+	}
+
+	issues, err := db.LoadOpenIssuesInChannel(ctx, channelA)
+	if err != nil || len(issues) != 1 {
+		return fmt.Errorf("LoadOpenIssuesInChannel: got (%d issues, %v), want 1", len(issues), err)
+	}
+
+	return nil
+}
+
+func checkConcurrentMoveMappings(ctx context.Context, db types.DB) error {
+	return runConcurrently(func(worker int) error {
+		mapping := &moveMapping{
+			CorrelationID:   correlationID(fmt.Sprintf("concurrent-mapping-%d", worker)),
+			OriginalChannel: channelA,
+			TargetChannel:   channelB,
+		}
+
+		if err := db.SaveMoveMapping(ctx, mapping); err != nil {
+			return fmt.Errorf("failed to save move mapping: %w", err)
+		}
+
+		if err := expectMoveMapping(ctx, db, mapping); err != nil {
+			return err
+		}
+
+		return db.DeleteMoveMapping(ctx, channelA, mapping.CorrelationID)
+	})
+}
+
+// runConcurrently runs fn in concurrency goroutines, and returns the errors joined.
+func runConcurrently(fn func(worker int) error) error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, concurrency)
+
+	for worker := range concurrency {
+		wg.Go(func() {
+			errs[worker] = fn(worker)
+		})
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func expectOpenIssue(ctx context.Context, db types.DB, want *issue) error {
+	id, body, err := db.FindOpenIssueByCorrelationID(ctx, want.Channel, want.CorrelationID)
+	if err != nil {
+		return fmt.Errorf("FindOpenIssueByCorrelationID: %w", err)
+	}
+
+	if _, err := decodeIssue(id, body, want); err != nil {
+		return fmt.Errorf("FindOpenIssueByCorrelationID: %w", err)
+	}
+
+	return nil
+}
+
+func expectIssueByPostID(ctx context.Context, db types.DB, want *issue) error {
+	id, body, err := db.FindIssueBySlackPostID(ctx, want.Channel, want.PostID)
+	if err != nil {
+		return fmt.Errorf("FindIssueBySlackPostID: %w", err)
+	}
+
+	if _, err := decodeIssue(id, body, want); err != nil {
+		return fmt.Errorf("FindIssueBySlackPostID: %w", err)
+	}
+
+	return nil
+}
+
+func expectOpenIssues(ctx context.Context, db types.DB, channelID string, want ...*issue) error {
+	issues, err := db.LoadOpenIssuesInChannel(ctx, channelID)
+	if err != nil {
+		return fmt.Errorf("LoadOpenIssuesInChannel: %w", err)
+	}
+
+	if len(issues) != len(want) {
+		return fmt.Errorf("LoadOpenIssuesInChannel(%s): got %d issues, want %d", channelID, len(issues), len(want))
+	}
+
+	for _, w := range want {
+		body, ok := issues[w.ID]
+		if !ok {
+			return fmt.Errorf("LoadOpenIssuesInChannel(%s): issue %s is missing", channelID, w.ID)
+		}
+
+		if _, err := decodeIssue(w.ID, body, w); err != nil {
+			return fmt.Errorf("LoadOpenIssuesInChannel(%s): %w", channelID, err)
+		}
+	}
+
+	return nil
+}
+
+// expectActiveChannels verifies the active channels. The order is not part of the contract.
+func expectActiveChannels(ctx context.Context, db types.DB, want ...string) error {
+	channels, err := db.FindActiveChannels(ctx)
+	if err != nil {
+		return fmt.Errorf("FindActiveChannels: %w", err)
+	}
+
+	slices.Sort(channels)
+	slices.Sort(want)
+
+	if !slices.Equal(channels, want) {
+		return fmt.Errorf("FindActiveChannels: got %v, want %v", channels, want)
+	}
+
+	return nil
+}
+
+func expectMoveMapping(ctx context.Context, db types.DB, want *moveMapping) error {
+	body, err := db.FindMoveMapping(ctx, want.OriginalChannel, want.CorrelationID)
+	if err != nil {
+		return fmt.Errorf("FindMoveMapping: %w", err)
+	}
+
+	got := &moveMapping{}
+
+	if err := json.Unmarshal(body, got); err != nil {
+		return fmt.Errorf("FindMoveMapping: failed to decode body %s: %w", body, err)
+	}
+
+	if *got != *want {
+		return fmt.Errorf("FindMoveMapping: got %+v, want %+v", *got, *want)
+	}
+
+	return nil
+}
+
+// expectChannelProcessingState verifies the fields that all backends store. Postgres doesn't store the other fields.
+func expectChannelProcessingState(ctx context.Context, db types.DB, want *types.ChannelProcessingState) error {
+	got, err := db.FindChannelProcessingState(ctx, want.ChannelID)
+	if err != nil {
+		return fmt.Errorf("FindChannelProcessingState: %w", err)
+	}
+
+	if got == nil {
+		return errors.New("FindChannelProcessingState: state is missing")
+	}
+
+	if got.ChannelID != want.ChannelID || !got.Created.Equal(want.Created) || !got.LastProcessed.Equal(want.LastProcessed) {
+		return fmt.Errorf("FindChannelProcessingState: got %+v, want %+v", *got, *want)
+	}
+
+	return nil
+}
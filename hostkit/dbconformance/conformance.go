@@ -0,0 +1,112 @@
+// Package dbconformance is a conformance suite for types.DB implementations.
+//
+// The checks describe the behaviour that the manager relies on, which all backends must share: issue CRUD,
+// alert storage, move mappings, channel processing state, concurrent writes and write ordering. Behaviour that
+// differs between the backends, and that the manager doesn't rely on, is deliberately not checked. For example,
+// moving an issue that doesn't exist is a no-op in some backends and an insert in others.
+//
+// The suite is a regular package rather than a test helper, so that it can be run against a live backend from a
+// binary, without the Go toolchain.
+package dbconformance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+// Factory returns an empty, initialized database. It is called once before each check.
+type Factory func(ctx context.Context) (types.DB, error)
+
+// Check is a single conformance check. It returns an error describing the first deviation it finds.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, db types.DB) error
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check    string
+	Err      error
+	Duration time.Duration
+}
+
+// Checks returns all conformance checks, in the order they are run.
+func Checks() []Check {
+	return []Check{
+		{Name: "alerts", Run: checkAlerts},
+		{Name: "required-arguments", Run: checkRequiredArguments},
+		{Name: "not-found", Run: checkNotFound},
+		{Name: "issue-crud", Run: checkIssueCRUD},
+		{Name: "issue-body-roundtrip", Run: checkIssueBodyRoundtrip},
+		{Name: "save-issues-batch", Run: checkSaveIssuesBatch},
+		{Name: "reopened-correlation-id", Run: checkReopenedCorrelationID},
+		{Name: "move-issue", Run: checkMoveIssue},
+		{Name: "move-mappings", Run: checkMoveMappings},
+		{Name: "channel-processing-state", Run: checkChannelProcessingState},
+		{Name: "ordering-last-write-wins", Run: checkLastWriteWins},
+		{Name: "concurrent-issue-saves", Run: checkConcurrentIssueSaves},
+		{Name: "concurrent-issue-updates", Run: checkConcurrentIssueUpdates},
+		{Name: "concurrent-move-mappings", Run: checkConcurrentMoveMappings},
+	}
+}
+
+// Run runs all checks, each against a database from the factory, and returns a result per check.
+// It stops early if the context is canceled.
+func Run(ctx context.Context, factory Factory) []Result {
+	results := []Result{}
+
+	for _, check := range Checks() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := time.Now()
+		err := runCheck(ctx, factory, check)
+
+		results = append(results, Result{Check: check.Name, Err: err, Duration: time.Since(start)})
+	}
+
+	return results
+}
+
+// Failed returns the number of failed checks in the results.
+func Failed(results []Result) int {
+	failed := 0
+
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// ResetFactory returns a factory that drops all data in the database and initializes it again before each check.
+// It is meant for backends with a single shared instance, such as Postgres or DynamoDB.
+// Never use it with a database that holds data you want to keep!
+func ResetFactory(db types.DB) Factory {
+	return func(ctx context.Context) (types.DB, error) {
+		if err := db.DropAllData(ctx); err != nil {
+			return nil, fmt.Errorf("failed to drop all data: %w", err)
+		}
+
+		if err := db.Init(ctx, false); err != nil {
+			return nil, fmt.Errorf("failed to initialize database: %w", err)
+		}
+
+		return db, nil
+	}
+}
+
+func runCheck(ctx context.Context, factory Factory, check Check) error {
+	db, err := factory(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	return check.Run(ctx, db)
+}
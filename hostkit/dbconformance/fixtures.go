@@ -0,0 +1,102 @@
+package dbconformance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/slackmgr/types"
+)
+
+const (
+	channelA = "C0CONFORMA"
+	channelB = "C0CONFORMB"
+	channelC = "C0CONFORMC"
+)
+
+// issue is a minimal types.Issue. The manager treats the body as opaque, so any JSON body will do.
+type issue struct {
+	ID            string `json:"id"`
+	Channel       string `json:"channelId"`
+	CorrelationID string `json:"correlationId"`
+	Open          bool   `json:"open"`
+	PostID        string `json:"postId"`
+	Version       int    `json:"version"`
+}
+
+func newIssue(channelID, correlationID string) *issue {
+	return &issue{
+		ID:            uuid.NewString(),
+		Channel:       channelID,
+		CorrelationID: correlationID,
+		Open:          true,
+		Version:       1,
+	}
+}
+
+func (i *issue) ChannelID() string        { return i.Channel }
+func (i *issue) UniqueID() string         { return i.ID }
+func (i *issue) GetCorrelationID() string { return i.CorrelationID }
+func (i *issue) IsOpen() bool             { return i.Open }
+func (i *issue) CurrentPostID() string    { return i.PostID }
+
+func (i *issue) MarshalJSON() ([]byte, error) {
+	type alias issue
+	return json.Marshal((*alias)(i))
+}
+
+// moveMapping is a minimal types.MoveMapping.
+type moveMapping struct {
+	CorrelationID   string `json:"correlationId"`
+	OriginalChannel string `json:"originalChannelId"`
+	TargetChannel   string `json:"targetChannelId"`
+}
+
+func (m *moveMapping) ChannelID() string        { return m.OriginalChannel }
+func (m *moveMapping) GetCorrelationID() string { return m.CorrelationID }
+
+func (m *moveMapping) UniqueID() string {
+	return base64.URLEncoding.EncodeToString([]byte(m.OriginalChannel + "/" + m.CorrelationID))
+}
+
+func (m *moveMapping) MarshalJSON() ([]byte, error) {
+	type alias moveMapping
+	return json.Marshal((*alias)(m))
+}
+
+func newAlert(channelID, correlationID string) *types.Alert {
+	alert := types.NewErrorAlert()
+	alert.SlackChannelID = channelID
+	alert.CorrelationID = correlationID
+	alert.Header = "Conformance check"
+	alert.Text = "Alert saved by the database conformance suite"
+	alert.Timestamp = time.Now()
+
+	return alert
+}
+
+// correlationID returns a correlation ID that is unique to one check run.
+func correlationID(name string) string {
+	return name + "-" + uuid.NewString()
+}
+
+// decodeIssue decodes an issue body, and verifies that it belongs to the expected issue.
+func decodeIssue(id string, body json.RawMessage, want *issue) (*issue, error) {
+	if id != want.ID {
+		return nil, fmt.Errorf("got issue ID %q, want %q", id, want.ID)
+	}
+
+	got := &issue{}
+
+	if err := json.Unmarshal(body, got); err != nil {
+		return nil, fmt.Errorf("failed to decode issue body %s: %w", body, err)
+	}
+
+	if *got != *want {
+		return nil, fmt.Errorf("got issue %+v, want %+v", *got, *want)
+	}
+
+	return got, nil
+}
@@ -0,0 +1,28 @@
+package hostkit
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ExitMain handles the application exit logic based on the provided error.
+// It exits with code 0 if the error is nil or a context cancellation, and with code 1 otherwise.
+func ExitMain(err error) {
+	var returnCode int
+
+	switch {
+	case err == nil:
+		returnCode = 0
+	case errors.Is(err, context.Canceled):
+		returnCode = 0
+		log.Info().Msgf("Application canceled: %s", err)
+	default:
+		returnCode = 1
+		log.Error().Msgf("Application failed: %s", err)
+	}
+
+	os.Exit(returnCode)
+}
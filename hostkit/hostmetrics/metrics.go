@@ -0,0 +1,403 @@
+// Package hostmetrics implements the types.Metrics interface for Prometheus, OpenTelemetry (OTLP) and StatsD.
+//
+// It is a separate package from hostkit, so that hosts that only need the logger, such as the minimal example,
+// don't link the metrics client libraries.
+package hostmetrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	common "github.com/slackmgr/types"
+)
+
+const (
+	// metricsErrorsMetric counts metric calls that were dropped or changed, by metric name and reason.
+	metricsErrorsMetric = "slackmgr_metrics_errors_total"
+
+	// overflowLabelValue replaces all label values when a metric reaches its label combination cap.
+	overflowLabelValue = "__overflow__"
+)
+
+// Reasons used in the metrics error metric.
+const (
+	metricsErrorRegisterFailed = "register_failed"
+	metricsErrorUnregistered   = "unregistered"
+	metricsErrorLabelMismatch  = "label_mismatch"
+	metricsErrorInvalidLabels  = "invalid_labels"
+	metricsErrorOverflow       = "overflow"
+	metricsErrorNegative       = "negative_counter"
+)
+
+// PrometheusMetrics implements the Metrics interface using the Prometheus client library.
+// Each instance has its own registry, so the metrics are not mixed with anything registered globally.
+//
+// Invalid calls never panic. Registration failures, calls for unregistered metrics and calls with the wrong
+// number of label values are dropped, and counted in the slackmgr_metrics_errors_total metric.
+// If MaxLabelCombinations is set, new label combinations beyond the cap are recorded in a single
+// series where all label values are "__overflow__".
+type PrometheusMetrics struct {
+	// A mutex is used to protect the maps from concurrent access.
+	mu sync.RWMutex
+
+	registry    *prometheus.Registry
+	constLabels prometheus.Labels
+	maxSeries   int
+	errors      *prometheus.CounterVec
+
+	counters   map[string]*prometheusVec[*prometheus.CounterVec]
+	gauges     map[string]*prometheusVec[*prometheus.GaugeVec]
+	histograms map[string]*prometheusVec[*prometheus.HistogramVec]
+}
+
+// PrometheusMetricsOptions contains the options for a PrometheusMetrics instance.
+type PrometheusMetricsOptions struct {
+	// ConstLabels are added to all metrics, e.g. service, role and instance. Labels with empty values are ignored.
+	ConstLabels map[string]string
+
+	// RuntimeCollectors registers the Go runtime and process collectors.
+	RuntimeCollectors bool
+
+	// MaxLabelCombinations is the maximum number of distinct label combinations per metric. Zero means no limit.
+	MaxLabelCombinations int
+}
+
+// prometheusVec is a registered metric vector, with the label combinations seen so far.
+type prometheusVec[T any] struct {
+	vec        T
+	labelCount int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// NewPrometheusMetrics creates and returns a new PrometheusMetrics instance, with its own registry.
+func NewPrometheusMetrics(opts PrometheusMetricsOptions) *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		registry:    prometheus.NewRegistry(),
+		constLabels: prometheus.Labels{},
+		maxSeries:   opts.MaxLabelCombinations,
+		counters:    make(map[string]*prometheusVec[*prometheus.CounterVec]),
+		gauges:      make(map[string]*prometheusVec[*prometheus.GaugeVec]),
+		histograms:  make(map[string]*prometheusVec[*prometheus.HistogramVec]),
+	}
+
+	for name, value := range opts.ConstLabels {
+		if value != "" {
+			m.constLabels[name] = value
+		}
+	}
+
+	m.errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        metricsErrorsMetric,
+		Help:        "Total metric calls that were dropped or changed, by metric name and reason",
+		ConstLabels: m.constLabels,
+	}, []string{"metric", "reason"})
+
+	m.registry.MustRegister(m.errors)
+
+	if opts.RuntimeCollectors {
+		m.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+
+	return m
+}
+
+// Registry returns the registry containing all metrics of this instance.
+func (m *PrometheusMetrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns an HTTP handler serving the metrics in the instance registry.
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *PrometheusMetrics) RegisterCounter(name, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the counter is already registered, do nothing.
+	if _, ok := m.counters[name]; ok {
+		return
+	}
+
+	// Create and register the new counter vector in the instance registry.
+	counterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        name,
+		Help:        help,
+		ConstLabels: m.constLabels,
+	}, labels)
+
+	if m.register(name, counterVec) {
+		m.counters[name] = newPrometheusVec(counterVec, len(labels))
+	}
+}
+
+func (m *PrometheusMetrics) RegisterGauge(name, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the gauge is already registered, do nothing.
+	if _, ok := m.gauges[name]; ok {
+		return
+	}
+
+	// Create and register the new gauge vector.
+	gaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        name,
+		Help:        help,
+		ConstLabels: m.constLabels,
+	}, labels)
+
+	if m.register(name, gaugeVec) {
+		m.gauges[name] = newPrometheusVec(gaugeVec, len(labels))
+	}
+}
+
+func (m *PrometheusMetrics) RegisterHistogram(name, help string, buckets []float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the histogram is already registered, do nothing.
+	if _, ok := m.histograms[name]; ok {
+		return
+	}
+
+	// Create and register the new histogram vector.
+	histogramVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        name,
+		Help:        help,
+		Buckets:     buckets,
+		ConstLabels: m.constLabels,
+	}, labels)
+
+	if m.register(name, histogramVec) {
+		m.histograms[name] = newPrometheusVec(histogramVec, len(labels))
+	}
+}
+
+func (m *PrometheusMetrics) CounterAdd(name string, value float64, labelValues ...string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counterVec, ok := m.counters[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return
+	}
+
+	// Counters can only go up, and the Prometheus client panics on a negative value.
+	if value < 0 {
+		m.countError(name, metricsErrorNegative)
+		return
+	}
+
+	labelValues, ok = resolveLabelValues(m, name, counterVec, labelValues)
+	if !ok {
+		return
+	}
+
+	// Get the specific counter for the given labels and add the value.
+	// This is safe for concurrent use.
+	counter, err := counterVec.vec.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		m.countError(name, metricsErrorInvalidLabels)
+		return
+	}
+
+	counter.Add(value)
+}
+
+func (m *PrometheusMetrics) CounterInc(name string, labelValues ...string) {
+	m.CounterAdd(name, 1, labelValues...)
+}
+
+func (m *PrometheusMetrics) GaugeSet(name string, value float64, labelValues ...string) {
+	if gauge, ok := m.gauge(name, labelValues); ok {
+		gauge.Set(value)
+	}
+}
+
+func (m *PrometheusMetrics) GaugeAdd(name string, value float64, labelValues ...string) {
+	if gauge, ok := m.gauge(name, labelValues); ok {
+		gauge.Add(value)
+	}
+}
+
+func (m *PrometheusMetrics) Observe(name string, value float64, labelValues ...string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	histogramVec, ok := m.histograms[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return
+	}
+
+	labelValues, ok = resolveLabelValues(m, name, histogramVec, labelValues)
+	if !ok {
+		return
+	}
+
+	// Get the specific histogram for the given labels and observe the value.
+	// This is safe for concurrent use.
+	histogram, err := histogramVec.vec.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		m.countError(name, metricsErrorInvalidLabels)
+		return
+	}
+
+	histogram.Observe(value)
+}
+
+// gauge returns the gauge for the given name and label values, or false if the call must be dropped.
+func (m *PrometheusMetrics) gauge(name string, labelValues []string) (prometheus.Gauge, bool) { //nolint:ireturn
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	gaugeVec, ok := m.gauges[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return nil, false
+	}
+
+	labelValues, ok = resolveLabelValues(m, name, gaugeVec, labelValues)
+	if !ok {
+		return nil, false
+	}
+
+	gauge, err := gaugeVec.vec.GetMetricWithLabelValues(labelValues...)
+	if err != nil {
+		m.countError(name, metricsErrorInvalidLabels)
+		return nil, false
+	}
+
+	return gauge, true
+}
+
+// register registers the collector in the instance registry, and returns false if the registration failed
+// (e.g. an invalid name, or a name already used by a metric of another type).
+func (m *PrometheusMetrics) register(name string, collector prometheus.Collector) bool {
+	if err := m.registry.Register(collector); err != nil {
+		m.countError(name, metricsErrorRegisterFailed)
+		return false
+	}
+
+	return true
+}
+
+// resolveLabelValues checks the label values of a call, counting any errors, and returns the label values to use,
+// or false if the call must be dropped.
+func resolveLabelValues[T any](m *PrometheusMetrics, name string, v *prometheusVec[T], labelValues []string) ([]string, bool) {
+	labelValues, reason, ok := v.resolveLabelValues(labelValues, m.maxSeries)
+
+	if reason != "" {
+		m.countError(name, reason)
+	}
+
+	return labelValues, ok
+}
+
+func (m *PrometheusMetrics) countError(name, reason string) {
+	m.errors.WithLabelValues(name, reason).Inc()
+}
+
+// resolveLabelValues checks the number of label values, and applies the label combination cap.
+// It returns the label values to use, the error reason if the call is dropped or changed, and false if the call must be dropped.
+func (v *prometheusVec[T]) resolveLabelValues(labelValues []string, maxSeries int) ([]string, string, bool) {
+	if len(labelValues) != v.labelCount {
+		return nil, metricsErrorLabelMismatch, false
+	}
+
+	if maxSeries <= 0 || v.labelCount == 0 {
+		return labelValues, "", true
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.seen[key]; ok {
+		return labelValues, "", true
+	}
+
+	if len(v.seen) < maxSeries {
+		v.seen[key] = struct{}{}
+		return labelValues, "", true
+	}
+
+	overflow := make([]string, v.labelCount)
+	for i := range overflow {
+		overflow[i] = overflowLabelValue
+	}
+
+	return overflow, metricsErrorOverflow, true
+}
+
+func newPrometheusVec[T any](vec T, labelCount int) *prometheusVec[T] {
+	return &prometheusVec[T]{
+		vec:        vec,
+		labelCount: labelCount,
+		seen:       make(map[string]struct{}),
+	}
+}
+
+// MultiMetrics implements the Metrics interface by forwarding all calls to several Metrics implementations.
+type MultiMetrics []common.Metrics
+
+func (m MultiMetrics) RegisterCounter(name, help string, labels ...string) {
+	for _, metrics := range m {
+		metrics.RegisterCounter(name, help, labels...)
+	}
+}
+
+func (m MultiMetrics) RegisterGauge(name, help string, labels ...string) {
+	for _, metrics := range m {
+		metrics.RegisterGauge(name, help, labels...)
+	}
+}
+
+func (m MultiMetrics) RegisterHistogram(name, help string, buckets []float64, labels ...string) {
+	for _, metrics := range m {
+		metrics.RegisterHistogram(name, help, buckets, labels...)
+	}
+}
+
+func (m MultiMetrics) CounterAdd(name string, value float64, labelValues ...string) {
+	for _, metrics := range m {
+		metrics.CounterAdd(name, value, labelValues...)
+	}
+}
+
+func (m MultiMetrics) CounterInc(name string, labelValues ...string) {
+	for _, metrics := range m {
+		metrics.CounterInc(name, labelValues...)
+	}
+}
+
+func (m MultiMetrics) GaugeSet(name string, value float64, labelValues ...string) {
+	for _, metrics := range m {
+		metrics.GaugeSet(name, value, labelValues...)
+	}
+}
+
+func (m MultiMetrics) GaugeAdd(name string, value float64, labelValues ...string) {
+	for _, metrics := range m {
+		metrics.GaugeAdd(name, value, labelValues...)
+	}
+}
+
+func (m MultiMetrics) Observe(name string, value float64, labelValues ...string) {
+	for _, metrics := range m {
+		metrics.Observe(name, value, labelValues...)
+	}
+}
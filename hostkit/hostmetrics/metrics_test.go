@@ -0,0 +1,254 @@
+package hostmetrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusMetricsOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(m *PrometheusMetrics)
+		metric string
+		want   string
+	}{
+		{
+			name: "counter",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterCounter("alerts_total", "Alerts", "channel")
+				m.CounterInc("alerts_total", "C1")
+				m.CounterAdd("alerts_total", 2, "C1")
+				m.CounterInc("alerts_total", "C2")
+			},
+			metric: "alerts_total",
+			want: `
+# HELP alerts_total Alerts
+# TYPE alerts_total counter
+alerts_total{channel="C1",service="api"} 3
+alerts_total{channel="C2",service="api"} 1
+`,
+		},
+		{
+			name: "gauge",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterGauge("queue_depth", "Depth")
+				m.GaugeSet("queue_depth", 5)
+				m.GaugeAdd("queue_depth", -2)
+			},
+			metric: "queue_depth",
+			want: `
+# HELP queue_depth Depth
+# TYPE queue_depth gauge
+queue_depth{service="api"} 3
+`,
+		},
+		{
+			name: "histogram",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterHistogram("latency_seconds", "Latency", []float64{0.1, 1})
+				m.Observe("latency_seconds", 0.05)
+				m.Observe("latency_seconds", 0.5)
+			},
+			metric: "latency_seconds",
+			want: `
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{service="api",le="0.1"} 1
+latency_seconds_bucket{service="api",le="1"} 2
+latency_seconds_bucket{service="api",le="+Inf"} 2
+latency_seconds_sum{service="api"} 0.55
+latency_seconds_count{service="api"} 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPrometheusMetrics(PrometheusMetricsOptions{ConstLabels: map[string]string{"service": "api", "role": ""}})
+
+			tt.record(m)
+
+			if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(tt.want), tt.metric); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPrometheusMetricsSeparateRegistries(t *testing.T) {
+	first := NewPrometheusMetrics(PrometheusMetricsOptions{})
+	second := NewPrometheusMetrics(PrometheusMetricsOptions{})
+
+	// Registering the same name in two instances would panic with the global registry.
+	first.RegisterCounter("requests_total", "Requests")
+	second.RegisterCounter("requests_total", "Requests")
+
+	first.CounterInc("requests_total")
+
+	if got := testutil.ToFloat64(first.counters["requests_total"].vec); got != 1 {
+		t.Errorf("got %v in the first instance, want 1", got)
+	}
+
+	count, err := testutil.GatherAndCount(second.Registry(), "requests_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Errorf("got %d series in the second instance, want none", count)
+	}
+}
+
+func TestPrometheusMetricsHandler(t *testing.T) {
+	tests := []struct {
+		name              string
+		runtimeCollectors bool
+		wantRuntime       bool
+	}{
+		{name: "without runtime collectors"},
+		{name: "with runtime collectors", runtimeCollectors: true, wantRuntime: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPrometheusMetrics(PrometheusMetricsOptions{RuntimeCollectors: tt.runtimeCollectors})
+
+			m.RegisterCounter("requests_total", "Requests")
+			m.CounterInc("requests_total")
+
+			server := httptest.NewServer(m.Handler())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL) //nolint:noctx
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(body), "requests_total 1") {
+				t.Errorf("output doesn't contain the counter:\n%s", body)
+			}
+
+			if got := strings.Contains(string(body), "go_goroutines"); got != tt.wantRuntime {
+				t.Errorf("got runtime metrics %v, want %v", got, tt.wantRuntime)
+			}
+		})
+	}
+}
+
+func TestPrometheusMetricsInvalidCalls(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(m *PrometheusMetrics)
+		want   string
+	}{
+		{
+			name: "unregistered metric",
+			record: func(m *PrometheusMetrics) {
+				m.CounterInc("missing_total")
+				m.GaugeSet("missing_gauge", 1)
+				m.Observe("missing_seconds", 1)
+			},
+			want: `
+# HELP slackmgr_metrics_errors_total Total metric calls that were dropped or changed, by metric name and reason
+# TYPE slackmgr_metrics_errors_total counter
+slackmgr_metrics_errors_total{metric="missing_gauge",reason="unregistered"} 1
+slackmgr_metrics_errors_total{metric="missing_seconds",reason="unregistered"} 1
+slackmgr_metrics_errors_total{metric="missing_total",reason="unregistered"} 1
+`,
+		},
+		{
+			name: "label count mismatch",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterCounter("alerts_total", "Alerts", "channel")
+				m.CounterInc("alerts_total")
+				m.CounterInc("alerts_total", "C1", "extra")
+				m.RegisterGauge("depth", "Depth", "queue")
+				m.GaugeAdd("depth", 1)
+			},
+			want: `
+# HELP slackmgr_metrics_errors_total Total metric calls that were dropped or changed, by metric name and reason
+# TYPE slackmgr_metrics_errors_total counter
+slackmgr_metrics_errors_total{metric="alerts_total",reason="label_mismatch"} 2
+slackmgr_metrics_errors_total{metric="depth",reason="label_mismatch"} 1
+`,
+		},
+		{
+			name: "negative counter value",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterCounter("alerts_total", "Alerts", "channel")
+				m.CounterAdd("alerts_total", -1, "C1")
+			},
+			want: `
+# HELP slackmgr_metrics_errors_total Total metric calls that were dropped or changed, by metric name and reason
+# TYPE slackmgr_metrics_errors_total counter
+slackmgr_metrics_errors_total{metric="alerts_total",reason="negative_counter"} 1
+`,
+		},
+		{
+			name: "name registered with another type",
+			record: func(m *PrometheusMetrics) {
+				m.RegisterCounter("requests_total", "Requests")
+				m.RegisterGauge("requests_total", "Requests")
+				m.GaugeSet("requests_total", 1)
+			},
+			want: `
+# HELP slackmgr_metrics_errors_total Total metric calls that were dropped or changed, by metric name and reason
+# TYPE slackmgr_metrics_errors_total counter
+slackmgr_metrics_errors_total{metric="requests_total",reason="register_failed"} 1
+slackmgr_metrics_errors_total{metric="requests_total",reason="unregistered"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPrometheusMetrics(PrometheusMetricsOptions{})
+
+			// None of the invalid calls may panic.
+			tt.record(m)
+
+			if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(tt.want), metricsErrorsMetric); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPrometheusMetricsLabelCombinationCap(t *testing.T) {
+	m := NewPrometheusMetrics(PrometheusMetricsOptions{MaxLabelCombinations: 2})
+
+	m.RegisterCounter("alerts_total", "Alerts", "channel", "route")
+
+	m.CounterInc("alerts_total", "C1", "a")
+	m.CounterInc("alerts_total", "C2", "b")
+	m.CounterInc("alerts_total", "C3", "c")
+	m.CounterInc("alerts_total", "C4", "d")
+	m.CounterInc("alerts_total", "C1", "a")
+
+	want := `
+# HELP alerts_total Alerts
+# TYPE alerts_total counter
+alerts_total{channel="C1",route="a"} 2
+alerts_total{channel="C2",route="b"} 1
+alerts_total{channel="__overflow__",route="__overflow__"} 2
+# HELP slackmgr_metrics_errors_total Total metric calls that were dropped or changed, by metric name and reason
+# TYPE slackmgr_metrics_errors_total counter
+slackmgr_metrics_errors_total{metric="alerts_total",reason="overflow"} 2
+`
+
+	if err := testutil.GatherAndCompare(m.Registry(), strings.NewReader(want), "alerts_total", metricsErrorsMetric); err != nil {
+		t.Error(err)
+	}
+}
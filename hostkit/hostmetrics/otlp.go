@@ -0,0 +1,321 @@
+package hostmetrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// otlpMeterName is the instrumentation scope of the metrics, i.e. this package.
+const otlpMeterName = "github.com/slackmgr/examples/hostkit/hostmetrics"
+
+// OTLPMetrics implements the Metrics interface using the OpenTelemetry metrics SDK, exporting over OTLP.
+//
+// The exporter endpoint, headers and TLS settings are read from the standard OTEL_EXPORTER_OTLP_* environment
+// variables. Like PrometheusMetrics, invalid calls never panic, but are dropped and counted in the
+// slackmgr_metrics_errors_total metric. Gauges support both GaugeSet and GaugeAdd, and are reported
+// with an observable gauge holding the current values.
+type OTLPMetrics struct {
+	// A mutex is used to protect the maps from concurrent access.
+	mu sync.RWMutex
+
+	provider *sdkmetric.MeterProvider
+	meter    metric.Meter
+	errors   metric.Float64Counter
+
+	counters   map[string]*otlpInstrument[metric.Float64Counter]
+	gauges     map[string]*otlpGauge
+	histograms map[string]*otlpInstrument[metric.Float64Histogram]
+}
+
+// OTLPMetricsOptions contains the options for an OTLPMetrics instance.
+type OTLPMetricsOptions struct {
+	// Protocol is the OTLP transport, either "grpc" or "http".
+	Protocol string
+
+	// Interval is the time between exports.
+	Interval time.Duration
+
+	// ResourceAttributes are added to the exported resource, e.g. service.name. Attributes with empty values are ignored.
+	ResourceAttributes map[string]string
+
+	// MaxLabelCombinations is the maximum number of distinct label combinations per metric. Zero means no limit.
+	// Further combinations are aggregated by the SDK into a single series with the otel.metric.overflow attribute.
+	MaxLabelCombinations int
+}
+
+// otlpInstrument is a registered synchronous instrument, with its label names.
+type otlpInstrument[T any] struct {
+	instrument T
+	labels     []string
+}
+
+// otlpGauge holds the current values of a gauge, which are reported when the metrics are collected.
+type otlpGauge struct {
+	labels []string
+
+	mu     sync.Mutex
+	values map[attribute.Distinct]*otlpGaugeValue
+}
+
+type otlpGaugeValue struct {
+	attributes attribute.Set
+	value      float64
+}
+
+// NewOTLPMetrics creates and returns a new OTLPMetrics instance, with its own meter provider and exporter.
+// Call Shutdown before exiting, to flush the metrics recorded since the last export.
+func NewOTLPMetrics(ctx context.Context, opts OTLPMetricsOptions) (*OTLPMetrics, error) {
+	var exporter sdkmetric.Exporter
+	var err error
+
+	switch strings.ToLower(opts.Protocol) {
+	case "grpc":
+		exporter, err = otlpmetricgrpc.New(ctx)
+	case "http":
+		exporter, err = otlpmetrichttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol: %s", opts.Protocol)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP metrics exporter: %w", err)
+	}
+
+	res, err := NewOTelResource(opts.ResourceAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	providerOpts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(opts.Interval))),
+	}
+
+	if opts.MaxLabelCombinations > 0 {
+		providerOpts = append(providerOpts, sdkmetric.WithCardinalityLimit(opts.MaxLabelCombinations))
+	}
+
+	m := &OTLPMetrics{
+		provider:   sdkmetric.NewMeterProvider(providerOpts...),
+		counters:   make(map[string]*otlpInstrument[metric.Float64Counter]),
+		gauges:     make(map[string]*otlpGauge),
+		histograms: make(map[string]*otlpInstrument[metric.Float64Histogram]),
+	}
+
+	m.meter = m.provider.Meter(otlpMeterName)
+
+	m.errors, err = m.meter.Float64Counter(metricsErrorsMetric, metric.WithDescription("Total metric calls that were dropped, by metric name and reason"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics error counter: %w", err)
+	}
+
+	return m, nil
+}
+
+// Shutdown exports any remaining metrics, and stops the exporter.
+func (m *OTLPMetrics) Shutdown(ctx context.Context) error {
+	return m.provider.Shutdown(ctx)
+}
+
+func (m *OTLPMetrics) RegisterCounter(name, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the counter is already registered, do nothing.
+	if _, ok := m.counters[name]; ok {
+		return
+	}
+
+	counter, err := m.meter.Float64Counter(name, metric.WithDescription(help))
+	if err != nil {
+		m.countError(name, metricsErrorRegisterFailed)
+		return
+	}
+
+	m.counters[name] = &otlpInstrument[metric.Float64Counter]{instrument: counter, labels: labels}
+}
+
+func (m *OTLPMetrics) RegisterGauge(name, help string, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the gauge is already registered, do nothing.
+	if _, ok := m.gauges[name]; ok {
+		return
+	}
+
+	gauge := &otlpGauge{
+		labels: labels,
+		values: make(map[attribute.Distinct]*otlpGaugeValue),
+	}
+
+	if _, err := m.meter.Float64ObservableGauge(name, metric.WithDescription(help), metric.WithFloat64Callback(gauge.observe)); err != nil {
+		m.countError(name, metricsErrorRegisterFailed)
+		return
+	}
+
+	m.gauges[name] = gauge
+}
+
+func (m *OTLPMetrics) RegisterHistogram(name, help string, buckets []float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the histogram is already registered, do nothing.
+	if _, ok := m.histograms[name]; ok {
+		return
+	}
+
+	// An empty bucket list would make the SDK export the histogram without buckets. Use the Prometheus defaults
+	// instead, like PrometheusMetrics does, so that the same histogram has the same buckets in both backends.
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	histogram, err := m.meter.Float64Histogram(name, metric.WithDescription(help), metric.WithExplicitBucketBoundaries(buckets...))
+	if err != nil {
+		m.countError(name, metricsErrorRegisterFailed)
+		return
+	}
+
+	m.histograms[name] = &otlpInstrument[metric.Float64Histogram]{instrument: histogram, labels: labels}
+}
+
+func (m *OTLPMetrics) CounterAdd(name string, value float64, labelValues ...string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counter, ok := m.counters[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return
+	}
+
+	attributes, ok := m.attributes(name, counter.labels, labelValues)
+	if !ok {
+		return
+	}
+
+	counter.instrument.Add(context.Background(), value, metric.WithAttributeSet(attributes))
+}
+
+func (m *OTLPMetrics) CounterInc(name string, labelValues ...string) {
+	m.CounterAdd(name, 1, labelValues...)
+}
+
+func (m *OTLPMetrics) GaugeSet(name string, value float64, labelValues ...string) {
+	m.updateGauge(name, labelValues, func(float64) float64 { return value })
+}
+
+func (m *OTLPMetrics) GaugeAdd(name string, value float64, labelValues ...string) {
+	m.updateGauge(name, labelValues, func(current float64) float64 { return current + value })
+}
+
+func (m *OTLPMetrics) Observe(name string, value float64, labelValues ...string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	histogram, ok := m.histograms[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return
+	}
+
+	attributes, ok := m.attributes(name, histogram.labels, labelValues)
+	if !ok {
+		return
+	}
+
+	histogram.instrument.Record(context.Background(), value, metric.WithAttributeSet(attributes))
+}
+
+func (m *OTLPMetrics) updateGauge(name string, labelValues []string, update func(current float64) float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	gauge, ok := m.gauges[name]
+	if !ok {
+		m.countError(name, metricsErrorUnregistered)
+		return
+	}
+
+	attributes, ok := m.attributes(name, gauge.labels, labelValues)
+	if !ok {
+		return
+	}
+
+	gauge.mu.Lock()
+	defer gauge.mu.Unlock()
+
+	v, ok := gauge.values[attributes.Equivalent()]
+	if !ok {
+		v = &otlpGaugeValue{attributes: attributes}
+		gauge.values[attributes.Equivalent()] = v
+	}
+
+	v.value = update(v.value)
+}
+
+// attributes converts the label values to an attribute set, or returns false if the label count doesn't match.
+func (m *OTLPMetrics) attributes(name string, labels, labelValues []string) (attribute.Set, bool) {
+	if len(labels) != len(labelValues) {
+		m.countError(name, metricsErrorLabelMismatch)
+		return attribute.Set{}, false
+	}
+
+	kvs := make([]attribute.KeyValue, len(labels))
+
+	for i, label := range labels {
+		kvs[i] = attribute.String(label, labelValues[i])
+	}
+
+	return attribute.NewSet(kvs...), true
+}
+
+func (m *OTLPMetrics) countError(name, reason string) {
+	if m.errors != nil {
+		m.errors.Add(context.Background(), 1, metric.WithAttributes(attribute.String("metric", name), attribute.String("reason", reason)))
+	}
+}
+
+// observe reports the current gauge values. It is called by the SDK when the metrics are collected.
+func (g *otlpGauge) observe(_ context.Context, o metric.Float64Observer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, v := range g.values {
+		o.Observe(v.value, metric.WithAttributeSet(v.attributes))
+	}
+
+	return nil
+}
+
+// NewOTelResource creates an OpenTelemetry resource with the default attributes and the given attributes.
+// Attributes with empty values are ignored.
+func NewOTelResource(attributes map[string]string) (*resource.Resource, error) {
+	kvs := make([]attribute.KeyValue, 0, len(attributes))
+
+	for key, value := range attributes {
+		if value != "" {
+			kvs = append(kvs, attribute.String(key, value))
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(kvs...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenTelemetry resource: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,221 @@
+package hostmetrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiver is an in-process OTLP metrics receiver, for both gRPC and HTTP.
+type otlpReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests []*collectormetrics.ExportMetricsServiceRequest
+}
+
+func (r *otlpReceiver) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests = append(r.requests, req)
+
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var export collectormetrics.ExportMetricsServiceRequest
+
+	if err := proto.Unmarshal(body, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = r.Export(req.Context(), &export)
+
+	resp, _ := proto.Marshal(&collectormetrics.ExportMetricsServiceResponse{})
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(resp)
+}
+
+// metrics returns the last exported data point of each metric, with the instrumentation scope name.
+func (r *otlpReceiver) metrics() (map[string]*metricspb.Metric, map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := make(map[string]*metricspb.Metric)
+	scopes := make(map[string]string)
+
+	for _, req := range r.requests {
+		for _, rm := range req.GetResourceMetrics() {
+			for _, sm := range rm.GetScopeMetrics() {
+				for _, m := range sm.GetMetrics() {
+					metrics[m.GetName()] = m
+					scopes[m.GetName()] = sm.GetScope().GetName()
+				}
+			}
+		}
+	}
+
+	return metrics, scopes
+}
+
+// startOTLPReceiver starts a receiver for the protocol, and points the OTLP metrics exporter at it.
+func startOTLPReceiver(t *testing.T, protocol string) *otlpReceiver {
+	t.Helper()
+
+	receiver := &otlpReceiver{}
+
+	var endpoint string
+
+	switch protocol {
+	case "grpc":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server := grpc.NewServer()
+		collectormetrics.RegisterMetricsServiceServer(server, receiver)
+
+		go func() { _ = server.Serve(listener) }()
+
+		t.Cleanup(server.Stop)
+
+		endpoint = "http://" + listener.Addr().String()
+	case "http":
+		server := httptest.NewServer(receiver)
+		t.Cleanup(server.Close)
+
+		endpoint = server.URL + "/v1/metrics"
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", endpoint)
+
+	return receiver
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	for _, protocol := range []string{"grpc", "http"} {
+		t.Run(protocol, func(t *testing.T) {
+			receiver := startOTLPReceiver(t, protocol)
+
+			m, err := NewOTLPMetrics(context.Background(), OTLPMetricsOptions{
+				Protocol:           protocol,
+				Interval:           time.Hour,
+				ResourceAttributes: map[string]string{"service.name": "slackmgr-test"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m.RegisterCounter("alerts_total", "Alerts", "channel")
+			m.CounterInc("alerts_total", "C1")
+			m.CounterAdd("alerts_total", 2, "C1")
+
+			m.RegisterGauge("queue_depth", "Depth")
+			m.GaugeSet("queue_depth", 5)
+			m.GaugeAdd("queue_depth", -2)
+
+			m.RegisterHistogram("default_seconds", "Default buckets", nil)
+			m.Observe("default_seconds", 0.2)
+
+			m.RegisterHistogram("custom_seconds", "Custom buckets", []float64{0.1, 1})
+			m.Observe("custom_seconds", 0.5)
+
+			// Invalid calls are dropped and counted, rather than panicking.
+			m.CounterInc("alerts_total")
+			m.Observe("missing_seconds", 1)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Shutdown exports the metrics recorded since the last export.
+			if err := m.Shutdown(ctx); err != nil {
+				t.Fatalf("failed to shut down: %s", err)
+			}
+
+			metrics, scopes := receiver.metrics()
+
+			if scope := scopes["alerts_total"]; scope != otlpMeterName {
+				t.Errorf("got scope %q, want %q", scope, otlpMeterName)
+			}
+
+			counter := metrics["alerts_total"].GetSum().GetDataPoints()
+			if len(counter) != 1 || counter[0].GetAsDouble() != 3 {
+				t.Errorf("got counter data points %v, want a single point with 3", counter)
+			}
+
+			gauge := metrics["queue_depth"].GetGauge().GetDataPoints()
+			if len(gauge) != 1 || gauge[0].GetAsDouble() != 3 {
+				t.Errorf("got gauge data points %v, want a single point with 3", gauge)
+			}
+
+			histogramTests := []struct {
+				name        string
+				wantBuckets []float64
+			}{
+				{name: "default_seconds", wantBuckets: prometheus.DefBuckets},
+				{name: "custom_seconds", wantBuckets: []float64{0.1, 1}},
+			}
+
+			for _, ht := range histogramTests {
+				points := metrics[ht.name].GetHistogram().GetDataPoints()
+				if len(points) != 1 {
+					t.Errorf("%s: got %d data points, want 1", ht.name, len(points))
+					continue
+				}
+
+				if !slices.Equal(points[0].GetExplicitBounds(), ht.wantBuckets) {
+					t.Errorf("%s: got buckets %v, want %v", ht.name, points[0].GetExplicitBounds(), ht.wantBuckets)
+				}
+
+				if points[0].GetCount() != 1 {
+					t.Errorf("%s: got count %d, want 1", ht.name, points[0].GetCount())
+				}
+			}
+
+			reasons := map[string]float64{}
+
+			for _, point := range metrics[metricsErrorsMetric].GetSum().GetDataPoints() {
+				key := ""
+
+				for _, attr := range point.GetAttributes() {
+					key += attr.GetKey() + "=" + attr.GetValue().GetStringValue() + " "
+				}
+
+				reasons[key] = point.GetAsDouble()
+			}
+
+			wantReasons := map[string]float64{
+				"metric=alerts_total reason=label_mismatch ":  1,
+				"metric=missing_seconds reason=unregistered ": 1,
+			}
+
+			for key, want := range wantReasons {
+				if reasons[key] != want {
+					t.Errorf("got error counts %v, want %s%v", reasons, key, want)
+				}
+			}
+		})
+	}
+}
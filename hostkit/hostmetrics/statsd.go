@@ -0,0 +1,373 @@
+package hostmetrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdMaxPacketSize is the maximum size of a StatsD UDP packet, chosen to fit in a typical network MTU.
+const statsdMaxPacketSize = 1432
+
+// statsdTagReplacer removes the characters that have a special meaning in the DogStatsD protocol.
+var statsdTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_", ":", "_", "@", "_")
+
+// StatsDMetrics implements the Metrics interface for StatsD, with label values sent as DogStatsD tags.
+//
+// Metrics are aggregated client-side and sent once per flush interval: counters are summed, gauges are sent
+// with their current value, and histogram observations are packed into multi-value packets.
+// Like PrometheusMetrics, invalid calls never panic, but are dropped and counted in the
+// slackmgr_metrics_errors_total metric, and new tag combinations beyond MaxLabelCombinations are recorded
+// in a single series where all label values are "__overflow__".
+type StatsDMetrics struct {
+	// A mutex is used to protect the maps from concurrent access.
+	mu sync.Mutex
+
+	conn      net.Conn
+	constTags []string
+	maxSeries int
+
+	registered map[string]*statsdMetric
+	counters   map[string]*statsdSeries
+	gauges     map[string]*statsdSeries
+	histograms map[string]*statsdSeries
+
+	stopOnce  sync.Once
+	closeOnce sync.Once
+	closeErr  error
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// StatsDMetricsOptions contains the options for a StatsDMetrics instance.
+type StatsDMetricsOptions struct {
+	// Addr is the host:port of the StatsD or DogStatsD agent.
+	Addr string
+
+	// FlushInterval is the time between flushes of the aggregated metrics.
+	FlushInterval time.Duration
+
+	// ConstTags are added to all metrics, e.g. service, role and instance. Tags with empty values are ignored.
+	ConstTags map[string]string
+
+	// MaxLabelCombinations is the maximum number of distinct label combinations per metric. Zero means no limit.
+	MaxLabelCombinations int
+}
+
+// statsdMetric is a registered metric, with its type, label names and the label combinations seen so far.
+type statsdMetric struct {
+	kind   string
+	labels []string
+	seen   map[string]struct{}
+}
+
+// statsdSeries is the aggregated value of a single metric and tag combination, since the last flush.
+type statsdSeries struct {
+	name   string
+	tags   string
+	value  float64
+	values []float64
+}
+
+// NewStatsDMetrics creates and returns a new StatsDMetrics instance, and starts the flush loop.
+// Call Shutdown before exiting, to flush the metrics recorded since the last flush.
+func NewStatsDMetrics(opts StatsDMetricsOptions) (*StatsDMetrics, error) {
+	if opts.FlushInterval <= 0 {
+		return nil, errors.New("statsd flush interval must be positive")
+	}
+
+	conn, err := net.Dial("udp", opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create statsd connection to %s: %w", opts.Addr, err)
+	}
+
+	m := &StatsDMetrics{
+		conn:       conn,
+		maxSeries:  opts.MaxLabelCombinations,
+		registered: make(map[string]*statsdMetric),
+		counters:   make(map[string]*statsdSeries),
+		gauges:     make(map[string]*statsdSeries),
+		histograms: make(map[string]*statsdSeries),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	for name, value := range opts.ConstTags {
+		if value != "" {
+			m.constTags = append(m.constTags, statsdTagReplacer.Replace(name)+":"+statsdTagReplacer.Replace(value))
+		}
+	}
+
+	slices.Sort(m.constTags)
+
+	// The error metric has no cap, since its label combinations are bounded by the registered metrics.
+	m.registered[metricsErrorsMetric] = &statsdMetric{kind: "c", labels: []string{"metric", "reason"}, seen: make(map[string]struct{})}
+
+	go m.flushLoop(opts.FlushInterval)
+
+	return m, nil
+}
+
+// Shutdown stops the flush loop, flushes the remaining metrics and closes the connection.
+// It can be called more than once, e.g. again after a timeout.
+func (m *StatsDMetrics) Shutdown(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	select {
+	case <-m.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	m.closeOnce.Do(func() { m.closeErr = m.conn.Close() })
+
+	return m.closeErr
+}
+
+func (m *StatsDMetrics) RegisterCounter(name, _ string, labels ...string) {
+	m.register(name, "c", labels)
+}
+
+func (m *StatsDMetrics) RegisterGauge(name, _ string, labels ...string) {
+	m.register(name, "g", labels)
+}
+
+func (m *StatsDMetrics) RegisterHistogram(name, _ string, _ []float64, labels ...string) {
+	m.register(name, "h", labels)
+}
+
+func (m *StatsDMetrics) CounterAdd(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series, ok := m.series(name, "c", labelValues); ok {
+		series.value += value
+	}
+}
+
+func (m *StatsDMetrics) CounterInc(name string, labelValues ...string) {
+	m.CounterAdd(name, 1, labelValues...)
+}
+
+func (m *StatsDMetrics) GaugeSet(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series, ok := m.series(name, "g", labelValues); ok {
+		series.value = value
+	}
+}
+
+func (m *StatsDMetrics) GaugeAdd(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series, ok := m.series(name, "g", labelValues); ok {
+		series.value += value
+	}
+}
+
+func (m *StatsDMetrics) Observe(name string, value float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if series, ok := m.series(name, "h", labelValues); ok {
+		series.values = append(series.values, value)
+	}
+}
+
+func (m *StatsDMetrics) register(name, kind string, labels []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// If the metric is already registered, do nothing. A metric registered with another type is an error.
+	if existing, ok := m.registered[name]; ok {
+		if existing.kind != kind {
+			m.countError(name, metricsErrorRegisterFailed)
+		}
+
+		return
+	}
+
+	m.registered[name] = &statsdMetric{kind: kind, labels: labels, seen: make(map[string]struct{})}
+}
+
+// series returns the aggregated series for the metric and label values, or false if the call must be dropped.
+// The caller must hold the lock.
+func (m *StatsDMetrics) series(name, kind string, labelValues []string) (*statsdSeries, bool) {
+	metric, ok := m.registered[name]
+	if !ok || metric.kind != kind {
+		m.countError(name, metricsErrorUnregistered)
+		return nil, false
+	}
+
+	if len(labelValues) != len(metric.labels) {
+		m.countError(name, metricsErrorLabelMismatch)
+		return nil, false
+	}
+
+	labelValues = m.capLabelValues(name, metric, labelValues)
+
+	tags := make([]string, 0, len(m.constTags)+len(metric.labels))
+	tags = append(tags, m.constTags...)
+
+	for i, label := range metric.labels {
+		tags = append(tags, statsdTagReplacer.Replace(label)+":"+statsdTagReplacer.Replace(labelValues[i]))
+	}
+
+	key := name + "|" + strings.Join(tags, ",")
+
+	var seriesMap map[string]*statsdSeries
+
+	switch kind {
+	case "c":
+		seriesMap = m.counters
+	case "g":
+		seriesMap = m.gauges
+	default:
+		seriesMap = m.histograms
+	}
+
+	series, ok := seriesMap[key]
+	if !ok {
+		series = &statsdSeries{name: statsdTagReplacer.Replace(name), tags: strings.Join(tags, ",")}
+		seriesMap[key] = series
+	}
+
+	return series, true
+}
+
+// capLabelValues applies the label combination cap, and returns the label values to use. The caller must hold the lock.
+func (m *StatsDMetrics) capLabelValues(name string, metric *statsdMetric, labelValues []string) []string {
+	if m.maxSeries <= 0 || len(labelValues) == 0 || name == metricsErrorsMetric {
+		return labelValues
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	if _, ok := metric.seen[key]; ok {
+		return labelValues
+	}
+
+	if len(metric.seen) < m.maxSeries {
+		metric.seen[key] = struct{}{}
+		return labelValues
+	}
+
+	m.countError(name, metricsErrorOverflow)
+
+	overflow := make([]string, len(labelValues))
+	for i := range overflow {
+		overflow[i] = overflowLabelValue
+	}
+
+	return overflow
+}
+
+// countError counts a dropped call in the metrics error counter. The caller must hold the lock.
+func (m *StatsDMetrics) countError(name, reason string) {
+	if series, ok := m.series(metricsErrorsMetric, "c", []string{name, reason}); ok {
+		series.value++
+	}
+}
+
+func (m *StatsDMetrics) flushLoop(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			m.flush()
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// flush sends the aggregated metrics, and resets the counters and histograms. Gauges keep their current value,
+// and are sent on every flush. Send errors are ignored, since StatsD is fire-and-forget.
+func (m *StatsDMetrics) flush() {
+	m.mu.Lock()
+
+	lines := make([]string, 0, len(m.counters)+len(m.gauges)+len(m.histograms))
+
+	for _, s := range m.counters {
+		lines = append(lines, statsdLines(s.name, "c", s.tags, s.value)...)
+	}
+
+	for _, s := range m.gauges {
+		lines = append(lines, statsdLines(s.name, "g", s.tags, s.value)...)
+	}
+
+	for _, s := range m.histograms {
+		lines = append(lines, statsdLines(s.name, "h", s.tags, s.values...)...)
+	}
+
+	clear(m.counters)
+	clear(m.histograms)
+
+	m.mu.Unlock()
+
+	var packet strings.Builder
+
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacketSize {
+			_, _ = m.conn.Write([]byte(packet.String()))
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, _ = m.conn.Write([]byte(packet.String()))
+	}
+}
+
+// statsdLines formats a metric as StatsD lines, e.g. "name:1:2:3|h|#tag:value". Multiple values use the DogStatsD
+// multi-value format, and are split into several lines if needed, so that each line fits in a packet.
+func statsdLines(name, kind, tags string, values ...float64) []string {
+	suffix := "|" + kind
+	if tags != "" {
+		suffix += "|#" + tags
+	}
+
+	var lines []string
+
+	var b strings.Builder
+
+	for _, v := range values {
+		value := strconv.FormatFloat(v, 'f', -1, 64)
+
+		if b.Len() > 0 && b.Len()+1+len(value)+len(suffix) > statsdMaxPacketSize {
+			lines = append(lines, b.String()+suffix)
+			b.Reset()
+		}
+
+		if b.Len() == 0 {
+			b.WriteString(name)
+		}
+
+		b.WriteString(":" + value)
+	}
+
+	if b.Len() > 0 {
+		lines = append(lines, b.String()+suffix)
+	}
+
+	return lines
+}
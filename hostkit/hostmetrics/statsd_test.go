@@ -0,0 +1,235 @@
+package hostmetrics
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startStatsDListener starts a UDP listener, and returns its address and a function that returns the lines
+// received until no packet arrives for a short while.
+func startStatsDListener(t *testing.T) (string, func() []string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on UDP: %s", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	receive := func() []string {
+		var lines []string
+
+		buf := make([]byte, 64*1024)
+
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+
+			if n > statsdMaxPacketSize {
+				t.Errorf("got a packet of %d bytes, want at most %d", n, statsdMaxPacketSize)
+			}
+
+			lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+		}
+
+		slices.Sort(lines)
+
+		return lines
+	}
+
+	return conn.LocalAddr().String(), receive
+}
+
+func newTestStatsDMetrics(t *testing.T, addr string, maxSeries int) *StatsDMetrics {
+	t.Helper()
+
+	m, err := NewStatsDMetrics(StatsDMetricsOptions{
+		Addr:                 addr,
+		FlushInterval:        time.Hour,
+		ConstTags:            map[string]string{"service": "api", "role": ""},
+		MaxLabelCombinations: maxSeries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestStatsDMetrics(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxSeries int
+		record    func(m *StatsDMetrics)
+		want      []string
+	}{
+		{
+			name: "counters are summed",
+			record: func(m *StatsDMetrics) {
+				m.RegisterCounter("alerts_total", "", "channel")
+				m.CounterInc("alerts_total", "C1")
+				m.CounterAdd("alerts_total", 2, "C1")
+				m.CounterInc("alerts_total", "C2")
+			},
+			want: []string{
+				"alerts_total:1|c|#service:api,channel:C2",
+				"alerts_total:3|c|#service:api,channel:C1",
+			},
+		},
+		{
+			name: "gauges have their current value",
+			record: func(m *StatsDMetrics) {
+				m.RegisterGauge("queue_depth", "")
+				m.GaugeSet("queue_depth", 5)
+				m.GaugeAdd("queue_depth", -2)
+			},
+			want: []string{"queue_depth:3|g|#service:api"},
+		},
+		{
+			name: "histogram observations are packed",
+			record: func(m *StatsDMetrics) {
+				m.RegisterHistogram("latency_seconds", "", nil)
+				m.Observe("latency_seconds", 0.5)
+				m.Observe("latency_seconds", 1.25)
+			},
+			want: []string{"latency_seconds:0.5:1.25|h|#service:api"},
+		},
+		{
+			name: "special characters in tags are replaced",
+			record: func(m *StatsDMetrics) {
+				m.RegisterCounter("alerts_total", "", "route")
+				m.CounterInc("alerts_total", "a|b,c#d:e@f")
+			},
+			want: []string{"alerts_total:1|c|#service:api,route:a_b_c_d_e_f"},
+		},
+		{
+			name: "invalid calls are counted",
+			record: func(m *StatsDMetrics) {
+				m.RegisterCounter("alerts_total", "", "channel")
+				m.CounterInc("alerts_total")
+				m.GaugeSet("missing", 1)
+				m.RegisterGauge("alerts_total", "")
+			},
+			want: []string{
+				"slackmgr_metrics_errors_total:1|c|#service:api,metric:alerts_total,reason:label_mismatch",
+				"slackmgr_metrics_errors_total:1|c|#service:api,metric:alerts_total,reason:register_failed",
+				"slackmgr_metrics_errors_total:1|c|#service:api,metric:missing,reason:unregistered",
+			},
+		},
+		{
+			name:      "label combinations beyond the cap overflow",
+			maxSeries: 2,
+			record: func(m *StatsDMetrics) {
+				m.RegisterGauge("depth", "", "channel")
+				m.GaugeSet("depth", 1, "C1")
+				m.GaugeSet("depth", 2, "C2")
+				m.GaugeSet("depth", 3, "C3")
+				m.GaugeSet("depth", 4, "C4")
+				m.GaugeSet("depth", 5, "C1")
+			},
+			want: []string{
+				"depth:2|g|#service:api,channel:C2",
+				"depth:4|g|#service:api,channel:__overflow__",
+				"depth:5|g|#service:api,channel:C1",
+				"slackmgr_metrics_errors_total:2|c|#service:api,metric:depth,reason:overflow",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, receive := startStatsDListener(t)
+
+			m := newTestStatsDMetrics(t, addr, tt.maxSeries)
+
+			tt.record(m)
+
+			if err := m.Shutdown(context.Background()); err != nil {
+				t.Fatalf("failed to shut down: %s", err)
+			}
+
+			if got := receive(); !slices.Equal(got, tt.want) {
+				t.Errorf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestStatsDMetricsFlush(t *testing.T) {
+	addr, receive := startStatsDListener(t)
+
+	m := newTestStatsDMetrics(t, addr, 0)
+
+	defer func() { _ = m.Shutdown(context.Background()) }()
+
+	m.RegisterCounter("alerts_total", "")
+	m.RegisterGauge("queue_depth", "")
+
+	m.CounterInc("alerts_total")
+	m.GaugeSet("queue_depth", 7)
+	m.flush()
+
+	want := []string{"alerts_total:1|c|#service:api", "queue_depth:7|g|#service:api"}
+
+	if got := receive(); !slices.Equal(got, want) {
+		t.Errorf("got %v after the first flush, want %v", got, want)
+	}
+
+	// Counters are reset after each flush, while gauges are sent again with their current value.
+	m.flush()
+
+	want = []string{"queue_depth:7|g|#service:api"}
+
+	if got := receive(); !slices.Equal(got, want) {
+		t.Errorf("got %v after the second flush, want %v", got, want)
+	}
+}
+
+func TestStatsDMetricsLargeHistogram(t *testing.T) {
+	addr, receive := startStatsDListener(t)
+
+	m := newTestStatsDMetrics(t, addr, 0)
+
+	m.RegisterHistogram("latency_seconds", "", nil)
+
+	for range 1000 {
+		m.Observe("latency_seconds", 0.123456)
+	}
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+
+	for _, line := range receive() {
+		count += strings.Count(line, ":0.123456")
+	}
+
+	if count != 1000 {
+		t.Errorf("got %d observations, want 1000", count)
+	}
+}
+
+func TestStatsDMetricsShutdownTwice(t *testing.T) {
+	addr, _ := startStatsDListener(t)
+
+	m := newTestStatsDMetrics(t, addr, 0)
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Errorf("got error %s from the second shutdown, want nil", err)
+	}
+}
@@ -0,0 +1,332 @@
+package hostkit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/slackmgr/types"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Logger implements the types.Logger interface with zerolog.
+//
+// The log levels are checked by the Logger itself, rather than by zerolog, so that they can be changed at runtime
+// and per component. All loggers derived from the same root logger share the same levels.
+//
+// Secrets are redacted from the output: the known secret values in the options, values that look like Slack tokens
+// or AWS access keys, and the values of fields with secret names such as password or token.
+//
+// During alert storms, the optional sampler and deduper limit the number of near-identical entries, see logsampling.go.
+type Logger struct {
+	logger    zerolog.Logger
+	component string
+	levels    *LogLevels
+	redactor  *redactor
+	sampler   *logSampler
+	deduper   *logDeduper
+
+	// slog is the logger of the slog sink, with the same fields as logger. It is nil if there is no slog sink.
+	slog      *SlogLogger
+	slogLevel zerolog.Level
+}
+
+// LoggerOptions contains the options for a Logger.
+type LoggerOptions struct {
+	// JSON selects JSON output on stderr. Otherwise stderr uses the human-readable console format.
+	JSON bool
+
+	// Verbose sets the startup log level to debug rather than info.
+	Verbose bool
+
+	// Secrets are values that are redacted wherever they appear in the output, e.g. tokens and passwords.
+	Secrets []string
+
+	// RedactFields are field names whose values are redacted, in addition to the default names such as password.
+	RedactFields []string
+
+	// Sinks are the log outputs: "stderr", "file", "syslog" and "slog". Defaults to stderr only.
+	// The syslog sink is not available on Windows and Plan 9.
+	Sinks []string
+
+	// StderrLevel is the minimum level written to stderr. Empty means everything the logger emits.
+	StderrLevel string
+
+	// File configures the file sink.
+	File FileSinkOptions
+
+	// Syslog configures the syslog sink.
+	Syslog SyslogSinkOptions
+
+	// Slog configures the slog sink, which forwards the entries to a slog.Handler.
+	Slog SlogSinkOptions
+
+	// Sampling configures log sampling. Sampling is disabled if the burst is zero.
+	Sampling SamplingOptions
+
+	// Dedup configures the deduplication of repeated entries. Deduplication is disabled if the interval is zero.
+	Dedup DedupOptions
+}
+
+// NewLogger creates the root logger, and sets the global zerolog logger to write to the same sinks.
+func NewLogger(opts LoggerOptions) (*Logger, error) {
+	zerolog.TimestampFieldName = "timestamp"
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	zerolog.DurationFieldInteger = true
+	zerolog.DurationFieldUnit = time.Millisecond
+
+	output, err := newLogOutput(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLogger(&opts, output)
+}
+
+// newLogger creates the root logger, writing to the given output.
+func newLogger(opts *LoggerOptions, output *logOutput) (*Logger, error) {
+	level := zerolog.InfoLevel
+
+	if opts.Verbose {
+		level = zerolog.DebugLevel
+	}
+
+	// The redactor must see the JSON entries, so it is placed in front of the sinks, which may use console format.
+	redactor := newRedactor(opts.Secrets, opts.RedactFields)
+	writer := redactor.writer(output.writer)
+
+	loggerInstance := zerolog.New(writer).With().Timestamp().Logger().Hook(traceHook)
+	levels := newLogLevels(level)
+
+	// Entries written with zerolog directly don't go through the Logger, so they reach the slog sink in their JSON form.
+	directLogger := loggerInstance
+
+	if output.slog != nil {
+		directLogger = zerolog.New(redactor.writer(zerolog.MultiLevelWriter(output.writer, output.slog.json))).With().Timestamp().Logger().Hook(traceHook)
+	}
+
+	// The global logger is used by the host code outside the components, e.g. by the signal handling and the settings
+	// reloader. Its entries are filtered by the default log level, which can be changed at runtime like the others.
+	log.Logger = directLogger.Hook(levels.globalHook())
+
+	sampler, deduper, err := newLogSampling(opts, directLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := &Logger{
+		logger:   loggerInstance,
+		levels:   levels,
+		redactor: redactor,
+		sampler:  sampler,
+		deduper:  deduper,
+	}
+
+	if output.slog != nil {
+		logger.slog = output.slog.logger
+		logger.slogLevel = output.slog.level
+	}
+
+	return logger, nil
+}
+
+// Run reports the repeated log entries collapsed by the deduper, until the context is cancelled.
+// It returns immediately if deduplication is disabled.
+func (l *Logger) Run(ctx context.Context) {
+	if l.deduper != nil {
+		l.deduper.run(ctx)
+	}
+}
+
+// Levels returns the log levels shared by this logger and all loggers derived from the same root logger.
+func (l *Logger) Levels() *LogLevels {
+	return l.levels
+}
+
+// WithComponent returns a logger for the given component, which uses the component log level if one is set.
+// The component is added to each log entry.
+func (l *Logger) WithComponent(component string) *Logger {
+	c := *l
+	c.component = component
+
+	return &c
+}
+
+func (l *Logger) Debug(msg string) {
+	l.log(zerolog.DebugLevel, msg, nil, false)
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.log(zerolog.DebugLevel, format, args, true)
+}
+
+func (l *Logger) Info(msg string) {
+	l.log(zerolog.InfoLevel, msg, nil, false)
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.log(zerolog.InfoLevel, format, args, true)
+}
+
+func (l *Logger) Error(msg string) {
+	l.log(zerolog.ErrorLevel, msg, nil, false)
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(zerolog.ErrorLevel, format, args, true)
+}
+
+// log writes an entry at the given level, unless the level is disabled for the logger component, or the entry
+// is dropped by the sampler or the deduper. The message is only formatted if the entry passes the sampler.
+func (l *Logger) log(level zerolog.Level, template string, args []any, format bool) {
+	if !l.levels.enabled(l.component, level) {
+		return
+	}
+
+	ok, sampledOut := l.sampler.sample(level, template)
+	if !ok {
+		return
+	}
+
+	msg := template
+	if format {
+		msg = fmt.Sprintf(template, args...)
+	}
+
+	if !l.deduper.first(level, l.component, msg) {
+		return
+	}
+
+	e := l.logger.WithLevel(level)
+
+	if l.component != "" {
+		e = e.Str("component", l.component)
+	}
+
+	if sampledOut > 0 {
+		e = e.Int("sampled_out", sampledOut)
+	}
+
+	e.Msg(msg)
+
+	if l.slog != nil && level >= l.slogLevel {
+		l.logSlog(level, msg, sampledOut)
+	}
+}
+
+// logSlog writes an entry to the slog sink. The secrets in the message are redacted here, since the entry doesn't
+// go through the redacting writer.
+func (l *Logger) logSlog(level zerolog.Level, msg string, sampledOut int) {
+	attrs := make([]slog.Attr, 0, 2)
+
+	if l.component != "" {
+		attrs = append(attrs, slog.String("component", l.component))
+	}
+
+	if sampledOut > 0 {
+		attrs = append(attrs, slog.Int("sampled_out", sampledOut))
+	}
+
+	l.slog.logAttrs(slogLevel(level), l.redactor.redactString(msg), attrs)
+}
+
+func (l *Logger) WithField(key string, value any) types.Logger { //nolint:ireturn
+	if l.redactor.isSecretField(key) {
+		value = redactedValue
+	} else {
+		value = l.redactor.redactValue(value)
+	}
+
+	c := l.with(zerologField(l.logger.With(), key, value).Logger())
+
+	if l.slog != nil {
+		c.slog = l.slog.withAttrs([]slog.Attr{l.redactor.slogAttr(key, value)})
+	}
+
+	return c
+}
+
+func (l *Logger) WithFields(fields map[string]any) types.Logger { //nolint:ireturn
+	fields = l.redactor.redactFields(fields)
+
+	c := l.with(l.logger.With().Fields(fields).Logger())
+
+	if l.slog != nil {
+		attrs := make([]slog.Attr, 0, len(fields))
+
+		// Map iteration order is random, so the fields are sorted to get a stable output.
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			attrs = append(attrs, l.redactor.slogAttr(key, fields[key]))
+		}
+
+		c.slog = l.slog.withAttrs(attrs)
+	}
+
+	return c
+}
+
+// zerologField adds a field to the context, with a zerolog type that matches the Go type of the value.
+func zerologField(ctx zerolog.Context, key string, value any) zerolog.Context {
+	switch v := value.(type) {
+	case string:
+		return ctx.Str(key, v)
+	case int:
+		return ctx.Int(key, v)
+	case int32:
+		return ctx.Int32(key, v)
+	case int64:
+		return ctx.Int64(key, v)
+	case float64:
+		return ctx.Float64(key, v)
+	case bool:
+		return ctx.Bool(key, v)
+	case time.Time:
+		return ctx.Time(key, v)
+	case time.Duration:
+		return ctx.Dur(key, v)
+	case error:
+		return ctx.AnErr(key, v)
+	default:
+		return ctx.Any(key, value)
+	}
+}
+
+// traceHook adds the trace and span IDs of the span in the context of the entry, if any. The context is set with
+// WithTraceContext for a Logger, and with Ctx for entries written with zerolog directly.
+var traceHook = zerolog.HookFunc(func(e *zerolog.Event, _ zerolog.Level, _ string) {
+	spanContext := trace.SpanContextFromContext(e.GetCtx())
+	if spanContext.IsValid() {
+		e.Str("trace_id", spanContext.TraceID().String()).Str("span_id", spanContext.SpanID().String())
+	}
+})
+
+// WithTraceContext returns a logger bound to ctx, so that each log entry includes the trace and span IDs of the span
+// in ctx. The logger is returned unchanged if ctx has no valid span.
+func (l *Logger) WithTraceContext(ctx context.Context) *Logger {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return l
+	}
+
+	c := l.with(l.logger.With().Ctx(ctx).Logger())
+
+	// The slog sink doesn't go through the zerolog hooks, so the IDs are added to it as attributes.
+	if l.slog != nil {
+		c.slog = l.slog.withAttrs([]slog.Attr{slog.String("trace_id", spanContext.TraceID().String()), slog.String("span_id", spanContext.SpanID().String())})
+	}
+
+	return c
+}
+
+// with returns a logger with the given zerolog logger, keeping everything else.
+func (l *Logger) with(logger zerolog.Logger) *Logger {
+	c := *l
+	c.logger = logger
+
+	return &c
+}
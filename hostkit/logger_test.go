@@ -0,0 +1,198 @@
+package hostkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestLogger returns a logger that writes JSON entries to the returned buffer.
+func newTestLogger(t *testing.T, opts LoggerOptions) (*Logger, *bytes.Buffer) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	opts.JSON = true
+
+	logger, err := newLogger(&opts, &logOutput{writer: zerolog.LevelWriterAdapter{Writer: &buf}})
+	if err != nil {
+		t.Fatalf("failed to create logger: %s", err)
+	}
+
+	return logger, &buf
+}
+
+// logEntries decodes the JSON log entries in the buffer, one per line.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	entries := []map[string]any{}
+
+	for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var entry map[string]any
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("failed to decode log entry %q: %s", line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestLoggerWithField(t *testing.T) {
+	timestamp := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "string", value: "value", want: "value"},
+		{name: "int", value: 42, want: float64(42)},
+		{name: "int32", value: int32(42), want: float64(42)},
+		{name: "int64", value: int64(42), want: float64(42)},
+		{name: "float64", value: 1.5, want: 1.5},
+		{name: "bool", value: true, want: true},
+		{name: "time", value: timestamp, want: timestamp.Format(time.RFC3339Nano)},
+		{name: "duration in milliseconds", value: 1500 * time.Millisecond, want: float64(1500)},
+		{name: "error as its message", value: errors.New("failed"), want: "failed"},
+		{name: "other types as JSON", value: []string{"a", "b"}, want: []any{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger(t, LoggerOptions{})
+
+			logger.WithField("field", tt.value).Info("message")
+
+			entries := logEntries(t, buf)
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+
+			got, _ := json.Marshal(entries[0]["field"])
+			want, _ := json.Marshal(tt.want)
+
+			if !bytes.Equal(got, want) {
+				t.Errorf("got field %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestLoggerLevelsAndComponents(t *testing.T) {
+	tests := []struct {
+		name    string
+		verbose bool
+		log     func(l *Logger)
+		want    []string
+	}{
+		{
+			name: "debug is dropped by default",
+			log: func(l *Logger) {
+				l.Debug("debug")
+				l.Info("info")
+				l.Errorf("error %d", 1)
+			},
+			want: []string{"info", "error 1"},
+		},
+		{
+			name:    "debug is logged when verbose",
+			verbose: true,
+			log: func(l *Logger) {
+				l.Debugf("debug %s", "x")
+				l.Info("info")
+			},
+			want: []string{"debug x", "info"},
+		},
+		{
+			name: "component is added to the entries",
+			log: func(l *Logger) {
+				l.WithComponent("queue").Info("from queue")
+			},
+			want: []string{"from queue"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger(t, LoggerOptions{Verbose: tt.verbose})
+
+			tt.log(logger)
+
+			entries := logEntries(t, buf)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %v", len(entries), len(tt.want), entries)
+			}
+
+			for i, entry := range entries {
+				if entry["message"] != tt.want[i] {
+					t.Errorf("entry %d: got message %v, want %q", i, entry["message"], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoggerWithComponentField(t *testing.T) {
+	logger, buf := newTestLogger(t, LoggerOptions{})
+
+	logger.WithComponent("manager").Info("message")
+	logger.Info("root")
+
+	entries := logEntries(t, buf)
+
+	if entries[0]["component"] != "manager" {
+		t.Errorf("got component %v, want manager", entries[0]["component"])
+	}
+
+	if _, ok := entries[1]["component"]; ok {
+		t.Errorf("root logger entry has a component: %v", entries[1])
+	}
+}
+
+func TestLoggerTraceContext(t *testing.T) {
+	logger, buf := newTestLogger(t, LoggerOptions{})
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x0a, 0xf7, 0x65, 0x19, 0x16, 0xcd, 0x43, 0xdd, 0x84, 0x48, 0xeb, 0x21, 0x1c, 0x80, 0x31, 0x9c},
+		SpanID:     trace.SpanID{0xb7, 0xad, 0x6b, 0x71, 0x69, 0x20, 0x33, 0x31},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	logger.WithTraceContext(ctx).WithComponent("ingress").WithField("key", "value").Info("bound logger")
+	logger.WithTraceContext(context.Background()).Info("no span")
+	log.Info().Ctx(ctx).Msg("zerolog entry")
+	logger.Info("root")
+
+	entries := logEntries(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+
+	for i, wantIDs := range []bool{true, false, true, false} {
+		traceID, spanID := entries[i]["trace_id"], entries[i]["span_id"]
+
+		switch {
+		case wantIDs && (traceID != "0af7651916cd43dd8448eb211c80319c" || spanID != "b7ad6b7169203331"):
+			t.Errorf("entry %q: got trace ID %v and span ID %v, want the IDs of the span", entries[i]["message"], traceID, spanID)
+		case !wantIDs && (traceID != nil || spanID != nil):
+			t.Errorf("entry %q: got trace ID %v and span ID %v, want none", entries[i]["message"], traceID, spanID)
+		}
+	}
+}
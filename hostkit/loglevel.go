@@ -0,0 +1,253 @@
+package hostkit
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// LogLevelSettings is the serialized form of a set of log levels, e.g. in a settings file or an admin endpoint body.
+// The level applies to all components without a level of their own.
+type LogLevelSettings struct {
+	LogLevel           string            `json:"logLevel,omitempty"           yaml:"logLevel"`
+	ComponentLogLevels map[string]string `json:"componentLogLevels,omitempty" yaml:"componentLogLevels"`
+}
+
+// LogLevelSet is a parsed set of log levels. A level of zerolog.NoLevel means that the level is not set.
+type LogLevelSet struct {
+	level      zerolog.Level
+	components map[string]zerolog.Level
+}
+
+// NewLogLevelSet returns a set with the given level for all components.
+func NewLogLevelSet(level zerolog.Level) *LogLevelSet {
+	return &LogLevelSet{level: level, components: make(map[string]zerolog.Level)}
+}
+
+// Parse validates the settings and returns the parsed log levels. Only the given components can have their own level.
+func (s *LogLevelSettings) Parse(components []string) (*LogLevelSet, error) {
+	set := NewLogLevelSet(zerolog.NoLevel)
+
+	if s == nil {
+		return set, nil
+	}
+
+	if s.LogLevel != "" {
+		level, err := parseLogLevel(s.LogLevel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid logLevel: %w", err)
+		}
+
+		set.level = level
+	}
+
+	for component, value := range s.ComponentLogLevels {
+		if !slices.Contains(components, component) {
+			return nil, fmt.Errorf("invalid componentLogLevels: unknown component '%s' (expected one of %v)", component, components)
+		}
+
+		level, err := parseLogLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid componentLogLevels for %s: %w", component, err)
+		}
+
+		set.components[component] = level
+	}
+
+	return set, nil
+}
+
+func parseLogLevel(value string) (zerolog.Level, error) {
+	level, err := zerolog.ParseLevel(value)
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("unknown log level '%s'", value)
+	}
+
+	return level, nil
+}
+
+func (s *LogLevelSet) settings() *LogLevelSettings {
+	settings := &LogLevelSettings{ComponentLogLevels: make(map[string]string, len(s.components))}
+
+	if s.level != zerolog.NoLevel {
+		settings.LogLevel = s.level.String()
+	}
+
+	for component, level := range s.components {
+		settings.ComponentLogLevels[component] = level.String()
+	}
+
+	return settings
+}
+
+// LogLevels holds the log levels used by all loggers, and allows them to be changed at runtime.
+//
+// The startup level is used until default levels are set, e.g. from a settings file. A temporary override can be
+// set on top of the defaults, e.g. from an admin endpoint or SIGUSR1, and is cleared explicitly or by the optional
+// revert timer. An override level applies to all components, except the components with a level in the override itself.
+type LogLevels struct {
+	mu          sync.Mutex
+	startup     zerolog.Level
+	defaults    *LogLevelSet
+	override    *LogLevelSet
+	revertTimer *time.Timer
+	revertAt    time.Time
+	generation  int
+
+	// effective is the resulting set of levels, read without locking by every log call.
+	effective atomic.Pointer[LogLevelSet]
+}
+
+// LogLevelStatus describes the current log levels, e.g. for an admin endpoint.
+type LogLevelStatus struct {
+	Effective *LogLevelSettings `json:"effective"`
+	Defaults  *LogLevelSettings `json:"defaults"`
+	Override  *LogLevelSettings `json:"override,omitempty"`
+	RevertAt  *time.Time        `json:"revertAt,omitempty"`
+}
+
+func newLogLevels(startup zerolog.Level) *LogLevels {
+	l := &LogLevels{
+		startup:  startup,
+		defaults: NewLogLevelSet(zerolog.NoLevel),
+	}
+
+	l.update()
+
+	return l
+}
+
+// enabled returns true if messages at the given level should be logged for the component.
+func (l *LogLevels) enabled(component string, level zerolog.Level) bool {
+	set := l.effective.Load()
+
+	if componentLevel, ok := set.components[component]; ok {
+		return level >= componentLevel
+	}
+
+	return level >= set.level
+}
+
+// globalHook returns a zerolog hook that discards the entries below the level for loggers without a component.
+// Entries without a level, such as those written with log.Log, are always written.
+func (l *LogLevels) globalHook() zerolog.HookFunc {
+	return func(e *zerolog.Event, level zerolog.Level, _ string) {
+		if level != zerolog.NoLevel && !l.enabled("", level) {
+			e.Discard()
+		}
+	}
+}
+
+// SetDefaults replaces the default levels, e.g. when a settings file changes. Any override is kept.
+func (l *LogLevels) SetDefaults(set *LogLevelSet) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.defaults = set
+	l.update()
+}
+
+// SetOverride sets a temporary override, which is cleared after revertAfter. Zero means no automatic revert.
+func (l *LogLevels) SetOverride(set *LogLevelSet, revertAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRevertTimer()
+	l.override = set
+	l.generation++
+
+	if revertAfter > 0 {
+		generation := l.generation
+
+		l.revertTimer = time.AfterFunc(revertAfter, func() { l.revert(generation) })
+		l.revertAt = time.Now().Add(revertAfter)
+	}
+
+	l.update()
+}
+
+// revert clears the override when the revert timer fires, unless the override has been replaced in the meantime.
+func (l *LogLevels) revert(generation int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.generation != generation || l.override == nil {
+		return
+	}
+
+	l.stopRevertTimer()
+	l.override = nil
+	l.update()
+
+	log.Info().Msg("Log level override expired, reverted to the default log levels")
+}
+
+// ClearOverride removes the override, reverting to the default levels.
+func (l *LogLevels) ClearOverride() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopRevertTimer()
+	l.override = nil
+	l.update()
+}
+
+// Status returns the effective levels, the defaults and the override.
+func (l *LogLevels) Status() *LogLevelStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := &LogLevelStatus{
+		Effective: l.effective.Load().settings(),
+		Defaults:  l.defaults.settings(),
+	}
+
+	if l.override != nil {
+		status.Override = l.override.settings()
+	}
+
+	if !l.revertAt.IsZero() {
+		revertAt := l.revertAt
+		status.RevertAt = &revertAt
+	}
+
+	return status
+}
+
+// stopRevertTimer stops the revert timer, if any. The caller must hold the lock.
+func (l *LogLevels) stopRevertTimer() {
+	if l.revertTimer != nil {
+		l.revertTimer.Stop()
+		l.revertTimer = nil
+	}
+
+	l.revertAt = time.Time{}
+}
+
+// update computes the effective levels from the defaults and the override. The caller must hold the lock.
+func (l *LogLevels) update() {
+	effective := NewLogLevelSet(l.startup)
+
+	maps.Copy(effective.components, l.defaults.components)
+
+	if l.defaults.level != zerolog.NoLevel {
+		effective.level = l.defaults.level
+	}
+
+	if l.override != nil {
+		if l.override.level != zerolog.NoLevel {
+			effective.level = l.override.level
+			effective.components = make(map[string]zerolog.Level)
+		}
+
+		maps.Copy(effective.components, l.override.components)
+	}
+
+	l.effective.Store(effective)
+}
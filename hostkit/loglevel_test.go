@@ -0,0 +1,191 @@
+package hostkit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestLogLevelSettingsParse(t *testing.T) {
+	components := []string{"manager", "api"}
+
+	tests := []struct {
+		name     string
+		settings *LogLevelSettings
+		want     zerolog.Level
+		wantAPI  zerolog.Level
+		wantErr  bool
+	}{
+		{name: "nil settings", want: zerolog.NoLevel},
+		{name: "level only", settings: &LogLevelSettings{LogLevel: "debug"}, want: zerolog.DebugLevel},
+		{
+			name:     "component level",
+			settings: &LogLevelSettings{LogLevel: "error", ComponentLogLevels: map[string]string{"api": "info"}},
+			want:     zerolog.ErrorLevel,
+			wantAPI:  zerolog.InfoLevel,
+		},
+		{name: "unknown level", settings: &LogLevelSettings{LogLevel: "loud"}, wantErr: true},
+		{name: "empty level name", settings: &LogLevelSettings{ComponentLogLevels: map[string]string{"api": ""}}, wantErr: true},
+		{name: "unknown component", settings: &LogLevelSettings{ComponentLogLevels: map[string]string{"db": "debug"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := tt.settings.Parse(components)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if set.level != tt.want {
+				t.Errorf("got level %s, want %s", set.level, tt.want)
+			}
+
+			if tt.wantAPI != 0 && set.components["api"] != tt.wantAPI {
+				t.Errorf("got api level %s, want %s", set.components["api"], tt.wantAPI)
+			}
+		})
+	}
+}
+
+func TestLogLevelsEffective(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults *LogLevelSet
+		override *LogLevelSet
+		enabled  map[string]zerolog.Level
+		disabled map[string]zerolog.Level
+	}{
+		{
+			name:     "startup level",
+			enabled:  map[string]zerolog.Level{"": zerolog.InfoLevel},
+			disabled: map[string]zerolog.Level{"": zerolog.DebugLevel},
+		},
+		{
+			name:     "default component level",
+			defaults: &LogLevelSet{level: zerolog.ErrorLevel, components: map[string]zerolog.Level{"api": zerolog.DebugLevel}},
+			enabled:  map[string]zerolog.Level{"api": zerolog.DebugLevel, "": zerolog.ErrorLevel},
+			disabled: map[string]zerolog.Level{"manager": zerolog.InfoLevel, "": zerolog.InfoLevel},
+		},
+		{
+			name:     "override level replaces the default component levels",
+			defaults: &LogLevelSet{level: zerolog.InfoLevel, components: map[string]zerolog.Level{"api": zerolog.ErrorLevel}},
+			override: NewLogLevelSet(zerolog.DebugLevel),
+			enabled:  map[string]zerolog.Level{"api": zerolog.DebugLevel, "manager": zerolog.DebugLevel},
+		},
+		{
+			name:     "override of a single component keeps the defaults",
+			defaults: &LogLevelSet{level: zerolog.ErrorLevel, components: map[string]zerolog.Level{}},
+			override: &LogLevelSet{level: zerolog.NoLevel, components: map[string]zerolog.Level{"api": zerolog.DebugLevel}},
+			enabled:  map[string]zerolog.Level{"api": zerolog.DebugLevel},
+			disabled: map[string]zerolog.Level{"manager": zerolog.InfoLevel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels := newLogLevels(zerolog.InfoLevel)
+
+			if tt.defaults != nil {
+				levels.SetDefaults(tt.defaults)
+			}
+
+			if tt.override != nil {
+				levels.SetOverride(tt.override, 0)
+			}
+
+			for component, level := range tt.enabled {
+				if !levels.enabled(component, level) {
+					t.Errorf("%s is disabled for component %q", level, component)
+				}
+			}
+
+			for component, level := range tt.disabled {
+				if levels.enabled(component, level) {
+					t.Errorf("%s is enabled for component %q", level, component)
+				}
+			}
+		})
+	}
+}
+
+func TestLogLevelsOverrideRevert(t *testing.T) {
+	levels := newLogLevels(zerolog.InfoLevel)
+
+	levels.SetOverride(NewLogLevelSet(zerolog.DebugLevel), 50*time.Millisecond)
+
+	if !levels.enabled("", zerolog.DebugLevel) {
+		t.Fatal("debug is disabled after the override")
+	}
+
+	if levels.Status().RevertAt == nil {
+		t.Error("status has no revert time")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for levels.enabled("", zerolog.DebugLevel) {
+		if time.Now().After(deadline) {
+			t.Fatal("override wasn't reverted")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := levels.Status(); status.Override != nil || status.RevertAt != nil {
+		t.Errorf("got status %+v after the revert, want no override", status)
+	}
+}
+
+func TestLogLevelsClearOverride(t *testing.T) {
+	levels := newLogLevels(zerolog.InfoLevel)
+
+	levels.SetOverride(NewLogLevelSet(zerolog.DebugLevel), time.Hour)
+	levels.ClearOverride()
+
+	if levels.enabled("", zerolog.DebugLevel) {
+		t.Error("debug is enabled after the override was cleared")
+	}
+
+	if levels.Status().RevertAt != nil {
+		t.Error("status has a revert time after the override was cleared")
+	}
+}
+
+func TestGlobalLoggerLevels(t *testing.T) {
+	logger, buf := newTestLogger(t, LoggerOptions{})
+
+	log.Debug().Msg("global debug")
+	log.Info().Msg("global info")
+
+	logger.Levels().SetOverride(NewLogLevelSet(zerolog.DebugLevel), 0)
+	log.Debug().Msg("global debug with override")
+
+	logger.Levels().SetDefaults(NewLogLevelSet(zerolog.ErrorLevel))
+	logger.Levels().ClearOverride()
+	log.Info().Msg("global info below the defaults")
+	log.Log().Msg("global entry without a level")
+
+	want := []string{"global info", "global debug with override", "global entry without a level"}
+
+	entries := logEntries(t, buf)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %v", len(entries), len(want), entries)
+	}
+
+	for i, entry := range entries {
+		if entry["message"] != want[i] {
+			t.Errorf("entry %d: got message %v, want %q", i, entry["message"], want[i])
+		}
+	}
+}
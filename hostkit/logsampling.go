@@ -0,0 +1,241 @@
+package hostkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// logSampler limits the number of log entries per message template, to keep alert storms from flooding the log.
+//
+// Within each period, the first burst entries of a template are logged, and after that only every Nth entry.
+// The template is the format string of the *f methods, so that entries that only differ in their arguments
+// are sampled together. Only the configured levels are sampled.
+type logSampler struct {
+	burst  int
+	every  int
+	period time.Duration
+	levels map[zerolog.Level]bool
+
+	mu        sync.Mutex
+	periodEnd time.Time
+	counts    map[string]int
+}
+
+func newLogSampler(burst, every int, period time.Duration, levels map[zerolog.Level]bool) *logSampler {
+	return &logSampler{
+		burst:  burst,
+		every:  max(every, 1),
+		period: period,
+		levels: levels,
+		counts: make(map[string]int),
+	}
+}
+
+// sample returns true if the entry should be logged, and the number of entries of the template that were dropped
+// since the previous logged entry. It returns true for all levels that are not sampled. A nil sampler logs everything.
+func (s *logSampler) sample(level zerolog.Level, template string) (bool, int) {
+	if s == nil || !s.levels[level] {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// All templates share the same period, which keeps the map from growing beyond the templates seen in one period.
+	if now := time.Now(); now.After(s.periodEnd) {
+		clear(s.counts)
+		s.periodEnd = now.Add(s.period)
+	}
+
+	key := level.String() + "|" + template
+
+	s.counts[key]++
+	count := s.counts[key]
+
+	if count <= s.burst {
+		return true, 0
+	}
+
+	if (count-s.burst)%s.every != 0 {
+		return false, 0
+	}
+
+	return true, s.every - 1
+}
+
+// logDeduper collapses repeated identical log entries. The first entry is logged as usual, and repeats within
+// the same interval are counted and reported in a single "repeated N times" entry at the end of the interval.
+// Entries are identical if they have the same level, component and message. Fields are not compared.
+type logDeduper struct {
+	logger   zerolog.Logger
+	interval time.Duration
+	levels   map[zerolog.Level]bool
+
+	mu      sync.Mutex
+	entries map[dedupKey]int
+}
+
+type dedupKey struct {
+	level     zerolog.Level
+	component string
+	message   string
+}
+
+func newLogDeduper(logger zerolog.Logger, interval time.Duration, levels map[zerolog.Level]bool) *logDeduper {
+	return &logDeduper{
+		logger:   logger,
+		interval: interval,
+		levels:   levels,
+		entries:  make(map[dedupKey]int),
+	}
+}
+
+// first returns true if the entry should be logged, i.e. if it is not a repeat within the current interval.
+// It returns true for all levels that are not deduplicated. A nil deduper logs everything.
+func (d *logDeduper) first(level zerolog.Level, component, message string) bool {
+	if d == nil || !d.levels[level] {
+		return true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := dedupKey{level: level, component: component, message: message}
+
+	if count, ok := d.entries[key]; ok {
+		d.entries[key] = count + 1
+		return false
+	}
+
+	d.entries[key] = 0
+
+	return true
+}
+
+// run reports the repeated entries at the end of each interval, until the context is cancelled.
+// The repeats counted since the last interval are reported before it returns.
+func (d *logDeduper) run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.flush()
+			return
+		case <-ticker.C:
+			d.flush()
+		}
+	}
+}
+
+func (d *logDeduper) flush() {
+	d.mu.Lock()
+	entries := d.entries
+	d.entries = make(map[dedupKey]int)
+	d.mu.Unlock()
+
+	for key, count := range entries {
+		if count == 0 {
+			continue
+		}
+
+		e := d.logger.WithLevel(key.level).Int("repeated", count)
+
+		if key.component != "" {
+			e = e.Str("component", key.component)
+		}
+
+		e.Msgf("%s (repeated %d times in the last %s)", key.message, count, d.interval)
+	}
+}
+
+// parseLogLevelList parses a comma-separated list of log levels.
+func parseLogLevelList(value string) (map[zerolog.Level]bool, error) {
+	levels := make(map[zerolog.Level]bool)
+
+	for name := range strings.SplitSeq(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		level, err := parseLogLevel(strings.ToLower(name))
+		if err != nil {
+			return nil, err
+		}
+
+		levels[level] = true
+	}
+
+	return levels, nil
+}
+
+// SamplingOptions contains the options for log sampling.
+type SamplingOptions struct {
+	// Burst is the number of entries per message template logged in each period before sampling starts.
+	Burst int
+
+	// Every is the sampling rate after the burst: only every Nth entry of a message template is logged.
+	Every int
+
+	// Period is the length of the sampling period.
+	Period time.Duration
+
+	// Levels is a comma-separated list of the levels that are sampled, e.g. "debug,info". Errors and higher
+	// levels can't be sampled, so that they are never dropped.
+	Levels string
+}
+
+// DedupOptions contains the options for the deduplication of repeated log entries.
+type DedupOptions struct {
+	// Interval is the time between the reports of repeated entries.
+	Interval time.Duration
+
+	// Levels is a comma-separated list of the levels that are deduplicated, e.g. "debug,info". Errors and higher
+	// levels can't be deduplicated, since the repeats would only be reported at the end of the interval.
+	Levels string
+}
+
+// newLogSampling creates the sampler and deduper from the options. Each is nil if it is disabled.
+// The deduper writes the repeat counts to the given logger.
+func newLogSampling(opts *LoggerOptions, logger zerolog.Logger) (*logSampler, *logDeduper, error) {
+	var sampler *logSampler
+	var deduper *logDeduper
+
+	if opts.Sampling.Burst > 0 {
+		levels, err := parseLogLevelList(opts.Sampling.Levels)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid sampling levels: %w", err)
+		}
+
+		for level := range levels {
+			if level >= zerolog.ErrorLevel {
+				return nil, nil, fmt.Errorf("invalid sampling levels: %s entries can't be sampled", level)
+			}
+		}
+
+		sampler = newLogSampler(opts.Sampling.Burst, opts.Sampling.Every, opts.Sampling.Period, levels)
+	}
+
+	if opts.Dedup.Interval > 0 {
+		levels, err := parseLogLevelList(opts.Dedup.Levels)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid dedup levels: %w", err)
+		}
+
+		for level := range levels {
+			if level >= zerolog.ErrorLevel {
+				return nil, nil, fmt.Errorf("invalid dedup levels: %s entries can't be deduplicated", level)
+			}
+		}
+
+		deduper = newLogDeduper(logger, opts.Dedup.Interval, levels)
+	}
+
+	return sampler, deduper, nil
+}
@@ -0,0 +1,103 @@
+package hostkit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogSampler(t *testing.T) {
+	tests := []struct {
+		name        string
+		level       zerolog.Level
+		entries     int
+		wantLogged  int
+		wantDropped int
+	}{
+		{name: "burst only", level: zerolog.InfoLevel, entries: 3, wantLogged: 3},
+		{name: "every nth after the burst", level: zerolog.InfoLevel, entries: 3 + 25, wantLogged: 3 + 2, wantDropped: 2 * 9},
+		{name: "levels that are not sampled", level: zerolog.ErrorLevel, entries: 50, wantLogged: 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := newLogSampler(3, 10, time.Hour, map[zerolog.Level]bool{zerolog.InfoLevel: true})
+
+			logged, dropped := 0, 0
+
+			for range tt.entries {
+				if ok, sampledOut := sampler.sample(tt.level, "alert %s received"); ok {
+					logged++
+					dropped += sampledOut
+				}
+			}
+
+			if logged != tt.wantLogged || dropped != tt.wantDropped {
+				t.Errorf("got %d logged and %d dropped, want %d and %d", logged, dropped, tt.wantLogged, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestLogDeduper(t *testing.T) {
+	logger, buf := newTestLogger(t, LoggerOptions{})
+
+	deduper := newLogDeduper(logger.logger, 10*time.Second, map[zerolog.Level]bool{zerolog.InfoLevel: true})
+
+	for i := range 5 {
+		if first := deduper.first(zerolog.InfoLevel, "api", "request failed"); first != (i == 0) {
+			t.Fatalf("entry %d: got first %v", i, first)
+		}
+	}
+
+	if !deduper.first(zerolog.InfoLevel, "manager", "request failed") {
+		t.Error("entry of another component was deduplicated")
+	}
+
+	if !deduper.first(zerolog.DebugLevel, "api", "request failed") {
+		t.Error("entry of a level that is not deduplicated was deduplicated")
+	}
+
+	deduper.flush()
+
+	entries := logEntries(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1 repeat report: %v", len(entries), entries)
+	}
+
+	if entries[0]["repeated"] != float64(4) || entries[0]["component"] != "api" {
+		t.Errorf("got %v, want 4 repeats of the api entry", entries[0])
+	}
+
+	if !deduper.first(zerolog.InfoLevel, "api", "request failed") {
+		t.Error("entry was deduplicated after the flush")
+	}
+}
+
+func TestNewLogSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    LoggerOptions
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "sampling", opts: LoggerOptions{Sampling: SamplingOptions{Burst: 10, Levels: "debug, INFO"}}},
+		{name: "dedup", opts: LoggerOptions{Dedup: DedupOptions{Interval: time.Second, Levels: "debug,info"}}},
+		{name: "invalid sampling level", opts: LoggerOptions{Sampling: SamplingOptions{Burst: 10, Levels: "verbose"}}, wantErr: true},
+		{name: "sampling of errors", opts: LoggerOptions{Sampling: SamplingOptions{Burst: 10, Levels: "info,error"}}, wantErr: true},
+		{name: "sampling of panic entries", opts: LoggerOptions{Sampling: SamplingOptions{Burst: 10, Levels: "panic"}}, wantErr: true},
+		{name: "dedup of errors", opts: LoggerOptions{Dedup: DedupOptions{Interval: time.Second, Levels: "info,error"}}, wantErr: true},
+		{name: "dedup of fatal entries", opts: LoggerOptions{Dedup: DedupOptions{Interval: time.Second, Levels: "fatal"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := newLogSampling(&tt.opts, zerolog.Nop())
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
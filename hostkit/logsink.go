@@ -0,0 +1,323 @@
+package hostkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logSink is one log output, with its own minimum level and format.
+//
+// The entries are always produced as JSON. Sinks with console format convert each entry with a zerolog.ConsoleWriter.
+// The minimum level is applied after the logger levels, so a sink can only log less than the logger, not more.
+type logSink struct {
+	out     zerolog.LevelWriter
+	level   zerolog.Level
+	console *zerolog.ConsoleWriter
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s *logSink) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	// Entries without a level, such as those from the global logger with Print, are always written.
+	if level != zerolog.NoLevel && level < s.level {
+		return len(p), nil
+	}
+
+	out := p
+
+	if s.console != nil {
+		var buf bytes.Buffer
+
+		console := *s.console
+		console.Out = &buf
+
+		if _, err := console.Write(p); err != nil {
+			return 0, err
+		}
+
+		out = buf.Bytes()
+	}
+
+	if _, err := s.out.WriteLevel(level, out); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// FileSinkOptions contains the options for the rotating file sink.
+type FileSinkOptions struct {
+	// Path is the log file path.
+	Path string
+
+	// MaxSizeMB is the size at which the file is rotated.
+	MaxSizeMB int
+
+	// MaxAgeDays is the age at which rotated files are removed. Zero means no age limit.
+	MaxAgeDays int
+
+	// MaxBackups is the number of rotated files to keep. Zero means no count limit.
+	MaxBackups int
+
+	// Compress gzips the rotated files.
+	Compress bool
+
+	// Level is the minimum level written to the file. Empty means everything the logger emits.
+	Level string
+
+	// JSON selects JSON output. Otherwise the console format is used, without colors.
+	JSON bool
+}
+
+// SyslogSinkOptions contains the options for the syslog sink.
+type SyslogSinkOptions struct {
+	// Network and Addr are the syslog server address. The local syslog socket is used if both are empty.
+	Network string
+	Addr    string
+
+	// Tag is the syslog tag.
+	Tag string
+
+	// Level is the minimum level written to syslog. Empty means everything the logger emits.
+	Level string
+
+	// JSON selects JSON output. Otherwise the console format is used, without colors.
+	JSON bool
+}
+
+// logOutput is the output of a root logger: the sinks that write the zerolog entries, and the optional slog sink.
+type logOutput struct {
+	writer zerolog.LevelWriter
+	slog   *slogSink
+}
+
+// newLogOutput creates the log sinks in the options. Each entry is written to all sinks.
+func newLogOutput(opts *LoggerOptions) (*logOutput, error) {
+	names := opts.Sinks
+	if len(names) == 0 {
+		names = []string{"stderr"}
+	}
+
+	output := &logOutput{}
+	sinks := []io.Writer{}
+
+	for _, name := range names {
+		var sink *logSink
+		var err error
+
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "":
+			continue
+		case "stderr":
+			sink, err = newLogSink(zerolog.LevelWriterAdapter{Writer: os.Stderr}, "stderr", opts.StderrLevel, opts.JSON, false)
+		case "file":
+			sink, err = newFileLogSink(&opts.File)
+		case "syslog":
+			sink, err = newSyslogLogSink(&opts.Syslog)
+		case "slog":
+			output.slog, err = newSlogLogSink(&opts.Slog)
+		default:
+			err = fmt.Errorf("unknown log sink '%s' (expected stderr, file, syslog or slog)", name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if sink != nil {
+			sinks = append(sinks, sink)
+		}
+	}
+
+	if len(sinks) == 0 && output.slog == nil {
+		return nil, errors.New("at least one log sink must be configured")
+	}
+
+	output.writer = zerolog.MultiLevelWriter(sinks...)
+
+	return output, nil
+}
+
+// newFileLogSink creates a sink that writes to a file, which is rotated when it reaches the maximum size.
+// Rotated files are removed when there are too many of them, or when they are too old.
+func newFileLogSink(opts *FileSinkOptions) (*logSink, error) {
+	if opts.Path == "" {
+		return nil, errors.New("a path must be set for the file log sink")
+	}
+
+	out := &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    opts.MaxSizeMB,
+		MaxAge:     opts.MaxAgeDays,
+		MaxBackups: opts.MaxBackups,
+		Compress:   opts.Compress,
+	}
+
+	return newLogSink(zerolog.LevelWriterAdapter{Writer: out}, "file", opts.Level, opts.JSON, true)
+}
+
+// SlogSinkOptions contains the options for the slog sink.
+type SlogSinkOptions struct {
+	// Handler receives the log entries.
+	Handler slog.Handler
+
+	// Level is the minimum level written to the handler. Empty means everything the logger emits.
+	Level string
+}
+
+// slogSink forwards the entries to a slog.Handler.
+//
+// The Logger passes its entries to the sink with typed attributes, mapped like in Logger.WithField, after the levels,
+// the redaction, the sampler and the deduper. Entries written with zerolog directly, i.e. by the global logger and the
+// deduper reports, only have string and number fields, and are converted from their JSON form by the json writer.
+type slogSink struct {
+	logger *SlogLogger
+	level  zerolog.Level
+	json   *logSink
+}
+
+// newSlogLogSink creates a sink that forwards the entries to a slog.Handler.
+func newSlogLogSink(opts *SlogSinkOptions) (*slogSink, error) {
+	if opts.Handler == nil {
+		return nil, errors.New("a handler must be set for the slog log sink")
+	}
+
+	json, err := newLogSink(&slogWriter{handler: opts.Handler}, "slog", opts.Level, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slogSink{logger: NewSlogLogger(opts.Handler), level: json.level, json: json}, nil
+}
+
+// slogWriter converts JSON log entries to slog records. It is only used for entries written with zerolog directly.
+//
+// The fields become attributes with their JSON types: strings, bools, numbers (int64 if integral, otherwise float64),
+// and maps and slices for objects and arrays.
+type slogWriter struct {
+	handler slog.Handler
+}
+
+func (w *slogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *slogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var entry map[string]any
+
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&entry); err != nil {
+		return 0, fmt.Errorf("failed to decode log entry: %w", err)
+	}
+
+	message, _ := entry[zerolog.MessageFieldName].(string)
+
+	timestamp := time.Now()
+	if ts, ok := entry[zerolog.TimestampFieldName].(string); ok {
+		if t, err := time.Parse(zerolog.TimeFieldFormat, ts); err == nil {
+			timestamp = t
+		}
+	}
+
+	delete(entry, zerolog.MessageFieldName)
+	delete(entry, zerolog.TimestampFieldName)
+	delete(entry, zerolog.LevelFieldName)
+
+	record := slog.NewRecord(timestamp, slogLevel(level), message, 0)
+
+	for _, key := range slices.Sorted(maps.Keys(entry)) {
+		record.AddAttrs(slog.Any(key, jsonValue(entry[key])))
+	}
+
+	if err := w.handler.Handle(context.Background(), record); err != nil {
+		return 0, fmt.Errorf("failed to handle log entry: %w", err)
+	}
+
+	return len(p), nil
+}
+
+// slogLevel maps a zerolog level to the nearest slog level.
+func slogLevel(level zerolog.Level) slog.Level {
+	switch {
+	case level == zerolog.NoLevel:
+		return slog.LevelInfo
+	case level <= zerolog.DebugLevel:
+		return slog.LevelDebug
+	case level == zerolog.InfoLevel:
+		return slog.LevelInfo
+	case level == zerolog.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// jsonValue converts the JSON numbers in a decoded value to int64 or float64.
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+
+		return v
+	default:
+		return value
+	}
+}
+
+// newLogSink creates a sink with the given minimum level. Plain sinks are written to files and syslog rather than
+// a terminal, so their console format has no colors and full timestamps.
+func newLogSink(out zerolog.LevelWriter, name, level string, json, plain bool) (*logSink, error) {
+	sink := &logSink{out: out, level: zerolog.TraceLevel}
+
+	if level != "" {
+		var err error
+
+		if sink.level, err = parseLogLevel(strings.ToLower(level)); err != nil {
+			return nil, fmt.Errorf("invalid %s log sink level: %w", name, err)
+		}
+	}
+
+	if !json {
+		sink.console = &zerolog.ConsoleWriter{}
+
+		if plain {
+			sink.console.NoColor = true
+			sink.console.TimeFormat = time.RFC3339
+		}
+	}
+
+	return sink, nil
+}
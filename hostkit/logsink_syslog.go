@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+
+package hostkit
+
+import (
+	"fmt"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// newSyslogLogSink creates a sink that writes to syslog, with the syslog severity set from the entry level.
+func newSyslogLogSink(opts *SyslogSinkOptions) (*logSink, error) {
+	out, err := syslog.Dial(opts.Network, opts.Addr, syslog.LOG_INFO|syslog.LOG_DAEMON, opts.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return newLogSink(zerolog.SyslogLevelWriter(out), "syslog", opts.Level, opts.JSON, true)
+}
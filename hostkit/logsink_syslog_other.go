@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package hostkit
+
+import (
+	"errors"
+)
+
+// newSyslogLogSink returns an error, since log/syslog is not available on this platform.
+func newSyslogLogSink(*SyslogSinkOptions) (*logSink, error) {
+	return nil, errors.New("the syslog log sink is not supported on this platform")
+}
@@ -0,0 +1,95 @@
+//go:build !windows && !plan9
+
+package hostkit
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogLogSink(t *testing.T) {
+	tests := []struct {
+		name         string
+		json         bool
+		level        string
+		wantMessages []string
+		wantPriority string
+	}{
+		{
+			name:         "json with severity from the entry level",
+			json:         true,
+			wantMessages: []string{`"message":"info entry"`, `"message":"error entry"`},
+			// LOG_DAEMON (3) * 8 + LOG_INFO (6) for the first entry.
+			wantPriority: "<30>",
+		},
+		{
+			name:         "console format",
+			wantMessages: []string{"INF info entry", "ERR error entry"},
+			wantPriority: "<30>",
+		},
+		{
+			name:         "minimum level",
+			json:         true,
+			level:        "error",
+			wantMessages: []string{`"message":"error entry"`},
+			// LOG_DAEMON (3) * 8 + LOG_ERR (3).
+			wantPriority: "<27>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := filepath.Join(t.TempDir(), "syslog.sock")
+
+			conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+			if err != nil {
+				t.Fatalf("failed to listen on unix socket: %s", err)
+			}
+
+			defer conn.Close()
+
+			sinks, err := newLogOutput(&LoggerOptions{
+				Sinks:  []string{"syslog"},
+				Syslog: SyslogSinkOptions{Network: "unixgram", Addr: addr, Tag: "slackmgr-test", JSON: tt.json, Level: tt.level},
+			})
+			if err != nil {
+				t.Fatalf("failed to create syslog sink: %s", err)
+			}
+
+			logger, err := newLogger(&LoggerOptions{}, sinks)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.Info("info entry")
+			logger.Error("error entry")
+
+			messages := make([]string, 0, len(tt.wantMessages))
+			buf := make([]byte, 64*1024)
+
+			for range tt.wantMessages {
+				_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+				n, err := conn.Read(buf)
+				if err != nil {
+					t.Fatalf("failed to read syslog message: %s", err)
+				}
+
+				messages = append(messages, string(buf[:n]))
+			}
+
+			if !strings.HasPrefix(messages[0], tt.wantPriority) {
+				t.Errorf("got message %q, want priority %s", messages[0], tt.wantPriority)
+			}
+
+			for i, want := range tt.wantMessages {
+				if !strings.Contains(messages[i], "slackmgr-test") || !strings.Contains(messages[i], want) {
+					t.Errorf("message %d: got %q, want the tag and %q", i, messages[i], want)
+				}
+			}
+		})
+	}
+}
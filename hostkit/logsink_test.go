@@ -0,0 +1,181 @@
+package hostkit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileLogSink(t *testing.T) {
+	tests := []struct {
+		name     string
+		json     bool
+		level    string
+		wantIn   []string
+		wantOut  []string
+		wantJSON bool
+	}{
+		{
+			name:     "json",
+			json:     true,
+			wantIn:   []string{`"message":"info entry"`, `"message":"error entry"`},
+			wantJSON: true,
+		},
+		{
+			name:    "console without colors",
+			wantIn:  []string{"INF info entry", "ERR error entry"},
+			wantOut: []string{"\x1b["},
+		},
+		{
+			name:    "minimum level",
+			json:    true,
+			level:   "error",
+			wantIn:  []string{`"message":"error entry"`},
+			wantOut: []string{"info entry"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "slackmgr.log")
+
+			sinks, err := newLogOutput(&LoggerOptions{
+				Sinks: []string{"file"},
+				File:  FileSinkOptions{Path: path, MaxSizeMB: 1, JSON: tt.json, Level: tt.level},
+			})
+			if err != nil {
+				t.Fatalf("failed to create file sink: %s", err)
+			}
+
+			logger, err := newLogger(&LoggerOptions{}, sinks)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			logger.Info("info entry")
+			logger.Error("error entry")
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read log file: %s", err)
+			}
+
+			for _, want := range tt.wantIn {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("log file doesn't contain %q:\n%s", want, data)
+				}
+			}
+
+			for _, unwanted := range tt.wantOut {
+				if strings.Contains(string(data), unwanted) {
+					t.Errorf("log file contains %q:\n%s", unwanted, data)
+				}
+			}
+
+			if tt.wantJSON && !strings.HasPrefix(string(data), "{") {
+				t.Errorf("log file is not JSON:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestFileLogSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slackmgr.log")
+
+	sinks, err := newLogOutput(&LoggerOptions{
+		Sinks: []string{"file"},
+		File:  FileSinkOptions{Path: path, MaxSizeMB: 1, MaxBackups: 2, JSON: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := newLogger(&LoggerOptions{}, sinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write about 3 MB, so that the file is rotated at least twice.
+	line := strings.Repeat("x", 1024)
+
+	for range 3 * 1024 {
+		logger.Info(line)
+	}
+
+	// Old backups are removed in the background, so wait for the current file plus at most MaxBackups rotated files.
+	var files []string
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		files, err = filepath.Glob(filepath.Join(dir, "slackmgr*.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(files) <= 3 || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(files) < 2 || len(files) > 3 {
+		t.Errorf("got %d log files, want the current file and up to 2 backups: %v", len(files), files)
+	}
+}
+
+func TestLogOutputFanOut(t *testing.T) {
+	dir := t.TempDir()
+	errorsPath := filepath.Join(dir, "errors.log")
+
+	sinks, err := newLogOutput(&LoggerOptions{
+		Sinks:       []string{"stderr", " FILE "},
+		StderrLevel: "error",
+		File:        FileSinkOptions{Path: errorsPath, MaxSizeMB: 1, JSON: true, Level: "error"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := newLogger(&LoggerOptions{}, sinks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("not written")
+	logger.Error("written")
+
+	data, err := os.ReadFile(errorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "not written") || !strings.Contains(string(data), "written") {
+		t.Errorf("unexpected log file content:\n%s", data)
+	}
+}
+
+func TestLogOutputErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts LoggerOptions
+	}{
+		{name: "unknown sink", opts: LoggerOptions{Sinks: []string{"kafka"}}},
+		{name: "no sinks", opts: LoggerOptions{Sinks: []string{" ", ""}}},
+		{name: "file sink without path", opts: LoggerOptions{Sinks: []string{"file"}}},
+		{name: "slog sink without handler", opts: LoggerOptions{Sinks: []string{"slog"}}},
+		{name: "invalid level", opts: LoggerOptions{Sinks: []string{"stderr"}, StderrLevel: "loud"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newLogOutput(&tt.opts); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package natsqueue
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// validName matches the stream names, consumer names and Slack channel IDs that can be used as a NATS subject token
+// and in a consumer name.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Option configures a Queue.
+type Option func(*options)
+
+type options struct {
+	consumerName      string
+	ackWait           time.Duration
+	nakBackoff        []time.Duration
+	refreshInterval   time.Duration
+	duplicatesWindow  time.Duration
+	inactiveThreshold time.Duration
+	idleTimeout       time.Duration
+	replicas          int
+}
+
+func newOptions() *options {
+	return &options{
+		consumerName:      "slack-manager",
+		ackWait:           2 * time.Minute,
+		nakBackoff:        []time.Duration{time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second, time.Minute},
+		refreshInterval:   5 * time.Second,
+		duplicatesWindow:  5 * time.Minute,
+		inactiveThreshold: 24 * time.Hour,
+		idleTimeout:       10 * time.Minute,
+		replicas:          1,
+	}
+}
+
+// WithConsumerName sets the prefix of the durable consumer names. Each channel has a durable consumer named
+// "<prefix>_<channel ID>". All replicas of the host must use the same prefix. Defaults to "slack-manager".
+func WithConsumerName(name string) Option {
+	return func(o *options) { o.consumerName = name }
+}
+
+// WithAckWait sets how long a delivered message may go without an ack or nack before it is delivered again,
+// for example because the consumer crashed. Defaults to 2 minutes.
+func WithAckWait(d time.Duration) Option {
+	return func(o *options) { o.ackWait = d }
+}
+
+// WithNakBackoff sets the redelivery delays after a nack. The first nack of a message waits for the first delay,
+// the second nack for the second delay, and so on. The last delay is repeated.
+// Defaults to 1s, 5s, 15s, 30s and 1m.
+func WithNakBackoff(delays ...time.Duration) Option {
+	return func(o *options) { o.nakBackoff = delays }
+}
+
+// WithRefreshInterval sets how often the stream is checked for channels that were written to by other processes.
+// Channels written to by this process are picked up immediately. Defaults to 5 seconds.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(o *options) { o.refreshInterval = d }
+}
+
+// WithDuplicatesWindow sets the window in which messages with the same dedup ID are stored only once.
+// Defaults to 5 minutes.
+func WithDuplicatesWindow(d time.Duration) Option {
+	return func(o *options) { o.duplicatesWindow = d }
+}
+
+// WithInactiveThreshold sets how long a channel consumer may go unused before the server deletes it. A consumer is
+// unused once no process consumes from it, after its channel has been idle for the idle timeout. Defaults to 24 hours.
+func WithInactiveThreshold(d time.Duration) Option {
+	return func(o *options) { o.inactiveThreshold = d }
+}
+
+// WithChannelIdleTimeout sets how long a channel may go without messages before this process stops consuming from it,
+// so that the consumers and goroutines of idle channels don't pile up. Consuming starts again as soon as the channel
+// gets a new message. Defaults to 10 minutes.
+func WithChannelIdleTimeout(d time.Duration) Option {
+	return func(o *options) { o.idleTimeout = d }
+}
+
+// WithReplicas sets the number of stream replicas in a clustered server. Defaults to 1.
+func WithReplicas(n int) Option {
+	return func(o *options) { o.replicas = n }
+}
+
+func (o *options) validate() error {
+	if !validName.MatchString(o.consumerName) {
+		return fmt.Errorf("invalid consumer name %q", o.consumerName)
+	}
+
+	if o.ackWait < time.Second {
+		return errors.New("ack wait must be at least 1 second")
+	}
+
+	if len(o.nakBackoff) == 0 {
+		return errors.New("nak backoff must have at least one delay")
+	}
+
+	for _, delay := range o.nakBackoff {
+		if delay <= 0 {
+			return errors.New("nak backoff delays must be positive")
+		}
+	}
+
+	if o.refreshInterval < 100*time.Millisecond {
+		return errors.New("refresh interval must be at least 100 milliseconds")
+	}
+
+	if o.duplicatesWindow <= 0 {
+		return errors.New("duplicates window must be positive")
+	}
+
+	if o.inactiveThreshold < time.Minute {
+		return errors.New("inactive threshold must be at least 1 minute")
+	}
+
+	if o.idleTimeout < o.refreshInterval {
+		return errors.New("channel idle timeout must be at least the refresh interval")
+	}
+
+	if o.replicas < 1 || o.replicas > 5 {
+		return errors.New("replicas must be between 1 and 5")
+	}
+
+	return nil
+}
+
+// nakDelay returns the redelivery delay for a message that has been delivered the given number of times.
+func (o *options) nakDelay(numDelivered uint64) time.Duration {
+	i := int(min(numDelivered, uint64(len(o.nakBackoff)))) - 1 // #nosec G115 -- bounded by len(o.nakBackoff)
+
+	return o.nakBackoff[max(i, 0)]
+}
@@ -0,0 +1,393 @@
+// Package natsqueue is a FIFO queue (manager.FifoQueue) on NATS JetStream.
+//
+// Each queue is a work queue stream, with one subject per Slack channel: "<stream>.<channel ID>". Each channel has
+// its own durable pull consumer, filtered on the channel subject, with at most one unacknowledged message. Messages
+// are therefore processed in order per channel, also across host replicas that share the consumers, while the
+// channels are processed in parallel. A nacked message is redelivered after a backoff delay, before any later
+// message in the same channel. Messages with the same dedup ID are stored once within the duplicates window.
+// The queue is a hostkit.HeaderFifoQueue, which sends the headers of each message as NATS message headers.
+//
+// There is one durable consumer per channel that has had messages, so the number of consumers grows with the number of
+// channels. A process stops consuming from a channel once it has been idle for the channel idle timeout, and the server
+// deletes the consumer once it has been unused for the inactive threshold, so only the consumers of recently active
+// channels remain. The JetStream account limits on consumers per stream still apply.
+package natsqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+// ackTimeout is the longest time to wait for the server to confirm an ack.
+const ackTimeout = 5 * time.Second
+
+// errChannelIdle is returned by consumeChannelOnce when the channel has been idle for the channel idle timeout.
+var errChannelIdle = errors.New("channel idle")
+
+// Queue is a FIFO queue on a JetStream stream.
+type Queue struct {
+	js          jetstream.JetStream
+	name        string
+	logger      types.Logger
+	opts        *options
+	stream      jetstream.Stream
+	initialized bool
+	channelsMu  sync.Mutex
+	channels    map[string]struct{}
+	notifyCh    chan struct{}
+}
+
+// New returns a queue on the named stream. Init must be called before the queue is used.
+func New(js jetstream.JetStream, streamName string, logger types.Logger, opts ...Option) *Queue {
+	o := newOptions()
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return &Queue{
+		js:       js,
+		name:     streamName,
+		logger:   logger.WithField("queue_name", streamName),
+		opts:     o,
+		channels: map[string]struct{}{},
+		notifyCh: make(chan struct{}, 1),
+	}
+}
+
+// Init validates the options, and creates the stream, or updates its configuration if it already exists.
+func (q *Queue) Init(ctx context.Context) (*Queue, error) {
+	if q.initialized {
+		return q, nil
+	}
+
+	if !validName.MatchString(q.name) {
+		return nil, fmt.Errorf("invalid stream name %q", q.name)
+	}
+
+	if err := q.opts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid NATS queue options: %w", err)
+	}
+
+	stream, err := q.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       q.name,
+		Subjects:   []string{q.name + ".>"},
+		Retention:  jetstream.WorkQueuePolicy,
+		Storage:    jetstream.FileStorage,
+		Duplicates: q.opts.duplicatesWindow,
+		Replicas:   q.opts.replicas,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create or update stream %s: %w", q.name, err)
+	}
+
+	q.stream = stream
+	q.initialized = true
+
+	q.logger.Info("NATS JetStream queue initialized")
+
+	return q, nil
+}
+
+// Name returns the name of the queue, which is the name of the stream.
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// Send publishes a message to the subject of the Slack channel. The dedup ID, if set, is used as the JetStream
+// message ID, so that the server stores a message only once within the duplicates window.
+func (q *Queue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.SendWithHeaders(ctx, slackChannelID, dedupID, body, nil)
+}
+
+// SendWithHeaders publishes a message like Send, with the headers as NATS message headers.
+func (q *Queue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	if !q.initialized {
+		return errors.New("NATS queue not initialized")
+	}
+
+	if !validName.MatchString(slackChannelID) {
+		return fmt.Errorf("invalid Slack channel ID %q", slackChannelID)
+	}
+
+	msg := nats.NewMsg(q.subject(slackChannelID))
+	msg.Data = []byte(body)
+
+	for key, value := range headers {
+		msg.Header.Set(key, value)
+	}
+
+	var opts []jetstream.PublishOpt
+
+	if dedupID != "" {
+		opts = append(opts, jetstream.WithMsgID(dedupID))
+	}
+
+	if _, err := q.js.PublishMsg(ctx, msg, opts...); err != nil {
+		return fmt.Errorf("failed to publish message to %s: %w", q.subject(slackChannelID), err)
+	}
+
+	if q.addChannel(slackChannelID) {
+		select {
+		case q.notifyCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Receive consumes messages from all channels until the context is canceled, and sends them to the sink channel.
+// Channels are discovered from the stream every refresh interval, and immediately when this process sends to them.
+// The sink channel is closed when Receive returns.
+func (q *Queue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+// ReceiveWithHeaders consumes messages like Receive, with their NATS message headers.
+// The sink channel is closed when ReceiveWithHeaders returns.
+func (q *Queue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	defer close(sinkCh)
+
+	if !q.initialized {
+		return errors.New("NATS queue not initialized")
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	consuming := map[string]bool{}
+	idleCh := make(chan string)
+
+	ticker := time.NewTicker(q.opts.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.refreshChannels(ctx); err != nil && ctx.Err() == nil {
+			q.logger.Errorf("Failed to refresh channels: %v", err)
+		}
+
+		for _, channelID := range q.knownChannels() {
+			if !consuming[channelID] {
+				consuming[channelID] = true
+
+				wg.Go(func() { q.consumeChannel(ctx, channelID, sinkCh, idleCh) })
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-q.notifyCh:
+		case channelID := <-idleCh:
+			delete(consuming, channelID)
+		}
+	}
+}
+
+// consumeChannel consumes the messages of one channel until the context is canceled, or until the channel has been
+// idle for the channel idle timeout. An idle channel is removed from the known channels, and sent to the idle channel.
+// Consumer errors are logged, and the consumer is recreated after the refresh interval.
+func (q *Queue) consumeChannel(ctx context.Context, channelID string, sinkCh chan<- *hostkit.FifoQueueMessage, idleCh chan<- string) {
+	logger := q.logger.WithField("channel_id", channelID)
+
+	for {
+		err := q.consumeChannelOnce(ctx, channelID, sinkCh)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, errChannelIdle) {
+			q.removeChannel(channelID)
+
+			select {
+			case idleCh <- channelID:
+			case <-ctx.Done():
+			}
+
+			return
+		}
+
+		logger.Errorf("Channel consumer failed, retrying: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(q.opts.refreshInterval):
+		}
+	}
+}
+
+func (q *Queue) consumeChannelOnce(ctx context.Context, channelID string, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	consumer, err := q.js.CreateOrUpdateConsumer(ctx, q.name, jetstream.ConsumerConfig{
+		Durable:           q.opts.consumerName + "_" + channelID,
+		FilterSubject:     q.subject(channelID),
+		AckPolicy:         jetstream.AckExplicitPolicy,
+		AckWait:           q.opts.ackWait,
+		MaxAckPending:     1,
+		InactiveThreshold: q.opts.inactiveThreshold,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	idleSince := time.Now()
+
+	for {
+		// Each pull waits for at most the refresh interval, so that an idle channel is noticed.
+		fetchCtx, cancel := context.WithTimeout(ctx, q.opts.refreshInterval)
+		msg, err := consumer.Next(jetstream.FetchContext(fetchCtx))
+		cancel()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+			if time.Since(idleSince) >= q.opts.idleTimeout {
+				return errChannelIdle
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to receive message: %w", err)
+		}
+
+		item, err := q.newItem(channelID, msg)
+		if err != nil {
+			q.logger.WithField("channel_id", channelID).Errorf("Dropping unreadable message: %v", err)
+			_ = msg.Term()
+
+			continue
+		}
+
+		select {
+		case sinkCh <- item:
+			idleSince = time.Now()
+		case <-ctx.Done():
+			item.Item.Nack()
+			return ctx.Err()
+		}
+	}
+}
+
+// newItem wraps a JetStream message in a queue item, with the message headers. The ack waits for the server to confirm
+// it, while the nack asks the server to redeliver the message after the backoff delay for its delivery count.
+func (q *Queue) newItem(channelID string, msg jetstream.Msg) (*hostkit.FifoQueueMessage, error) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message metadata: %w", err)
+	}
+
+	logger := q.logger.WithField("channel_id", channelID).WithField("message_id", meta.Sequence.Stream)
+
+	var once sync.Once
+
+	ack := func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+			defer cancel()
+
+			if err := msg.DoubleAck(ctx); err != nil {
+				logger.Errorf("Failed to acknowledge message: %v", err)
+			}
+		})
+	}
+
+	nack := func() {
+		once.Do(func() {
+			if err := msg.NakWithDelay(q.opts.nakDelay(meta.NumDelivered)); err != nil {
+				logger.Errorf("Failed to nack message: %v", err)
+			}
+		})
+	}
+
+	var headers map[string]string
+
+	if len(msg.Headers()) > 0 {
+		headers = make(map[string]string, len(msg.Headers()))
+
+		for key := range msg.Headers() {
+			headers[key] = msg.Headers().Get(key)
+		}
+	}
+
+	item := &types.FifoQueueItem{
+		MessageID:        strconv.FormatUint(meta.Sequence.Stream, 10),
+		SlackChannelID:   channelID,
+		ReceiveTimestamp: time.Now(),
+		Body:             string(msg.Data()),
+		Ack:              ack,
+		Nack:             nack,
+	}
+
+	return &hostkit.FifoQueueMessage{Item: item, Headers: headers}, nil
+}
+
+// refreshChannels adds the channels that have messages in the stream to the known channels.
+func (q *Queue) refreshChannels(ctx context.Context) error {
+	info, err := q.stream.Info(ctx, jetstream.WithSubjectFilter(q.name+".>"))
+	if err != nil {
+		return fmt.Errorf("failed to read stream info: %w", err)
+	}
+
+	for subject := range info.State.Subjects {
+		if channelID, ok := strings.CutPrefix(subject, q.name+"."); ok && validName.MatchString(channelID) {
+			q.addChannel(channelID)
+		}
+	}
+
+	return nil
+}
+
+// addChannel adds the channel to the known channels, and returns true if it wasn't known before.
+func (q *Queue) addChannel(channelID string) bool {
+	q.channelsMu.Lock()
+	defer q.channelsMu.Unlock()
+
+	if _, ok := q.channels[channelID]; ok {
+		return false
+	}
+
+	q.channels[channelID] = struct{}{}
+
+	return true
+}
+
+// removeChannel removes the channel from the known channels, until it is added again by a send or a refresh.
+func (q *Queue) removeChannel(channelID string) {
+	q.channelsMu.Lock()
+	defer q.channelsMu.Unlock()
+
+	delete(q.channels, channelID)
+}
+
+func (q *Queue) knownChannels() []string {
+	q.channelsMu.Lock()
+	defer q.channelsMu.Unlock()
+
+	return slices.Sorted(maps.Keys(q.channels))
+}
+
+func (q *Queue) subject(channelID string) string {
+	return q.name + "." + channelID
+}
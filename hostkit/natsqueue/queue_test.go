@@ -0,0 +1,206 @@
+package natsqueue
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/queueconformance"
+	"github.com/slackmgr/types"
+)
+
+// newTestJetStream starts an embedded NATS server with JetStream, with its storage in a temporary directory, and
+// returns a JetStream context on it. The server is shut down when the test ends.
+func newTestJetStream(t *testing.T) jetstream.JetStream {
+	t.Helper()
+
+	server, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      natsserver.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Start()
+	t.Cleanup(server.Shutdown)
+
+	if !server.ReadyForConnections(10 * time.Second) {
+		t.Fatal("the embedded NATS server did not start in time")
+	}
+
+	conn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(conn.Close)
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return js
+}
+
+// newTestQueue creates and initializes a queue on the stream, with a short refresh interval.
+func newTestQueue(t *testing.T, js jetstream.JetStream, streamName string, opts ...Option) *Queue {
+	t.Helper()
+
+	opts = append([]Option{WithRefreshInterval(100 * time.Millisecond)}, opts...)
+
+	queue, err := New(js, streamName, &types.NoopLogger{}, opts...).Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return queue
+}
+
+// receiver receives from the queue until the test ends, and returns the sink channel.
+func receiver(t *testing.T, queue *Queue) <-chan *hostkit.FifoQueueMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sinkCh := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.ReceiveWithHeaders(ctx, sinkCh) }()
+
+	t.Cleanup(func() {
+		cancel()
+		<-errCh
+	})
+
+	return sinkCh
+}
+
+// expectMessage waits for the next message, and fails the test if it doesn't have the body.
+func expectMessage(t *testing.T, sinkCh <-chan *hostkit.FifoQueueMessage, body string) *hostkit.FifoQueueMessage {
+	t.Helper()
+
+	select {
+	case msg := <-sinkCh:
+		if msg.Item.Body != body {
+			t.Fatalf("got body %q, want %q", msg.Item.Body, body)
+		}
+
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got no message, want %q", body)
+	}
+
+	return nil
+}
+
+func TestQueueConformance(t *testing.T) {
+	js := newTestJetStream(t)
+
+	var streams atomic.Int64
+
+	// Each queue has its own stream, so that each check starts with an empty queue.
+	factory := func(ctx context.Context) (hostkit.FifoQueue, error) {
+		return New(js, fmt.Sprintf("CONFORMANCE_%d", streams.Add(1)), &types.NoopLogger{},
+			WithNakBackoff(time.Second),
+			WithRefreshInterval(time.Second),
+		).Init(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opts := queueconformance.Options{RedeliveryTimeout: 6 * time.Second, Deduplication: true}
+
+	for _, result := range queueconformance.Run(ctx, factory, opts) {
+		if result.Err != nil {
+			t.Errorf("%s: %s", result.Check, result.Err)
+		}
+	}
+}
+
+func TestQueueHeaders(t *testing.T) {
+	queue := newTestQueue(t, newTestJetStream(t), "ALERTS")
+	sinkCh := receiver(t, queue)
+
+	headers := map[string]string{"Traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	if err := queue.SendWithHeaders(context.Background(), "C1", "", "a", headers); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := expectMessage(t, sinkCh, "a")
+	msg.Item.Ack()
+
+	if !maps.Equal(msg.Headers, headers) {
+		t.Errorf("got headers %v, want %v", msg.Headers, headers)
+	}
+}
+
+func TestQueueIdleChannel(t *testing.T) {
+	queue := newTestQueue(t, newTestJetStream(t), "ALERTS", WithChannelIdleTimeout(300*time.Millisecond))
+	sinkCh := receiver(t, queue)
+
+	if err := queue.Send(context.Background(), "C1", "", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectMessage(t, sinkCh, "a").Item.Ack()
+
+	// The channel is idle after the message, so the queue stops consuming from it and forgets it.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for slices.Contains(queue.knownChannels(), "C1") {
+		if time.Now().After(deadline) {
+			t.Fatal("the idle channel is still known")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// A new message in the channel starts consuming from it again.
+	if err := queue.Send(context.Background(), "C1", "", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectMessage(t, sinkCh, "b").Item.Ack()
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "idle timeout below refresh interval", opts: []Option{WithRefreshInterval(time.Second), WithChannelIdleTimeout(500 * time.Millisecond)}, wantErr: true},
+		{name: "inactive threshold below a minute", opts: []Option{WithInactiveThreshold(time.Second)}, wantErr: true},
+		{name: "no nak backoff", opts: []Option{WithNakBackoff()}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions()
+
+			for _, opt := range tt.opts {
+				opt(o)
+			}
+
+			if err := o.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package hostkit
+
+import (
+	"context"
+
+	"github.com/slackmgr/types"
+)
+
+// FifoQueue is the queue interface of the manager (manager.FifoQueue in the core module), repeated here so that
+// the hostkit packages don't import the core module, which only the tests use. Any manager.FifoQueue is a FifoQueue,
+// and the other way around.
+type FifoQueue interface {
+	Name() string
+	Send(ctx context.Context, slackChannelID, dedupID, body string) error
+	Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error
+}
+
+// FifoQueueMessage is an item received from a queue, with the headers that were sent with it.
+type FifoQueueMessage struct {
+	Item    *types.FifoQueueItem
+	Headers map[string]string
+}
+
+// HeaderFifoQueue is a FifoQueue that can send headers with each message, separately from the body, e.g. to
+// propagate a trace context. The core library only uses the FifoQueue methods, so it never sees the headers.
+type HeaderFifoQueue interface {
+	FifoQueue
+
+	// SendWithHeaders sends a message like Send, with the headers.
+	SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error
+
+	// ReceiveWithHeaders receives messages like Receive, with their headers. The sink channel is closed when it returns.
+	ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *FifoQueueMessage) error
+}
+
+// SendWithHeaders sends a message with the headers if the queue is a HeaderFifoQueue. Otherwise the headers are
+// dropped, and the message is sent with Send.
+func SendWithHeaders(ctx context.Context, queue FifoQueue, slackChannelID, dedupID, body string, headers map[string]string) error {
+	if hq, ok := queue.(HeaderFifoQueue); ok {
+		return hq.SendWithHeaders(ctx, slackChannelID, dedupID, body, headers)
+	}
+
+	return queue.Send(ctx, slackChannelID, dedupID, body)
+}
+
+// ReceiveWithHeaders receives messages with their headers if the queue is a HeaderFifoQueue. Otherwise the messages
+// are received with Receive, without headers. The sink channel is closed when the function returns.
+func ReceiveWithHeaders(ctx context.Context, queue FifoQueue, sinkCh chan<- *FifoQueueMessage) error {
+	if hq, ok := queue.(HeaderFifoQueue); ok {
+		return hq.ReceiveWithHeaders(ctx, sinkCh)
+	}
+
+	return ReceiveMessages(ctx, queue, sinkCh, func(item *types.FifoQueueItem) *FifoQueueMessage {
+		return &FifoQueueMessage{Item: item}
+	})
+}
+
+// ReceiveMessages implements ReceiveWithHeaders for a queue wrapper that keeps the headers itself, e.g. next to the
+// body or in the attributes of the backend messages. The items are received from the wrapped queue with Receive, and
+// converted to messages with convert. The sink channel is closed when the function returns.
+func ReceiveMessages(ctx context.Context, queue FifoQueue, sinkCh chan<- *FifoQueueMessage, convert func(*types.FifoQueueItem) *FifoQueueMessage) error {
+	return forwardItems(ctx, queue.Receive, sinkCh, convert, func(item *types.FifoQueueItem) *types.FifoQueueItem { return item })
+}
+
+// ReceiveItems implements Receive for a HeaderFifoQueue, by receiving with ReceiveWithHeaders and dropping the
+// headers. The sink channel is closed when the function returns.
+func ReceiveItems(ctx context.Context, queue HeaderFifoQueue, sinkCh chan<- *types.FifoQueueItem) error {
+	return forwardItems(ctx, queue.ReceiveWithHeaders, sinkCh, func(msg *FifoQueueMessage) *types.FifoQueueItem {
+		return msg.Item
+	}, func(msg *FifoQueueMessage) *types.FifoQueueItem { return msg.Item })
+}
+
+// forwardItems runs receive with an intermediate channel, and forwards the converted values to the sink channel.
+// Values that can't be delivered because the context is canceled are nacked, so that the queue delivers them again.
+func forwardItems[From, To any](ctx context.Context, receive func(context.Context, chan<- From) error, sinkCh chan<- To, convert func(From) To, item func(From) *types.FifoQueueItem) error {
+	defer close(sinkCh)
+
+	ch := make(chan From)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- receive(ctx, ch)
+	}()
+
+	for value := range ch {
+		select {
+		case sinkCh <- convert(value):
+		case <-ctx.Done():
+			if i := item(value); i != nil && i.Nack != nil {
+				i.Nack()
+			}
+		}
+	}
+
+	return <-errCh
+}
@@ -0,0 +1,124 @@
+package hostkit
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+// headerQueue is a HeaderFifoQueue that wraps an in-memory queue, and keeps the headers by message body.
+type headerQueue struct {
+	*types.InMemoryFifoQueue
+
+	headers map[string]map[string]string
+}
+
+func (q *headerQueue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	q.headers[body] = headers
+	return q.Send(ctx, slackChannelID, dedupID, body)
+}
+
+func (q *headerQueue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *FifoQueueMessage) error {
+	return forwardItems(ctx, q.Receive, sinkCh, func(item *types.FifoQueueItem) *FifoQueueMessage {
+		return &FifoQueueMessage{Item: item, Headers: q.headers[item.Body]}
+	}, func(item *types.FifoQueueItem) *types.FifoQueueItem { return item })
+}
+
+// receiveOne sends a message with the headers, and returns the message received with ReceiveWithHeaders.
+func receiveOne(t *testing.T, queue FifoQueue, headers map[string]string) *FifoQueueMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := SendWithHeaders(ctx, queue, "C1", "d1", `{"header": "Disk full"}`, headers); err != nil {
+		t.Fatal(err)
+	}
+
+	sinkCh := make(chan *FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- ReceiveWithHeaders(ctx, queue, sinkCh) }()
+
+	msg, ok := <-sinkCh
+	if !ok {
+		t.Fatalf("the sink channel was closed without a message: %v", <-errCh)
+	}
+
+	msg.Item.Ack()
+	cancel()
+
+	// The sink channel is closed when the receiver returns.
+	for range sinkCh {
+		t.Error("got an unexpected second message")
+	}
+
+	return msg
+}
+
+func TestReceiveWithHeaders(t *testing.T) {
+	headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	tests := []struct {
+		name        string
+		queue       FifoQueue
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "queue with headers",
+			queue:       &headerQueue{InMemoryFifoQueue: types.NewInMemoryFifoQueue("alerts", 10, time.Second), headers: map[string]map[string]string{}},
+			wantHeaders: headers,
+		},
+		{
+			name:  "queue without headers",
+			queue: types.NewInMemoryFifoQueue("alerts", 10, time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := receiveOne(t, tt.queue, headers)
+
+			if msg.Item.Body != `{"header": "Disk full"}` {
+				t.Errorf("got body %s, want the sent body", msg.Item.Body)
+			}
+
+			if !maps.Equal(msg.Headers, tt.wantHeaders) {
+				t.Errorf("got headers %v, want %v", msg.Headers, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func TestForwardItemsNacksOnCancel(t *testing.T) {
+	nacked := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	receive := func(ctx context.Context, sinkCh chan<- *FifoQueueMessage) error {
+		defer close(sinkCh)
+
+		sinkCh <- &FifoQueueMessage{Item: &types.FifoQueueItem{Nack: func() { close(nacked) }}}
+
+		// Nobody reads the sink channel, so the message is nacked once the context is canceled.
+		cancel()
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	if err := forwardItems(ctx, receive, make(chan *types.FifoQueueItem), func(msg *FifoQueueMessage) *types.FifoQueueItem {
+		return msg.Item
+	}, func(msg *FifoQueueMessage) *types.FifoQueueItem { return msg.Item }); err == nil {
+		t.Error("got no error, want the context error")
+	}
+
+	select {
+	case <-nacked:
+	default:
+		t.Error("the message was not nacked")
+	}
+}
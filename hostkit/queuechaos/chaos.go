@@ -0,0 +1,193 @@
+// Package queuechaos wraps a FIFO queue with injected failures: latency, failed sends, dropped messages and
+// duplicate deliveries, like the failure modes of the real queue backends. The conformance checks use it to test
+// consumers under failures, and the flexible host can wrap its manager queues with it to try them out by hand.
+package queuechaos
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+// ErrInjectedSendFailure is returned by Send for the sends that fail on purpose.
+var ErrInjectedSendFailure = errors.New("injected send failure")
+
+// Options sets the failures to inject. The zero value injects nothing.
+type Options struct {
+	// MaxLatency is the maximum random delay added to each send and each delivery.
+	MaxLatency time.Duration
+
+	// SendErrorRate is the fraction of sends that fail with ErrInjectedSendFailure, without sending the message.
+	SendErrorRate float64
+
+	// DropRate is the fraction of received messages that are nacked instead of delivered, like a consumer that
+	// crashed before processing them. Backends that redeliver nacked messages deliver them again later, while
+	// types.InMemoryFifoQueue loses them.
+	DropRate float64
+
+	// DuplicateRate is the fraction of received messages that are delivered twice in a row, like an at-least-once
+	// backend that redelivers a message before the ack arrives. Both copies share the ack and nack of the original,
+	// and only the first ack or nack has any effect.
+	DuplicateRate float64
+
+	// Seed seeds the random failures, for reproducible runs. Zero means a random seed.
+	Seed uint64
+}
+
+// Enabled returns true if the options inject any failures.
+func (o Options) Enabled() bool {
+	return o.MaxLatency > 0 || o.SendErrorRate > 0 || o.DropRate > 0 || o.DuplicateRate > 0
+}
+
+// Queue is a FIFO queue with injected failures.
+type Queue struct {
+	queue hostkit.FifoQueue
+	opts  Options
+	mu    sync.Mutex
+	rand  *rand.Rand
+}
+
+// Wrap wraps the queue with the failures in opts.
+func Wrap(queue hostkit.FifoQueue, opts Options) *Queue {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+
+	return &Queue{
+		queue: queue,
+		opts:  opts,
+		rand:  rand.New(rand.NewPCG(seed, seed)), // #nosec G404 -- failure injection, not security
+	}
+}
+
+// Name returns the name of the wrapped queue.
+func (q *Queue) Name() string {
+	return q.queue.Name()
+}
+
+// Send sends the message to the wrapped queue, after a random delay, unless the send fails on purpose.
+func (q *Queue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.SendWithHeaders(ctx, slackChannelID, dedupID, body, nil)
+}
+
+// SendWithHeaders sends the message like Send, with the headers. The headers are dropped if the wrapped queue
+// isn't a hostkit.HeaderFifoQueue.
+func (q *Queue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	if err := q.delay(ctx); err != nil {
+		return err
+	}
+
+	if q.chance(q.opts.SendErrorRate) {
+		return ErrInjectedSendFailure
+	}
+
+	return hostkit.SendWithHeaders(ctx, q.queue, slackChannelID, dedupID, body, headers)
+}
+
+// Receive receives messages from the wrapped queue, and forwards them to the sink channel with the injected failures.
+// The sink channel is closed when the function returns.
+func (q *Queue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+// ReceiveWithHeaders receives messages like Receive, with their headers. The headers are empty if the wrapped queue
+// isn't a hostkit.HeaderFifoQueue. The sink channel is closed when the function returns.
+func (q *Queue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	defer close(sinkCh)
+
+	innerCh := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- hostkit.ReceiveWithHeaders(ctx, q.queue, innerCh)
+	}()
+
+	for msg := range innerCh {
+		if !q.forward(ctx, msg, sinkCh) {
+			break
+		}
+	}
+
+	// The context is canceled if forward gave up. Nack anything still on its way, until the wrapped queue returns.
+	for msg := range innerCh {
+		msg.Item.Nack()
+	}
+
+	return <-errCh
+}
+
+// forward delivers the message to the sink channel, dropping or duplicating it by chance.
+// It returns false if the context was canceled.
+func (q *Queue) forward(ctx context.Context, msg *hostkit.FifoQueueMessage, sinkCh chan<- *hostkit.FifoQueueMessage) bool {
+	item := msg.Item
+
+	if q.chance(q.opts.DropRate) {
+		item.Nack()
+		return true
+	}
+
+	var once sync.Once
+
+	original := *item
+	original.Ack = func() { once.Do(item.Ack) }
+	original.Nack = func() { once.Do(item.Nack) }
+
+	deliveries := []*hostkit.FifoQueueMessage{{Item: &original, Headers: msg.Headers}}
+
+	if q.chance(q.opts.DuplicateRate) {
+		duplicate := original
+		deliveries = append(deliveries, &hostkit.FifoQueueMessage{Item: &duplicate, Headers: msg.Headers})
+	}
+
+	for _, delivery := range deliveries {
+		if q.delay(ctx) != nil {
+			original.Nack()
+			return false
+		}
+
+		select {
+		case sinkCh <- delivery:
+		case <-ctx.Done():
+			original.Nack()
+			return false
+		}
+	}
+
+	return true
+}
+
+// delay sleeps for a random time up to MaxLatency, or until the context is canceled.
+func (q *Queue) delay(ctx context.Context) error {
+	if q.opts.MaxLatency <= 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	d := time.Duration(q.rand.Int64N(int64(q.opts.MaxLatency)))
+	q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// chance returns true with the given probability.
+func (q *Queue) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.rand.Float64() < rate
+}
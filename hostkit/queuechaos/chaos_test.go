@@ -0,0 +1,267 @@
+package queuechaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+// stubQueue is a queue that records the sent messages, and delivers a fixed list of messages that record their acks
+// and nacks. Receive hands over all the messages before it waits for the context, like a backend that has already
+// fetched them.
+type stubQueue struct {
+	mu       sync.Mutex
+	sent     []string
+	messages []string
+	acks     map[string]int
+	nacks    map[string]int
+}
+
+func newStubQueue(messages ...string) *stubQueue {
+	return &stubQueue{messages: messages, acks: map[string]int{}, nacks: map[string]int{}}
+}
+
+func (q *stubQueue) Name() string {
+	return "stub"
+}
+
+func (q *stubQueue) Send(_ context.Context, _, _, body string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.sent = append(q.sent, body)
+
+	return nil
+}
+
+func (q *stubQueue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	defer close(sinkCh)
+
+	for _, body := range q.messages {
+		sinkCh <- &types.FifoQueueItem{
+			MessageID:      body,
+			SlackChannelID: "C1",
+			Body:           body,
+			Ack:            func() { q.record(q.acks, body) },
+			Nack:           func() { q.record(q.nacks, body) },
+		}
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (q *stubQueue) record(counts map[string]int, body string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	counts[body]++
+}
+
+// counts returns copies of the ack and nack counts by message body.
+func (q *stubQueue) counts() (map[string]int, map[string]int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return maps.Clone(q.acks), maps.Clone(q.nacks)
+}
+
+// waitFor polls the condition until it is true, and fails the test if it doesn't become true within a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startReceive runs Receive on the queue until the returned cancel function is called. The cancel function waits
+// for Receive to return and close the sink channel.
+func startReceive(t *testing.T, queue *Queue) (<-chan *types.FifoQueueItem, func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sinkCh := make(chan *types.FifoQueueItem)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.Receive(ctx, sinkCh) }()
+
+	return sinkCh, func() {
+		cancel()
+
+		for item := range sinkCh {
+			t.Errorf("got unexpected message %q after the context was canceled", item.Body)
+		}
+
+		if err := <-errCh; err != nil {
+			t.Errorf("got error %v from Receive, want none", err)
+		}
+	}
+}
+
+// sendAll sends count messages, and returns the indexes of the sends that failed.
+func sendAll(t *testing.T, queue *Queue, count int) []int {
+	t.Helper()
+
+	var failed []int
+
+	for i := range count {
+		err := queue.Send(context.Background(), "C1", fmt.Sprint(i), fmt.Sprint(i))
+
+		switch {
+		case errors.Is(err, ErrInjectedSendFailure):
+			failed = append(failed, i)
+		case err != nil:
+			t.Fatalf("got error %v from send %d, want none or ErrInjectedSendFailure", err, i)
+		}
+	}
+
+	return failed
+}
+
+func TestSendErrorRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       float64
+		wantFailed func(failed int) bool
+	}{
+		{name: "no failures", rate: 0, wantFailed: func(failed int) bool { return failed == 0 }},
+		{name: "all sends fail", rate: 1, wantFailed: func(failed int) bool { return failed == 100 }},
+		{name: "some sends fail", rate: 0.5, wantFailed: func(failed int) bool { return failed > 20 && failed < 80 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := newStubQueue()
+			failed := sendAll(t, Wrap(inner, Options{SendErrorRate: tt.rate, Seed: 1}), 100)
+
+			if !tt.wantFailed(len(failed)) {
+				t.Errorf("got %d failed sends out of 100 with rate %v", len(failed), tt.rate)
+			}
+
+			// The failed sends never reach the wrapped queue.
+			if got, want := len(inner.sent), 100-len(failed); got != want {
+				t.Errorf("got %d sent messages, want %d", got, want)
+			}
+
+			for _, i := range failed {
+				if slices.Contains(inner.sent, fmt.Sprint(i)) {
+					t.Errorf("message %d was sent although the send failed", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	opts := Options{SendErrorRate: 0.5, Seed: 42}
+
+	first := sendAll(t, Wrap(newStubQueue(), opts), 100)
+	second := sendAll(t, Wrap(newStubQueue(), opts), 100)
+
+	if !slices.Equal(first, second) {
+		t.Errorf("got failed sends %v and %v with the same seed, want the same sends", first, second)
+	}
+}
+
+func TestDropRate(t *testing.T) {
+	inner := newStubQueue("1", "2", "3")
+	sinkCh, stop := startReceive(t, Wrap(inner, Options{DropRate: 1, Seed: 1}))
+
+	// Every message is nacked instead of delivered.
+	waitFor(t, "the dropped messages to be nacked", func() bool {
+		_, nacks := inner.counts()
+		return len(nacks) == 3
+	})
+
+	select {
+	case item := <-sinkCh:
+		t.Errorf("got dropped message %q", item.Body)
+	default:
+	}
+
+	stop()
+
+	acks, nacks := inner.counts()
+	if len(acks) != 0 {
+		t.Errorf("got acks %v for dropped messages, want none", acks)
+	}
+
+	for _, body := range []string{"1", "2", "3"} {
+		if nacks[body] != 1 {
+			t.Errorf("got %d nacks for message %q, want 1", nacks[body], body)
+		}
+	}
+}
+
+func TestDuplicateRate(t *testing.T) {
+	inner := newStubQueue("1", "2")
+	sinkCh, stop := startReceive(t, Wrap(inner, Options{DuplicateRate: 1, Seed: 1}))
+
+	var bodies []string
+
+	for range 4 {
+		item := <-sinkCh
+		bodies = append(bodies, item.Body)
+
+		// The first copy of each message is acked, and the second copy is nacked. Only the ack has any effect.
+		if len(bodies)%2 == 1 {
+			item.Ack()
+		} else {
+			item.Nack()
+			item.Ack()
+		}
+	}
+
+	stop()
+
+	if want := []string{"1", "1", "2", "2"}; !slices.Equal(bodies, want) {
+		t.Errorf("got deliveries %v, want %v", bodies, want)
+	}
+
+	acks, nacks := inner.counts()
+
+	for _, body := range []string{"1", "2"} {
+		if acks[body] != 1 {
+			t.Errorf("got %d acks for message %q, want 1", acks[body], body)
+		}
+	}
+
+	if len(nacks) != 0 {
+		t.Errorf("got nacks %v, want none after the acks", nacks)
+	}
+}
+
+func TestShutdownNacksInFlightMessages(t *testing.T) {
+	inner := newStubQueue("1", "2", "3")
+	sinkCh, stop := startReceive(t, Wrap(inner, Options{}))
+
+	item := <-sinkCh
+	item.Ack()
+
+	// Nothing reads the other messages, so they are still in flight when the receiver stops.
+	stop()
+
+	acks, nacks := inner.counts()
+	if acks["1"] != 1 || nacks["1"] != 0 {
+		t.Errorf("got %d acks and %d nacks for the delivered message, want 1 ack", acks["1"], nacks["1"])
+	}
+
+	for _, body := range []string{"2", "3"} {
+		if nacks[body] != 1 || acks[body] != 0 {
+			t.Errorf("got %d acks and %d nacks for in-flight message %q, want 1 nack", acks[body], nacks[body], body)
+		}
+	}
+}
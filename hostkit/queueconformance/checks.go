@@ -0,0 +1,369 @@
+package queueconformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/queuechaos"
+	"github.com/slackmgr/types"
+)
+
+const (
+	channelA = "C0CONFORMA"
+	channelB = "C0CONFORMB"
+	channelC = "C0CONFORMC"
+
+	// deliveryTimeout is the longest time to wait for a message that is ready to be delivered.
+	// Polling backends deliver messages up to a poll interval late.
+	deliveryTimeout = 10 * time.Second
+
+	// stopTimeout is the longest time Receive may take to return after its context is canceled.
+	stopTimeout = 10 * time.Second
+
+	// quietPeriod is how long to wait for messages that must not be delivered, in queues without redelivery.
+	quietPeriod = 2 * time.Second
+
+	// messagesPerChannel is the number of messages per channel sent by the ordering checks.
+	messagesPerChannel = 10
+
+	// chaosSeed seeds the chaos checks, so that a failure can be reproduced.
+	chaosSeed = 20240617
+)
+
+func checkMessageFields(ctx context.Context, queue hostkit.FifoQueue, _ Options) error {
+	body := "message-" + uuid.NewString()
+
+	if err := queue.Send(ctx, channelA, uuid.NewString(), body); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	r := startReceiver(ctx, queue)
+
+	item, err := r.next(ctx, deliveryTimeout)
+	if err != nil {
+		return stopAfter(r, err)
+	}
+
+	item.Ack()
+
+	switch {
+	case item.MessageID == "":
+		err = errors.New("message ID is empty")
+	case item.SlackChannelID != channelA:
+		err = fmt.Errorf("got channel %q, want %q", item.SlackChannelID, channelA)
+	case item.Body != body:
+		err = fmt.Errorf("got body %q, want %q", item.Body, body)
+	case item.ReceiveTimestamp.IsZero():
+		err = errors.New("receive timestamp is zero")
+	case item.Ack == nil || item.Nack == nil:
+		err = errors.New("ack or nack is nil")
+	}
+
+	return stopAfter(r, err)
+}
+
+func checkFifoPerChannel(ctx context.Context, queue hostkit.FifoQueue, _ Options) error {
+	channels := []string{channelA, channelB, channelC}
+
+	if err := sendInterleaved(ctx, queue, channels, messagesPerChannel); err != nil {
+		return err
+	}
+
+	r := startReceiver(ctx, queue)
+
+	// The consumer must ack each message before the next one in the same channel is delivered by some backends,
+	// so every message is acked as soon as it is received.
+	tracker := newOrderTracker(channels)
+
+	for range len(channels) * messagesPerChannel {
+		item, err := r.next(ctx, deliveryTimeout)
+		if err != nil {
+			return stopAfter(r, fmt.Errorf("after %d messages: %w", tracker.seen, err))
+		}
+
+		item.Ack()
+
+		if err := tracker.add(item, false); err != nil {
+			return stopAfter(r, err)
+		}
+	}
+
+	return stopAfter(r, nil)
+}
+
+func checkAckNoRedelivery(ctx context.Context, queue hostkit.FifoQueue, opts Options) error {
+	if err := sendInterleaved(ctx, queue, []string{channelA}, 2); err != nil {
+		return err
+	}
+
+	r := startReceiver(ctx, queue)
+
+	for i := range 2 {
+		item, err := r.next(ctx, deliveryTimeout)
+		if err != nil {
+			return stopAfter(r, fmt.Errorf("message %d: %w", i, err))
+		}
+
+		item.Ack()
+	}
+
+	// Acked messages must not be delivered again, not even after the redelivery timeout.
+	return stopAfter(r, r.expectNothing(ctx, max(quietPeriod, opts.RedeliveryTimeout)))
+}
+
+func checkNackRedelivery(ctx context.Context, queue hostkit.FifoQueue, opts Options) error {
+	if opts.RedeliveryTimeout <= 0 {
+		return ErrSkipped
+	}
+
+	body := "nacked-" + uuid.NewString()
+
+	if err := queue.Send(ctx, channelA, uuid.NewString(), body); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	r := startReceiver(ctx, queue)
+
+	item, err := r.next(ctx, deliveryTimeout)
+	if err != nil {
+		return stopAfter(r, err)
+	}
+
+	item.Nack()
+
+	redelivered, err := r.next(ctx, opts.RedeliveryTimeout+deliveryTimeout)
+	if err != nil {
+		return stopAfter(r, fmt.Errorf("nacked message was not redelivered: %w", err))
+	}
+
+	redelivered.Ack()
+
+	if redelivered.Body != body {
+		return stopAfter(r, fmt.Errorf("got body %q after nack, want %q", redelivered.Body, body))
+	}
+
+	return stopAfter(r, nil)
+}
+
+func checkDuplicateDedupID(ctx context.Context, queue hostkit.FifoQueue, opts Options) error {
+	body := "duplicate-" + uuid.NewString()
+	dedupID := uuid.NewString()
+
+	for range 2 {
+		if err := queue.Send(ctx, channelA, dedupID, body); err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+	}
+
+	r := startReceiver(ctx, queue)
+
+	want := 2
+	if opts.Deduplication {
+		want = 1
+	}
+
+	for i := range want {
+		item, err := r.next(ctx, deliveryTimeout)
+		if err != nil {
+			return stopAfter(r, fmt.Errorf("delivery %d of %d: %w", i+1, want, err))
+		}
+
+		item.Ack()
+
+		if item.Body != body {
+			return stopAfter(r, fmt.Errorf("got body %q, want %q", item.Body, body))
+		}
+	}
+
+	return stopAfter(r, r.expectNothing(ctx, quietPeriod))
+}
+
+func checkReceiveClosesSink(ctx context.Context, queue hostkit.FifoQueue, _ Options) error {
+	r := startReceiver(ctx, queue)
+
+	// Give Receive time to start polling, so that the cancellation hits a running receiver.
+	select {
+	case <-time.After(quietPeriod):
+	case <-ctx.Done():
+	}
+
+	return r.stop()
+}
+
+// checkChaosLatencyAndDuplicates verifies that a consumer that ignores duplicates sees every message exactly once,
+// in order per channel, when the queue is slow and delivers some messages twice.
+func checkChaosLatencyAndDuplicates(ctx context.Context, queue hostkit.FifoQueue, _ Options) error {
+	chaos := queuechaos.Wrap(queue, queuechaos.Options{
+		MaxLatency:    20 * time.Millisecond,
+		DuplicateRate: 0.3,
+		Seed:          chaosSeed,
+	})
+
+	channels := []string{channelA, channelB, channelC}
+
+	if err := sendInterleaved(ctx, chaos, channels, messagesPerChannel); err != nil {
+		return err
+	}
+
+	r := startReceiver(ctx, chaos)
+	tracker := newOrderTracker(channels)
+
+	for tracker.seen < len(channels)*messagesPerChannel {
+		item, err := r.next(ctx, deliveryTimeout)
+		if err != nil {
+			return stopAfter(r, fmt.Errorf("after %d messages: %w", tracker.seen, err))
+		}
+
+		item.Ack()
+
+		if err := tracker.add(item, true); err != nil {
+			return stopAfter(r, err)
+		}
+	}
+
+	return stopAfter(r, nil)
+}
+
+// checkChaosDrops verifies that every message is delivered eventually when the consumer drops (nacks) some of them.
+// Order is not checked: a backend may deliver newer messages in a channel while a nacked one waits for redelivery.
+func checkChaosDrops(ctx context.Context, queue hostkit.FifoQueue, opts Options) error {
+	if opts.RedeliveryTimeout <= 0 {
+		return ErrSkipped
+	}
+
+	chaos := queuechaos.Wrap(queue, queuechaos.Options{
+		DropRate: 0.3,
+		Seed:     chaosSeed,
+	})
+
+	channels := []string{channelA, channelB}
+	perChannel := messagesPerChannel / 2
+
+	if err := sendInterleaved(ctx, chaos, channels, perChannel); err != nil {
+		return err
+	}
+
+	r := startReceiver(ctx, chaos)
+	tracker := newOrderTracker(channels)
+
+	for tracker.seen < len(channels)*perChannel {
+		item, err := r.next(ctx, opts.RedeliveryTimeout+deliveryTimeout)
+		if err != nil {
+			return stopAfter(r, fmt.Errorf("after %d messages: %w", tracker.seen, err))
+		}
+
+		item.Ack()
+		tracker.mark(item)
+	}
+
+	return stopAfter(r, nil)
+}
+
+// sendInterleaved sends count numbered messages to each channel, round-robin across the channels.
+func sendInterleaved(ctx context.Context, queue hostkit.FifoQueue, channels []string, count int) error {
+	for i := range count {
+		for _, channel := range channels {
+			if err := queue.Send(ctx, channel, uuid.NewString(), messageBody(channel, i)); err != nil {
+				return fmt.Errorf("failed to send message %d to %s: %w", i, channel, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func messageBody(channel string, seq int) string {
+	return channel + "/" + strconv.Itoa(seq)
+}
+
+// orderTracker verifies that the messages from sendInterleaved arrive in order per channel.
+type orderTracker struct {
+	next      map[string]int
+	delivered map[string]bool
+	seen      int
+}
+
+func newOrderTracker(channels []string) *orderTracker {
+	t := &orderTracker{
+		next:      map[string]int{},
+		delivered: map[string]bool{},
+	}
+
+	for _, channel := range channels {
+		t.next[channel] = 0
+	}
+
+	return t
+}
+
+// add records a delivery, and returns an error if it is out of order. Duplicates of the most recent message in
+// the channel are ignored if allowDuplicates is true, and rejected otherwise.
+func (t *orderTracker) add(item *types.FifoQueueItem, allowDuplicates bool) error {
+	channel, seq, err := parseBody(item)
+	if err != nil {
+		return err
+	}
+
+	want, ok := t.next[channel]
+	if !ok {
+		return fmt.Errorf("message %q from unexpected channel %s", item.Body, channel)
+	}
+
+	if allowDuplicates && seq == want-1 {
+		return nil
+	}
+
+	if seq != want {
+		return fmt.Errorf("got message %d in channel %s, want %d", seq, channel, want)
+	}
+
+	t.next[channel]++
+	t.seen++
+
+	return nil
+}
+
+// mark records a delivery without checking the order. Duplicates are ignored.
+func (t *orderTracker) mark(item *types.FifoQueueItem) {
+	if t.delivered[item.Body] {
+		return
+	}
+
+	t.delivered[item.Body] = true
+	t.seen++
+}
+
+func parseBody(item *types.FifoQueueItem) (string, int, error) {
+	channel, seqText, ok := strings.Cut(item.Body, "/")
+	if !ok {
+		return "", 0, fmt.Errorf("unexpected message body %q", item.Body)
+	}
+
+	seq, err := strconv.Atoi(seqText)
+	if err != nil {
+		return "", 0, fmt.Errorf("unexpected message body %q", item.Body)
+	}
+
+	if channel != item.SlackChannelID {
+		return "", 0, fmt.Errorf("message %q delivered with channel %s", item.Body, item.SlackChannelID)
+	}
+
+	return channel, seq, nil
+}
+
+// stopAfter stops the receiver, and returns err, or the error from stopping if err is nil.
+func stopAfter(r *receiver, err error) error {
+	stopErr := r.stop()
+
+	if err != nil {
+		return err
+	}
+
+	return stopErr
+}
@@ -0,0 +1,117 @@
+// Package queueconformance is a conformance suite for FIFO queue implementations (manager.FifoQueue).
+//
+// The checks describe the behaviour that the manager relies on: FIFO ordering per Slack channel, no redelivery of
+// acknowledged messages, redelivery of nacked messages (where the backend supports it), and a sink channel that is
+// closed when Receive returns. The chaos checks wrap the queue with queuechaos, and verify that a consumer that
+// ignores duplicates still sees every message, in order per channel.
+//
+// Behaviour that differs between the backends is described by Options rather than checked. For example,
+// types.InMemoryFifoQueue drops nacked messages and ignores dedup IDs, while SQS redelivers nacked messages after
+// the visibility timeout and deduplicates by dedup ID.
+//
+// Like dbconformance, the suite is a regular package rather than a test helper, so that it can be run against a
+// live backend from a binary.
+package queueconformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit"
+)
+
+// ErrSkipped is returned by checks that don't apply to the queue, given its Options.
+var ErrSkipped = errors.New("check skipped")
+
+// Factory returns an empty queue. It is called once before each check.
+type Factory func(ctx context.Context) (hostkit.FifoQueue, error)
+
+// Options describes the backend-specific behaviour of the queue under test.
+type Options struct {
+	// RedeliveryTimeout is the longest time before a nacked message is delivered again.
+	// Zero means that nacked messages are never delivered again, like in types.InMemoryFifoQueue,
+	// and the checks that depend on redelivery are skipped.
+	RedeliveryTimeout time.Duration
+
+	// Deduplication is true if the queue delivers messages with the same dedup ID only once, like SQS FIFO queues.
+	Deduplication bool
+}
+
+// Check is a single conformance check. It returns an error describing the first deviation it finds,
+// or ErrSkipped if the check doesn't apply.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, queue hostkit.FifoQueue, opts Options) error
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Check    string
+	Err      error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// Checks returns all conformance checks, in the order they are run.
+func Checks() []Check {
+	return []Check{
+		{Name: "message-fields", Run: checkMessageFields},
+		{Name: "fifo-per-channel", Run: checkFifoPerChannel},
+		{Name: "ack-no-redelivery", Run: checkAckNoRedelivery},
+		{Name: "nack-redelivery", Run: checkNackRedelivery},
+		{Name: "duplicate-dedup-id", Run: checkDuplicateDedupID},
+		{Name: "receive-closes-sink", Run: checkReceiveClosesSink},
+		{Name: "chaos-latency-and-duplicates", Run: checkChaosLatencyAndDuplicates},
+		{Name: "chaos-drops", Run: checkChaosDrops},
+	}
+}
+
+// Run runs all checks, each against a queue from the factory, and returns a result per check.
+// It stops early if the context is canceled.
+func Run(ctx context.Context, factory Factory, opts Options) []Result {
+	results := []Result{}
+
+	for _, check := range Checks() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := time.Now()
+		err := runCheck(ctx, factory, opts, check)
+		result := Result{Check: check.Name, Duration: time.Since(start)}
+
+		if errors.Is(err, ErrSkipped) {
+			result.Skipped = true
+		} else {
+			result.Err = err
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Failed returns the number of failed checks in the results.
+func Failed(results []Result) int {
+	failed := 0
+
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+func runCheck(ctx context.Context, factory Factory, opts Options, check Check) error {
+	queue, err := factory(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create queue: %w", err)
+	}
+
+	return check.Run(ctx, queue, opts)
+}
@@ -0,0 +1,83 @@
+package queueconformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+// redisClaimMinIdleTime is the Redis queue claim time: the shortest that the queue accepts, so that nacked messages
+// are redelivered quickly.
+const redisClaimMinIdleTime = 10 * time.Second
+
+// runConformance runs the checks against queues from the factory. Most checks spend their time waiting for
+// redeliveries, so they run concurrently rather than with t.Parallel, which is limited by GOMAXPROCS.
+func runConformance(t *testing.T, factory Factory, opts Options) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	checks := Checks()
+	errs := make([]error, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Go(func() { errs[i] = runCheck(ctx, factory, opts, check) })
+	}
+
+	wg.Wait()
+
+	for i, check := range checks {
+		t.Run(check.Name, func(t *testing.T) {
+			switch {
+			case errors.Is(errs[i], ErrSkipped):
+				t.Skip(errs[i])
+			case errs[i] != nil:
+				t.Error(errs[i])
+			}
+		})
+	}
+}
+
+func TestInMemoryQueue(t *testing.T) {
+	// The in-memory queue drops nacked messages and ignores dedup IDs.
+	runConformance(t, func(context.Context) (hostkit.FifoQueue, error) {
+		return types.NewInMemoryFifoQueue("conformance", 1000, 5*time.Second), nil
+	}, Options{})
+}
+
+func TestRedisQueue(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	var count atomic.Int64
+
+	// Each queue has its own key prefix, so that each check starts with an empty queue. The timings are the
+	// shortest that the queue accepts. Nacked messages are reclaimed once they have been idle for the claim time,
+	// and dedup IDs are ignored.
+	factory := func(context.Context) (hostkit.FifoQueue, error) {
+		return manager.NewRedisFifoQueue(client, manager.NewRedisChannelLocker(client), "conformance", &types.NoopLogger{},
+			manager.WithKeyPrefix(fmt.Sprintf("conformance:%d", count.Add(1))),
+			manager.WithPollInterval(time.Second),
+			manager.WithStreamRefreshInterval(5*time.Second),
+			manager.WithClaimMinIdleTime(redisClaimMinIdleTime),
+			manager.WithLockTTL(30*time.Second),
+		).Init()
+	}
+
+	runConformance(t, factory, Options{RedeliveryTimeout: redisClaimMinIdleTime + 5*time.Second})
+}
@@ -0,0 +1,116 @@
+package queueconformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+// receiver runs Receive in the background, and hands out the received items one at a time.
+type receiver struct {
+	items  chan *types.FifoQueueItem
+	cancel context.CancelFunc
+	done   chan error
+}
+
+func startReceiver(ctx context.Context, queue hostkit.FifoQueue) *receiver {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r := &receiver{
+		items:  make(chan *types.FifoQueueItem),
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+
+	go func() {
+		r.done <- queue.Receive(ctx, r.items)
+	}()
+
+	return r
+}
+
+// next returns the next item, or an error if no item is received within the timeout.
+func (r *receiver) next(ctx context.Context, timeout time.Duration) (*types.FifoQueueItem, error) {
+	select {
+	case item, ok := <-r.items:
+		if !ok {
+			return nil, r.closed("sink channel closed while waiting for a message")
+		}
+
+		if item == nil {
+			return nil, errors.New("received a nil item")
+		}
+
+		return item, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no message received within %s", timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// expectNothing returns an error if an item is received within the duration.
+func (r *receiver) expectNothing(ctx context.Context, d time.Duration) error {
+	select {
+	case item, ok := <-r.items:
+		if !ok {
+			return r.closed("sink channel closed unexpectedly")
+		}
+
+		item.Nack()
+
+		return fmt.Errorf("unexpected message %q in channel %s", item.Body, item.SlackChannelID)
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop cancels Receive, and verifies that it returns and closes the sink channel in time.
+// Items received while stopping are nacked.
+func (r *receiver) stop() error {
+	r.cancel()
+
+	timeout := time.After(stopTimeout)
+
+	for {
+		select {
+		case item, ok := <-r.items:
+			if !ok {
+				return r.wait()
+			}
+
+			item.Nack()
+		case <-timeout:
+			return fmt.Errorf("receive did not close the sink channel within %s of the context being canceled", stopTimeout)
+		}
+	}
+}
+
+// wait waits for Receive to return, and returns its error unless it is a context error.
+func (r *receiver) wait() error {
+	select {
+	case err := <-r.done:
+		if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("receive failed: %w", err)
+		}
+
+		return nil
+	case <-time.After(stopTimeout):
+		return fmt.Errorf("receive did not return within %s of closing the sink channel", stopTimeout)
+	}
+}
+
+// closed returns an error for a sink channel that was closed too early, including the error from Receive, if any.
+func (r *receiver) closed(msg string) error {
+	if err := r.wait(); err != nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return errors.New(msg)
+}
@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultMaxBuckets is the default maximum number of buckets kept by a Local limiter.
+	DefaultMaxBuckets = 10000
+
+	// sweepInterval is the minimum time between removals of full buckets.
+	sweepInterval = time.Minute
+)
+
+// Local is an in-memory token bucket rate limiter, with one limiter per bucket key.
+// The limit of an existing bucket is updated in place when it changes, so changing the limits
+// doesn't reset the available tokens.
+//
+// Since the bucket keys may come from requests, the number of buckets is bounded. Buckets that have
+// refilled completely are removed periodically, since they are equivalent to new ones, and the least
+// recently used bucket is removed when the maximum is reached.
+type Local struct {
+	mu         sync.Mutex
+	maxBuckets int
+	limiters   map[string]*list.Element
+	lru        *list.List // *localEntry values, most recently used first
+	lastSweep  time.Time
+}
+
+type localEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+// NewLocal creates a Local limiter that keeps at most maxBuckets buckets.
+// If maxBuckets is zero or negative, DefaultMaxBuckets is used.
+func NewLocal(maxBuckets int) *Local {
+	if maxBuckets <= 0 {
+		maxBuckets = DefaultMaxBuckets
+	}
+
+	return &Local{
+		maxBuckets: maxBuckets,
+		limiters:   make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (l *Local) Allow(_ context.Context, buckets []Bucket, now time.Time) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	reservations := make([]*rate.Reservation, 0, len(buckets))
+
+	cancelAll := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	for i, b := range buckets {
+		r := l.getLimiter(b, now).ReserveN(now, b.Count)
+
+		if !r.OK() {
+			cancelAll()
+			return i, MaxRetryAfter
+		}
+
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			cancelAll()
+
+			return i, delay
+		}
+
+		reservations = append(reservations, r)
+	}
+
+	return -1, 0
+}
+
+// sweep removes the limiters that have all their tokens, which behave exactly like new limiters. The caller must hold the lock.
+func (l *Local) sweep(now time.Time) {
+	l.lastSweep = now
+
+	for e := l.lru.Front(); e != nil; {
+		next := e.Next()
+		entry := e.Value.(*localEntry) //nolint:forcetypeassert
+
+		if entry.limiter.TokensAt(now) >= float64(entry.limiter.Burst()) {
+			l.lru.Remove(e)
+			delete(l.limiters, entry.key)
+		}
+
+		e = next
+	}
+}
+
+// getLimiter returns the limiter for the bucket, creating it or updating its limit as needed. The caller must hold the lock.
+func (l *Local) getLimiter(b Bucket, now time.Time) *rate.Limiter {
+	e, ok := l.limiters[b.Key]
+	if !ok {
+		// Make room by removing the least recently used limiter. This resets its bucket, which is only
+		// a problem if more than maxBuckets buckets are in active use.
+		if l.lru.Len() >= l.maxBuckets {
+			oldest := l.lru.Back()
+			l.lru.Remove(oldest)
+			delete(l.limiters, oldest.Value.(*localEntry).key) //nolint:forcetypeassert
+		}
+
+		limiter := rate.NewLimiter(rate.Limit(b.Rate), b.Burst)
+		l.limiters[b.Key] = l.lru.PushFront(&localEntry{key: b.Key, limiter: limiter})
+
+		return limiter
+	}
+
+	l.lru.MoveToFront(e)
+
+	limiter := e.Value.(*localEntry).limiter //nolint:forcetypeassert
+
+	if limiter.Limit() != rate.Limit(b.Rate) {
+		limiter.SetLimitAt(now, rate.Limit(b.Rate))
+	}
+
+	if limiter.Burst() != b.Burst {
+		limiter.SetBurstAt(now, b.Burst)
+	}
+
+	return limiter
+}
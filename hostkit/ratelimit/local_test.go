@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestBucket(key string, rate float64, burst, count int) Bucket {
+	return Bucket{Key: key, Rate: rate, Burst: burst, Count: count}
+}
+
+// request is a single call to Allow in a limiter test, at an offset from the test start time.
+type request struct {
+	at             time.Duration
+	buckets        []Bucket
+	wantExceeded   int
+	wantRetryAfter time.Duration
+}
+
+// limiterTests are run against both the Local and the Redis limiter.
+var limiterTests = []struct {
+	name     string
+	requests []request
+}{
+	{
+		name: "burst then refill",
+		requests: []request{
+			{buckets: []Bucket{newTestBucket("C1", 1, 2, 2)}, wantExceeded: -1},
+			{buckets: []Bucket{newTestBucket("C1", 1, 2, 1)}, wantExceeded: 0, wantRetryAfter: time.Second},
+			{at: time.Second, buckets: []Bucket{newTestBucket("C1", 1, 2, 1)}, wantExceeded: -1},
+		},
+	},
+	{
+		name: "no tokens are taken if any bucket is exceeded",
+		requests: []request{
+			{buckets: []Bucket{newTestBucket("C1", 1, 5, 1), newTestBucket("rule", 1, 2, 2)}, wantExceeded: -1},
+			{buckets: []Bucket{newTestBucket("C1", 1, 5, 1), newTestBucket("rule", 1, 2, 1)}, wantExceeded: 1, wantRetryAfter: time.Second},
+			{buckets: []Bucket{newTestBucket("C1", 1, 5, 4)}, wantExceeded: -1},
+		},
+	},
+	{
+		name: "buckets are independent",
+		requests: []request{
+			{buckets: []Bucket{newTestBucket("C1", 1, 1, 1)}, wantExceeded: -1},
+			{buckets: []Bucket{newTestBucket("C2", 1, 1, 1)}, wantExceeded: -1},
+			{buckets: []Bucket{newTestBucket("C2", 1, 1, 1), newTestBucket("C1", 1, 1, 1)}, wantExceeded: 0, wantRetryAfter: time.Second},
+		},
+	},
+	{
+		name: "limit changes keep the current tokens",
+		requests: []request{
+			{buckets: []Bucket{newTestBucket("C1", 1, 2, 2)}, wantExceeded: -1},
+			{buckets: []Bucket{newTestBucket("C1", 2, 10, 1)}, wantExceeded: 0, wantRetryAfter: 500 * time.Millisecond},
+		},
+	},
+}
+
+// runLimiterTest runs the requests of a limiter test. The setTime function is called before each request, with the
+// time of the request.
+func runLimiterTest(t *testing.T, limiter Limiter, requests []request, setTime func(now time.Time)) {
+	t.Helper()
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, req := range requests {
+		now := start.Add(req.at)
+		setTime(now)
+
+		exceeded, retryAfter := limiter.Allow(context.Background(), req.buckets, now)
+
+		if exceeded != req.wantExceeded || retryAfter != req.wantRetryAfter {
+			t.Errorf("request %d: got exceeded bucket %d after %s, want %d after %s", i, exceeded, retryAfter, req.wantExceeded, req.wantRetryAfter)
+		}
+	}
+}
+
+func TestLocalAllow(t *testing.T) {
+	for _, tt := range limiterTests {
+		t.Run(tt.name, func(t *testing.T) {
+			runLimiterTest(t, NewLocal(0), tt.requests, func(time.Time) {})
+		})
+	}
+
+	t.Run("more tokens than the burst", func(t *testing.T) {
+		exceeded, retryAfter := NewLocal(0).Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 1, 2)}, time.Now())
+
+		if exceeded != 0 || retryAfter != MaxRetryAfter {
+			t.Errorf("got exceeded bucket %d after %s, want 0 after %s", exceeded, retryAfter, MaxRetryAfter)
+		}
+	})
+}
+
+func TestLocalSweep(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLocal(0)
+
+	l.Allow(context.Background(), []Bucket{newTestBucket("fast", 1, 5, 5)}, now)
+	l.Allow(context.Background(), []Bucket{newTestBucket("slow", 0.001, 5, 5)}, now)
+
+	// After the sweep interval, the fast bucket has refilled completely and is removed, while the slow bucket is kept.
+	l.Allow(context.Background(), nil, now.Add(sweepInterval))
+
+	if _, ok := l.limiters["fast"]; ok {
+		t.Error("the full bucket was not removed")
+	}
+
+	if _, ok := l.limiters["slow"]; !ok {
+		t.Error("the bucket that is still refilling was removed")
+	}
+
+	if exceeded, _ := l.Allow(context.Background(), []Bucket{newTestBucket("slow", 0.001, 5, 1)}, now.Add(sweepInterval)); exceeded != 0 {
+		t.Error("the bucket that is still refilling lost its state")
+	}
+}
+
+func TestLocalMaxBuckets(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLocal(2)
+
+	for _, key := range []string{"C1", "C2", "C1", "C3"} {
+		l.Allow(context.Background(), []Bucket{newTestBucket(key, 0.001, 5, 1)}, now)
+	}
+
+	if len(l.limiters) != 2 || l.lru.Len() != 2 {
+		t.Fatalf("got %d limiters and %d list entries, want 2", len(l.limiters), l.lru.Len())
+	}
+
+	// C2 is the least recently used bucket when C3 is added.
+	for key, want := range map[string]bool{"C1": true, "C2": false, "C3": true} {
+		if _, ok := l.limiters[key]; ok != want {
+			t.Errorf("got bucket %s kept %v, want %v", key, ok, want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package ratelimit has token bucket rate limiters that take tokens from several buckets at once, or from none of them.
+//
+// The Local limiter keeps the buckets in memory, so each host replica enforces the limits on its own. The Redis
+// limiter keeps the buckets in Redis, shared by all replicas, and falls back to a Local limiter while Redis is
+// unavailable.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// MaxRetryAfter caps the retry delay for requests that can never be satisfied, i.e. with more tokens than the burst.
+const MaxRetryAfter = 24 * time.Hour
+
+// Bucket is a single token bucket to check for a request, with the number of tokens to take from it.
+type Bucket struct {
+	// Key identifies the bucket. Buckets with the same key share their tokens.
+	Key string
+
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64
+
+	// Burst is the maximum number of tokens in the bucket.
+	Burst int
+
+	// Count is the number of tokens to take from the bucket.
+	Count int
+}
+
+// Limiter limits requests with token buckets.
+type Limiter interface {
+	// Allow takes tokens from all the buckets, or from none of them. It returns -1 if all buckets had enough tokens,
+	// otherwise it returns the index of the first exceeded bucket and the delay before the request can be retried.
+	Allow(ctx context.Context, buckets []Bucket, now time.Time) (int, time.Duration)
+}
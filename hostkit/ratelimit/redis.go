@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slackmgr/types"
+)
+
+const (
+	// redisKeyPrefix is the prefix of the Redis bucket keys. The hash tag keeps all buckets in the same slot,
+	// so that a single script can update several buckets atomically in Redis Cluster.
+	redisKeyPrefix = "{slackmgr:ratelimit}:"
+
+	// redisTimeout is the maximum time to wait for Redis, before falling back to local rate limiting.
+	redisTimeout = time.Second
+
+	// redisRetryInterval is the time between attempts to use Redis again, while falling back to local rate limiting.
+	redisRetryInterval = 5 * time.Second
+)
+
+// tokenBucketScript checks and updates all the buckets in KEYS atomically, using the Redis server time.
+// ARGV holds the rate, the burst size and the token count for each bucket, in the same order as KEYS.
+// Tokens are only taken if all buckets have enough tokens. The script returns {0, "0"} if the request is allowed,
+// otherwise the 1-based index of the first exceeded bucket and the number of seconds until it has enough tokens.
+var tokenBucketScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+local tokens = {}
+
+for i = 1, #KEYS do
+	local rate = tonumber(ARGV[i * 3 - 2])
+	local burst = tonumber(ARGV[i * 3 - 1])
+	local count = tonumber(ARGV[i * 3])
+	local state = redis.call("HMGET", KEYS[i], "tokens", "ts")
+	local available = tonumber(state[1])
+	local ts = tonumber(state[2])
+
+	if available == nil or ts == nil then
+		available = burst
+	else
+		available = math.min(burst, available + math.max(0, now - ts) * rate)
+	end
+
+	if available < count then
+		return {i, tostring((count - available) / rate)}
+	end
+
+	tokens[i] = available - count
+end
+
+for i = 1, #KEYS do
+	local rate = tonumber(ARGV[i * 3 - 2])
+	local burst = tonumber(ARGV[i * 3 - 1])
+
+	redis.call("HSET", KEYS[i], "tokens", tostring(tokens[i]), "ts", tostring(now))
+	redis.call("PEXPIRE", KEYS[i], math.ceil(burst / rate * 1000) + 1000)
+end
+
+return {0, "0"}
+`)
+
+// Redis is a token bucket rate limiter shared by all replicas, with the buckets stored in Redis.
+// If Redis is unavailable, it falls back to local rate limiting in each replica until Redis is available again.
+// While it falls back, a single request tries Redis again every redisRetryInterval, so that the other requests
+// don't wait for an unreachable Redis.
+type Redis struct {
+	client   redis.UniversalClient
+	fallback *Local
+	logger   types.Logger
+
+	// retryAt is the time in Unix nanoseconds of the next attempt to use Redis, or zero if Redis is available.
+	retryAt atomic.Int64
+}
+
+// NewRedis creates a Redis limiter. The fallback Local limiter keeps at most DefaultMaxBuckets buckets.
+func NewRedis(client redis.UniversalClient, logger types.Logger) *Redis {
+	return &Redis{
+		client:   client,
+		fallback: NewLocal(0),
+		logger:   logger,
+	}
+}
+
+func (l *Redis) Allow(ctx context.Context, buckets []Bucket, now time.Time) (int, time.Duration) {
+	if len(buckets) == 0 {
+		return -1, 0
+	}
+
+	// Only the request that moves the retry time forward tries Redis, the others use the fallback.
+	if retryAt := l.retryAt.Load(); retryAt != 0 {
+		if now.UnixNano() < retryAt || !l.retryAt.CompareAndSwap(retryAt, now.Add(redisRetryInterval).UnixNano()) {
+			return l.fallback.Allow(ctx, buckets, now)
+		}
+	}
+
+	index, retryAfter, err := l.allowRedis(ctx, buckets)
+	if err != nil {
+		if l.retryAt.Swap(now.Add(redisRetryInterval).UnixNano()) == 0 {
+			l.logger.Errorf("Redis rate limiter unavailable, falling back to local rate limiting: %s", err)
+		}
+
+		return l.fallback.Allow(ctx, buckets, now)
+	}
+
+	if l.retryAt.Swap(0) != 0 {
+		l.logger.Info("Redis rate limiter available again")
+	}
+
+	return index, retryAfter
+}
+
+func (l *Redis) allowRedis(ctx context.Context, buckets []Bucket) (int, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	keys := make([]string, len(buckets))
+	args := make([]any, 0, len(buckets)*3)
+
+	for i, b := range buckets {
+		keys[i] = redisKeyPrefix + b.Key
+		args = append(args, b.Rate, b.Burst, b.Count)
+	}
+
+	result, err := tokenBucketScript.Run(ctx, l.client, keys, args...).Slice()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+
+	if len(result) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+
+	index, ok := result[0].(int64)
+	if !ok || index < 0 || index > int64(len(buckets)) {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+
+	if index == 0 {
+		return -1, 0, nil
+	}
+
+	waitStr, _ := result[1].(string)
+
+	wait, err := strconv.ParseFloat(waitStr, 64)
+	if err != nil {
+		return 0, 0, errors.New("unexpected rate limit script result: invalid retry delay")
+	}
+
+	return int(index - 1), min(time.Duration(wait*float64(time.Second)), MaxRetryAfter), nil
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/slackmgr/types"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return server, client
+}
+
+func TestRedisAllow(t *testing.T) {
+	for _, tt := range limiterTests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestRedis(t)
+
+			// The script uses the Redis server time, which is set to the time of each request.
+			runLimiterTest(t, NewRedis(client, &types.NoopLogger{}), tt.requests, server.SetTime)
+		})
+	}
+}
+
+func TestRedisSharedBuckets(t *testing.T) {
+	server, client := newTestRedis(t)
+	server.SetTime(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	first := NewRedis(client, &types.NoopLogger{})
+	second := NewRedis(client, &types.NoopLogger{})
+
+	if exceeded, _ := first.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 2)}, time.Now()); exceeded != -1 {
+		t.Fatalf("got exceeded bucket %d from the first limiter, want none", exceeded)
+	}
+
+	if exceeded, _ := second.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 1)}, time.Now()); exceeded != 0 {
+		t.Errorf("got exceeded bucket %d from the second limiter, want 0", exceeded)
+	}
+
+	// The bucket expires once it would have refilled completely.
+	key := redisKeyPrefix + "C1"
+
+	if ttl := server.TTL(key); ttl <= 0 || ttl > 3*time.Second {
+		t.Errorf("got TTL %s, want at most the refill time plus one second", ttl)
+	}
+}
+
+func TestRedisFallback(t *testing.T) {
+	server, client := newTestRedis(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	l := NewRedis(client, &types.NoopLogger{})
+
+	if exceeded, _ := l.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 2)}, now); exceeded != -1 {
+		t.Fatalf("got exceeded bucket %d, want none", exceeded)
+	}
+
+	server.Close()
+
+	// The local fallback has its own buckets, so the bucket is full again.
+	if exceeded, _ := l.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 2)}, now); exceeded != -1 {
+		t.Errorf("got exceeded bucket %d from the fallback, want none", exceeded)
+	}
+
+	if exceeded, _ := l.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 1)}, now); exceeded != 0 {
+		t.Errorf("got exceeded bucket %d from the fallback, want 0", exceeded)
+	}
+
+	if l.retryAt.Load() == 0 {
+		t.Error("the limiter is not degraded while Redis is down")
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Redis is tried again after the retry interval. It still has the bucket that was emptied before it went down.
+	now = now.Add(redisRetryInterval)
+
+	if exceeded, _ := l.Allow(context.Background(), []Bucket{newTestBucket("C1", 1, 2, 1)}, now); exceeded != 0 {
+		t.Errorf("got exceeded bucket %d after Redis is back, want 0", exceeded)
+	}
+
+	if l.retryAt.Load() != 0 {
+		t.Error("the limiter is still degraded after Redis is back")
+	}
+}
+
+// countingHook counts the commands sent to Redis.
+type countingHook struct {
+	commands atomic.Int64
+}
+
+func (h *countingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *countingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.commands.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *countingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisFallbackDoesNotWaitForRedis(t *testing.T) {
+	server, client := newTestRedis(t)
+	server.Close()
+
+	hook := &countingHook{}
+	client.AddHook(hook)
+
+	l := NewRedis(client, &types.NoopLogger{})
+	now := time.Now()
+	buckets := []Bucket{newTestBucket("C1", 1000, 1000, 1)}
+
+	l.Allow(context.Background(), buckets, now)
+
+	attempts := hook.commands.Load()
+	if attempts == 0 {
+		t.Fatal("the first request didn't try Redis")
+	}
+
+	// The requests within the retry interval use the fallback without trying Redis.
+	for i := range 100 {
+		l.Allow(context.Background(), buckets, now.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	if got := hook.commands.Load(); got != attempts {
+		t.Errorf("got %d Redis commands within the retry interval, want %d", got, attempts)
+	}
+
+	// A single request tries Redis again once the retry interval has passed.
+	now = now.Add(redisRetryInterval)
+
+	l.Allow(context.Background(), buckets, now)
+	l.Allow(context.Background(), buckets, now)
+
+	if got := hook.commands.Load(); got != 2*attempts {
+		t.Errorf("got %d Redis commands after the retry interval, want %d", got, 2*attempts)
+	}
+}
@@ -0,0 +1,201 @@
+// Package redisheaders adds message headers to the Redis queue of the core module (manager.RedisFifoQueue), which
+// only sends a body. The headers are sent as the headers field of the stream message, next to the body.
+//
+// The queue is created with a Client in place of its Redis client, and wrapped with Wrap:
+//
+//	client := redisheaders.NewClient(redisClient)
+//	queue, err := manager.NewRedisFifoQueue(client, locker, "alerts", logger).Init()
+//	headerQueue := redisheaders.Wrap(queue, client)
+package redisheaders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+// sendScript is the send script of manager.RedisFifoQueue, with the JSON-encoded headers in ARGV[5] added to the
+// message as the headers field. It must be kept in sync with the script of the core module.
+var sendScript = redis.NewScript(`
+	local streamKey = KEYS[1]
+	local indexKey = KEYS[2]
+	local activityKey = KEYS[3]
+	local maxLen = tonumber(ARGV[1])
+	local channelId = ARGV[2]
+	local body = ARGV[3]
+	local activityTime = tonumber(ARGV[4])
+	local headers = ARGV[5]
+
+	local messageId = redis.call('XADD', streamKey, 'MAXLEN', '~', maxLen, '*',
+		'channel_id', channelId,
+		'body', body,
+		'headers', headers)
+
+	redis.call('SADD', indexKey, streamKey)
+	redis.call('ZADD', activityKey, activityTime, streamKey)
+
+	return messageId
+`)
+
+// headersKey is the context key of the headers of the message that is being sent.
+type headersKey struct{}
+
+// Client is a Redis client for manager.RedisFifoQueue, which sends the headers of the Queue as a stream field, and
+// keeps the headers field of the read messages until the Queue forwards them.
+//
+// The queue sends each message with a single Lua script call, so a script call with headers in the context runs
+// sendScript instead, with the same keys and arguments. The messages are read with XReadGroup, and claimed from
+// other consumers with XAutoClaim. All other calls go to the wrapped client unchanged.
+type Client struct {
+	redis.UniversalClient
+
+	mu       sync.Mutex
+	received map[string]map[string]string
+}
+
+// NewClient wraps the Redis client.
+func NewClient(client redis.UniversalClient) *Client {
+	return &Client{
+		UniversalClient: client,
+		received:        map[string]map[string]string{},
+	}
+}
+
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...any) *redis.Cmd {
+	if headers, ok := ctx.Value(headersKey{}).(map[string]string); ok {
+		return c.sendWithHeaders(ctx, keys, args, headers)
+	}
+
+	return c.UniversalClient.Eval(ctx, script, keys, args...)
+}
+
+func (c *Client) EvalSha(ctx context.Context, sha1 string, keys []string, args ...any) *redis.Cmd {
+	if headers, ok := ctx.Value(headersKey{}).(map[string]string); ok {
+		return c.sendWithHeaders(ctx, keys, args, headers)
+	}
+
+	return c.UniversalClient.EvalSha(ctx, sha1, keys, args...)
+}
+
+func (c *Client) sendWithHeaders(ctx context.Context, keys []string, args []any, headers map[string]string) *redis.Cmd {
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		cmd := redis.NewCmd(ctx)
+		cmd.SetErr(fmt.Errorf("failed to encode message headers: %w", err))
+
+		return cmd
+	}
+
+	return sendScript.Run(ctx, c.UniversalClient, keys, append(slices.Clone(args), string(encoded))...)
+}
+
+func (c *Client) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	cmd := c.UniversalClient.XReadGroup(ctx, a)
+
+	for _, stream := range cmd.Val() {
+		c.keepHeaders(stream.Messages)
+	}
+
+	return cmd
+}
+
+func (c *Client) XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd {
+	cmd := c.UniversalClient.XAutoClaim(ctx, a)
+
+	messages, _ := cmd.Val()
+	c.keepHeaders(messages)
+
+	return cmd
+}
+
+// keepHeaders keeps the headers of the messages that have them. The headers of messages that are never forwarded,
+// e.g. because the receiver stopped, are kept until the message is read again.
+func (c *Client) keepHeaders(messages []redis.XMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, msg := range messages {
+		encoded, ok := msg.Values["headers"].(string)
+		if !ok {
+			continue
+		}
+
+		var headers map[string]string
+
+		if err := json.Unmarshal([]byte(encoded), &headers); err != nil {
+			continue
+		}
+
+		channelID, _ := msg.Values["channel_id"].(string)
+		c.received[messageKey(channelID, msg.ID)] = headers
+	}
+}
+
+// takeHeaders returns the headers of the item, and forgets them.
+func (c *Client) takeHeaders(item *types.FifoQueueItem) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := messageKey(item.SlackChannelID, item.MessageID)
+	headers := c.received[key]
+	delete(c.received, key)
+
+	return headers
+}
+
+// messageKey returns the key of the headers of a message. Stream message IDs are only unique within the stream of
+// a channel.
+func messageKey(channelID, messageID string) string {
+	return channelID + "/" + messageID
+}
+
+// Queue is a Redis queue with headers.
+type Queue struct {
+	queue  hostkit.FifoQueue
+	client *Client
+}
+
+// Wrap wraps a manager.RedisFifoQueue that was created with the client.
+func Wrap(queue hostkit.FifoQueue, client *Client) *Queue {
+	return &Queue{queue: queue, client: client}
+}
+
+// Name returns the name of the wrapped queue.
+func (q *Queue) Name() string {
+	return q.queue.Name()
+}
+
+// Send sends the message to the wrapped queue, without headers.
+func (q *Queue) Send(ctx context.Context, slackChannelID, dedupID, body string) error {
+	return q.queue.Send(ctx, slackChannelID, dedupID, body)
+}
+
+// SendWithHeaders sends the message to the wrapped queue, with the headers in the headers field. A message without
+// headers is sent like Send.
+func (q *Queue) SendWithHeaders(ctx context.Context, slackChannelID, dedupID, body string, headers map[string]string) error {
+	if len(headers) == 0 {
+		return q.Send(ctx, slackChannelID, dedupID, body)
+	}
+
+	return q.queue.Send(context.WithValue(ctx, headersKey{}, headers), slackChannelID, dedupID, body)
+}
+
+// Receive receives messages from the wrapped queue, without headers. The sink channel is closed when the function
+// returns.
+func (q *Queue) Receive(ctx context.Context, sinkCh chan<- *types.FifoQueueItem) error {
+	return hostkit.ReceiveItems(ctx, q, sinkCh)
+}
+
+// ReceiveWithHeaders receives messages from the wrapped queue, with their headers. Messages sent without headers have
+// none. The sink channel is closed when the function returns.
+func (q *Queue) ReceiveWithHeaders(ctx context.Context, sinkCh chan<- *hostkit.FifoQueueMessage) error {
+	return hostkit.ReceiveMessages(ctx, q.queue, sinkCh, func(item *types.FifoQueueItem) *hostkit.FifoQueueMessage {
+		return &hostkit.FifoQueueMessage{Item: item, Headers: q.client.takeHeaders(item)}
+	})
+}
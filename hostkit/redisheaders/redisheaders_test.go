@@ -0,0 +1,122 @@
+package redisheaders
+
+import (
+	"context"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	manager "github.com/slackmgr/core/manager"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/types"
+)
+
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = redisClient.Close() })
+
+	client := NewClient(redisClient)
+
+	queue, err := manager.NewRedisFifoQueue(client, manager.NewRedisChannelLocker(redisClient), "alerts", &types.NoopLogger{},
+		manager.WithPollInterval(time.Second),
+	).Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Wrap(queue, client)
+}
+
+func TestQueueHeaders(t *testing.T) {
+	queue := newTestQueue(t)
+	headers := map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}
+
+	if err := queue.SendWithHeaders(context.Background(), "C1", "d1", `{"header": "first"}`, headers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := queue.Send(context.Background(), "C2", "d2", `{"header": "second"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sinkCh := make(chan *hostkit.FifoQueueMessage)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.ReceiveWithHeaders(ctx, sinkCh) }()
+
+	got := map[string]*hostkit.FifoQueueMessage{}
+
+	for len(got) < 2 {
+		msg, ok := <-sinkCh
+		if !ok {
+			t.Fatalf("the sink channel was closed after %d messages: %v", len(got), <-errCh)
+		}
+
+		msg.Item.Ack()
+		got[msg.Item.SlackChannelID] = msg
+	}
+
+	cancel()
+
+	for range sinkCh {
+		t.Error("got an unexpected message")
+	}
+
+	<-errCh
+
+	if msg := got["C1"]; msg.Item.Body != `{"header": "first"}` || !maps.Equal(msg.Headers, headers) {
+		t.Errorf("got body %q and headers %v, want the sent body and headers %v", msg.Item.Body, msg.Headers, headers)
+	}
+
+	if msg := got["C2"]; msg.Item.Body != `{"header": "second"}` || len(msg.Headers) != 0 {
+		t.Errorf("got body %q and headers %v, want the sent body without headers", msg.Item.Body, msg.Headers)
+	}
+
+	if len(queue.client.received) != 0 {
+		t.Errorf("got %d kept headers after the messages were forwarded, want none", len(queue.client.received))
+	}
+}
+
+func TestQueueReceiveWithoutHeaders(t *testing.T) {
+	queue := newTestQueue(t)
+
+	// The manager receives with Receive, which gets the sent body without the headers.
+	if err := queue.SendWithHeaders(context.Background(), "C1", "d1", `{"header": "first"}`, map[string]string{"traceparent": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sinkCh := make(chan *types.FifoQueueItem)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- queue.Receive(ctx, sinkCh) }()
+
+	item, ok := <-sinkCh
+	if !ok {
+		t.Fatalf("the sink channel was closed without a message: %v", <-errCh)
+	}
+
+	item.Ack()
+	cancel()
+
+	for range sinkCh {
+		t.Error("got an unexpected message")
+	}
+
+	<-errCh
+
+	if item.Body != `{"header": "first"}` {
+		t.Errorf("got body %q, want the sent body", item.Body)
+	}
+}
@@ -0,0 +1,36 @@
+package hostkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReadSettingsFile reads the specified yaml file, and unmarshals it into each of the targets.
+// Several targets allow a file to hold settings for different components, e.g. the manager settings and log levels.
+// It also returns a hash of the file for change detection, for hot-reloading purposes.
+func ReadSettingsFile(filename string, targets ...any) (string, error) {
+	settingsYaml, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return "", fmt.Errorf("failed to read settings file %s: %w", filename, err)
+	}
+
+	for _, target := range targets {
+		if err := yaml.Unmarshal(settingsYaml, target); err != nil {
+			return "", fmt.Errorf("failed to unmarshal settings from %s: %w", filename, err)
+		}
+	}
+
+	return hash(settingsYaml), nil
+}
+
+func hash(input []byte) string {
+	h := sha256.New()
+	h.Write(input)
+	bs := h.Sum(nil)
+	return hex.EncodeToString(bs)
+}
@@ -0,0 +1,72 @@
+package hostkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSettingsFile(t *testing.T) {
+	type first struct {
+		Name string `yaml:"name"`
+	}
+
+	type second struct {
+		Count int `yaml:"count"`
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid file", content: "name: test\ncount: 3\n"},
+		{name: "invalid yaml", content: "name: [unterminated\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "settings.yaml")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var a first
+			var b second
+
+			hash, err := ReadSettingsFile(path, &a, &b)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if a.Name != "test" || b.Count != 3 {
+				t.Errorf("got %+v and %+v, want both targets filled", a, b)
+			}
+
+			again, err := ReadSettingsFile(path, &a)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hash == "" || hash != again {
+				t.Errorf("got hashes %q and %q, want the same non-empty hash", hash, again)
+			}
+		})
+	}
+}
+
+func TestReadSettingsFileMissing(t *testing.T) {
+	if _, err := ReadSettingsFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,70 @@
+package hostkit
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// SignalOptions contains the optional signal handling, on top of the termination signals.
+type SignalOptions struct {
+	// Reload receives a message on SIGHUP, e.g. to reload the settings files. SIGHUP is not handled if Reload is nil.
+	Reload chan<- struct{}
+
+	// LogLevels gets a debug override for all components on SIGUSR1, which is cleared on SIGUSR2 or after
+	// LogLevelRevertAfter. SIGUSR1 and SIGUSR2 are not handled if LogLevels is nil, or on Windows.
+	LogLevels *LogLevels
+
+	// LogLevelRevertAfter is the time before the SIGUSR1 override reverts. Zero means no automatic revert.
+	LogLevelRevertAfter time.Duration
+}
+
+// HandleSignals listens for OS signals and cancels the context when a termination signal is received.
+// The other signals in the options don't terminate the application.
+func HandleSignals(ctx context.Context, cancel context.CancelFunc, opts SignalOptions) {
+	handled := []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+	if opts.Reload != nil {
+		handled = append(handled, syscall.SIGHUP)
+	}
+
+	if opts.LogLevels != nil && debugOverrideSignal != nil {
+		handled = append(handled, debugOverrideSignal, clearOverrideSignal)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, handled...)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			log.Info().Msgf("Signal %s received", sig)
+
+			switch {
+			case sig == syscall.SIGHUP:
+				// Don't block if a reload is already pending.
+				select {
+				case opts.Reload <- struct{}{}:
+				default:
+				}
+			case sig == debugOverrideSignal:
+				opts.LogLevels.SetOverride(NewLogLevelSet(zerolog.DebugLevel), opts.LogLevelRevertAfter)
+				log.Info().Msgf("Debug logging enabled for all components (reverts after %s, or on %s)", opts.LogLevelRevertAfter, clearOverrideSignal)
+			case sig == clearOverrideSignal:
+				opts.LogLevels.ClearOverride()
+				log.Info().Msg("Log level override cleared, reverted to the default log levels")
+			default:
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package hostkit
+
+import (
+	"os"
+	"syscall"
+)
+
+// debugOverrideSignal sets a debug log level override, and clearOverrideSignal clears it.
+var debugOverrideSignal, clearOverrideSignal os.Signal = syscall.SIGUSR1, syscall.SIGUSR2
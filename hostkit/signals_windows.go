@@ -0,0 +1,8 @@
+package hostkit
+
+import (
+	"os"
+)
+
+// debugOverrideSignal and clearOverrideSignal are nil, since Windows has no user-defined signals.
+var debugOverrideSignal, clearOverrideSignal os.Signal
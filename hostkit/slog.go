@@ -0,0 +1,221 @@
+package hostkit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/slackmgr/types"
+)
+
+// SlogLogger implements the types.Logger interface on top of an arbitrary slog.Handler.
+//
+// Field values are mapped to slog attributes with the same types as Logger.WithField maps them to zerolog fields,
+// e.g. time.Duration values become duration attributes and int32 values become int64 attributes.
+// The log level is checked with the handler before the message is formatted.
+//
+// SlogLogger writes the entries as they are. Use a Logger with a slog sink to get the runtime log levels,
+// the redaction of secrets and the sampling on top of a slog.Handler.
+type SlogLogger struct {
+	handler slog.Handler
+}
+
+// NewSlogLogger creates a logger that writes to the given handler.
+func NewSlogLogger(handler slog.Handler) *SlogLogger {
+	return &SlogLogger{handler: handler}
+}
+
+func (l *SlogLogger) Debug(msg string) {
+	l.log(slog.LevelDebug, msg, nil, false)
+}
+
+func (l *SlogLogger) Debugf(format string, args ...any) {
+	l.log(slog.LevelDebug, format, args, true)
+}
+
+func (l *SlogLogger) Info(msg string) {
+	l.log(slog.LevelInfo, msg, nil, false)
+}
+
+func (l *SlogLogger) Infof(format string, args ...any) {
+	l.log(slog.LevelInfo, format, args, true)
+}
+
+func (l *SlogLogger) Error(msg string) {
+	l.log(slog.LevelError, msg, nil, false)
+}
+
+func (l *SlogLogger) Errorf(format string, args ...any) {
+	l.log(slog.LevelError, format, args, true)
+}
+
+func (l *SlogLogger) log(level slog.Level, msg string, args []any, format bool) {
+	if !l.handler.Enabled(context.Background(), level) {
+		return
+	}
+
+	if format {
+		msg = fmt.Sprintf(msg, args...)
+	}
+
+	l.logAttrs(level, msg, nil)
+}
+
+// logAttrs writes a record with the given attributes, if the level is enabled in the handler.
+func (l *SlogLogger) logAttrs(level slog.Level, msg string, attrs []slog.Attr) {
+	ctx := context.Background()
+
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+
+	record := slog.NewRecord(time.Now(), level, msg, 0)
+	record.AddAttrs(attrs...)
+
+	_ = l.handler.Handle(ctx, record)
+}
+
+func (l *SlogLogger) WithField(key string, value any) types.Logger { //nolint:ireturn
+	return l.withAttrs([]slog.Attr{slogAttr(key, value)})
+}
+
+func (l *SlogLogger) WithFields(fields map[string]any) types.Logger { //nolint:ireturn
+	attrs := make([]slog.Attr, 0, len(fields))
+
+	// Map iteration order is random, so the fields are sorted to get a stable output.
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		attrs = append(attrs, slogAttr(key, fields[key]))
+	}
+
+	return l.withAttrs(attrs)
+}
+
+func (l *SlogLogger) withAttrs(attrs []slog.Attr) *SlogLogger {
+	return &SlogLogger{handler: l.handler.WithAttrs(attrs)}
+}
+
+// slogAttr maps a field to a slog attribute, with the same types as Logger.WithField.
+func slogAttr(key string, value any) slog.Attr {
+	switch v := value.(type) {
+	case string:
+		return slog.String(key, v)
+	case int:
+		return slog.Int(key, v)
+	case int32:
+		return slog.Int64(key, int64(v))
+	case int64:
+		return slog.Int64(key, v)
+	case float64:
+		return slog.Float64(key, v)
+	case bool:
+		return slog.Bool(key, v)
+	case time.Time:
+		return slog.Time(key, v)
+	case time.Duration:
+		return slog.Duration(key, v)
+	default:
+		return slog.Any(key, value)
+	}
+}
+
+// SlogHandler implements slog.Handler by forwarding the records to a types.Logger, e.g. to route the output of
+// libraries that log with slog through the host logger.
+//
+// The types.Logger interface only has debug, info and error levels: records below slog.LevelInfo are logged as
+// debug, and records below slog.LevelError as info. Attributes in groups get the group names as a dotted prefix.
+// Don't use it with a Logger that has a slog sink writing to the same handler, since that would loop forever.
+type SlogHandler struct {
+	logger types.Logger
+	level  slog.Leveler
+	prefix string
+}
+
+// NewSlogHandler creates a handler that forwards records at or above the given level to the logger.
+// A nil level means slog.LevelInfo.
+func NewSlogHandler(logger types.Logger, level slog.Leveler) *SlogHandler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+
+	return &SlogHandler{logger: logger, level: level}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	logger := h.logger
+
+	if r.NumAttrs() > 0 {
+		fields := make(map[string]any, r.NumAttrs())
+
+		r.Attrs(func(attr slog.Attr) bool {
+			addSlogAttr(fields, h.prefix, attr)
+			return true
+		})
+
+		logger = logger.WithFields(fields)
+	}
+
+	switch {
+	case r.Level < slog.LevelInfo:
+		logger.Debug(r.Message)
+	case r.Level < slog.LevelError:
+		logger.Info(r.Message)
+	default:
+		logger.Error(r.Message)
+	}
+
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler { //nolint:ireturn
+	if len(attrs) == 0 {
+		return h
+	}
+
+	fields := make(map[string]any, len(attrs))
+
+	for _, attr := range attrs {
+		addSlogAttr(fields, h.prefix, attr)
+	}
+
+	return &SlogHandler{logger: h.logger.WithFields(fields), level: h.level, prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler { //nolint:ireturn
+	if name == "" {
+		return h
+	}
+
+	return &SlogHandler{logger: h.logger, level: h.level, prefix: h.prefix + name + "."}
+}
+
+// addSlogAttr adds an attribute to the fields, with the group names as a dotted prefix.
+// The values keep their Go types, e.g. time.Duration, so that they are logged like fields added with WithField.
+func addSlogAttr(fields map[string]any, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+
+		for _, a := range value.Group() {
+			addSlogAttr(fields, groupPrefix, a)
+		}
+
+		return
+	}
+
+	if attr.Key == "" {
+		return
+	}
+
+	fields[prefix+attr.Key] = value.Any()
+}
@@ -0,0 +1,285 @@
+package hostkit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// recordingHandler is a slog.Handler that keeps the records, with the attributes added by WithAttrs.
+type recordingHandler struct {
+	mu      *sync.Mutex
+	records *[]recordedEntry
+	attrs   []slog.Attr
+}
+
+type recordedEntry struct {
+	level   slog.Level
+	message string
+	attrs   map[string]slog.Value
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{mu: &sync.Mutex{}, records: &[]recordedEntry{}}
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	entry := recordedEntry{level: r.Level, message: r.Message, attrs: make(map[string]slog.Value)}
+
+	for _, attr := range h.attrs {
+		entry.attrs[attr.Key] = attr.Value
+	}
+
+	r.Attrs(func(attr slog.Attr) bool {
+		entry.attrs[attr.Key] = attr.Value
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	*h.records = append(*h.records, entry)
+
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs(attrs []slog.Attr) slog.Handler { //nolint:ireturn
+	return &recordingHandler{mu: h.mu, records: h.records, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { //nolint:ireturn
+	return h
+}
+
+func (h *recordingHandler) entries() []recordedEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]recordedEntry{}, *h.records...)
+}
+
+// newSlogSinkLogger returns a logger that only has a slog sink, writing to the returned handler.
+func newSlogSinkLogger(t *testing.T, opts LoggerOptions) (*Logger, *recordingHandler) {
+	t.Helper()
+
+	handler := newRecordingHandler()
+
+	opts.Sinks = []string{"slog"}
+	opts.Slog.Handler = handler
+
+	output, err := newLogOutput(&opts)
+	if err != nil {
+		t.Fatalf("failed to create slog sink: %s", err)
+	}
+
+	logger, err := newLogger(&opts, output)
+	if err != nil {
+		t.Fatalf("failed to create logger: %s", err)
+	}
+
+	return logger, handler
+}
+
+func TestSlogFieldTypes(t *testing.T) {
+	timestamp := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    any
+		wantKind slog.Kind
+		want     any
+	}{
+		{name: "string", value: "value", wantKind: slog.KindString, want: "value"},
+		{name: "int", value: 42, wantKind: slog.KindInt64, want: int64(42)},
+		{name: "int32", value: int32(42), wantKind: slog.KindInt64, want: int64(42)},
+		{name: "int64", value: int64(42), wantKind: slog.KindInt64, want: int64(42)},
+		{name: "float64", value: 1.5, wantKind: slog.KindFloat64, want: 1.5},
+		{name: "bool", value: true, wantKind: slog.KindBool, want: true},
+		{name: "time", value: timestamp, wantKind: slog.KindTime, want: timestamp},
+		{name: "duration", value: 1500 * time.Millisecond, wantKind: slog.KindDuration, want: 1500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run("SlogLogger "+tt.name, func(t *testing.T) {
+			handler := newRecordingHandler()
+
+			NewSlogLogger(handler).WithField("field", tt.value).Info("message")
+
+			checkSlogField(t, handler, tt.wantKind, tt.want)
+		})
+
+		t.Run("Logger with slog sink "+tt.name, func(t *testing.T) {
+			logger, handler := newSlogSinkLogger(t, LoggerOptions{})
+
+			logger.WithField("field", tt.value).Info("message")
+
+			checkSlogField(t, handler, tt.wantKind, tt.want)
+		})
+
+		t.Run("Logger with slog sink WithFields "+tt.name, func(t *testing.T) {
+			logger, handler := newSlogSinkLogger(t, LoggerOptions{})
+
+			logger.WithFields(map[string]any{"field": tt.value}).Info("message")
+
+			checkSlogField(t, handler, tt.wantKind, tt.want)
+		})
+	}
+}
+
+func checkSlogField(t *testing.T, handler *recordingHandler, wantKind slog.Kind, want any) {
+	t.Helper()
+
+	entries := handler.entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	value, ok := entries[0].attrs["field"]
+	if !ok {
+		t.Fatalf("entry has no field attribute: %v", entries[0].attrs)
+	}
+
+	if value.Kind() != wantKind {
+		t.Errorf("got kind %s, want %s", value.Kind(), wantKind)
+	}
+
+	if got := value.Any(); got != want {
+		t.Errorf("got value %v (%T), want %v (%T)", got, got, want, want)
+	}
+}
+
+func TestSlogSink(t *testing.T) {
+	const knownSecret = "s3cr3t-value-from-config"
+
+	logger, handler := newSlogSinkLogger(t, LoggerOptions{
+		Secrets: []string{knownSecret},
+		Slog:    SlogSinkOptions{Level: "info"},
+	})
+
+	logger.Debug("dropped by the logger level")
+	logger.Levels().SetOverride(NewLogLevelSet(zerolog.DebugLevel), 0)
+	logger.Debug("dropped by the sink level")
+
+	logger.WithComponent("api").
+		WithField("password", "field-secret").
+		WithField("error", errors.New("auth failed for "+knownSecret)).
+		WithFields(map[string]any{"request": map[string]any{"token": "nested-secret"}}).
+		Errorf("failed with %s", knownSecret)
+
+	log.Info().Str("source", "global").Msg("from the global logger")
+
+	entries := handler.entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %v", len(entries), entries)
+	}
+
+	entry := entries[0]
+
+	if entry.level != slog.LevelError || entry.message != "failed with "+redactedValue {
+		t.Errorf("got %s entry %q, want an error with the secret redacted", entry.level, entry.message)
+	}
+
+	wantAttrs := map[string]string{
+		"component": "api",
+		"password":  redactedValue,
+		"error":     "auth failed for " + redactedValue,
+	}
+
+	for key, want := range wantAttrs {
+		if got := entry.attrs[key].String(); got != want {
+			t.Errorf("got %s %q, want %q", key, got, want)
+		}
+	}
+
+	request, ok := entry.attrs["request"].Any().(map[string]any)
+	if !ok || request["token"] != redactedValue {
+		t.Errorf("got request %v, want the nested token redacted", entry.attrs["request"])
+	}
+
+	if entries[1].message != "from the global logger" || entries[1].attrs["source"].String() != "global" {
+		t.Errorf("got %+v, want the global logger entry", entries[1])
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		level slog.Leveler
+		log   func(l *slog.Logger)
+		want  []map[string]any
+	}{
+		{
+			name: "levels are mapped to the logger levels",
+			log: func(l *slog.Logger) {
+				l.Debug("dropped by the handler level")
+				l.Info("info")
+				l.Warn("warning")
+				l.Error("error")
+			},
+			want: []map[string]any{
+				{"level": "info", "message": "info"},
+				{"level": "info", "message": "warning"},
+				{"level": "error", "message": "error"},
+			},
+		},
+		{
+			name:  "attributes keep their types",
+			level: slog.LevelDebug,
+			log: func(l *slog.Logger) {
+				l.With("count", 3).Info("typed", "elapsed", 1500*time.Millisecond, "ok", true)
+			},
+			want: []map[string]any{
+				{"message": "typed", "count": float64(3), "elapsed": float64(1500), "ok": true},
+			},
+		},
+		{
+			name: "groups are prefixes",
+			log: func(l *slog.Logger) {
+				l.WithGroup("http").Info("grouped", slog.Group("request", slog.String("method", "GET")))
+			},
+			want: []map[string]any{
+				{"message": "grouped", "http.request.method": "GET"},
+			},
+		},
+		{
+			name: "secret attributes are redacted",
+			log: func(l *slog.Logger) {
+				l.Info("secret", "api_key", "secret-value")
+			},
+			want: []map[string]any{
+				{"message": "secret", "api_key": redactedValue},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger(t, LoggerOptions{Verbose: true})
+
+			tt.log(slog.New(NewSlogHandler(logger, tt.level)))
+
+			entries := logEntries(t, buf)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d: %v", len(entries), len(tt.want), entries)
+			}
+
+			for i, want := range tt.want {
+				for key, value := range want {
+					if entries[i][key] != value {
+						t.Errorf("entry %d: got %s %v, want %v", i, key, entries[i][key], value)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,457 @@
+// Package sqlitestore implements types.DB on top of a SQLite file, with the pure Go modernc.org/sqlite driver.
+//
+// It is meant for small deployments and integration tests that want a database without any infrastructure,
+// which still survives restarts. The schema is versioned with migrations that are tracked in a schema migrations
+// table, in the same way as the Postgres plugin.
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/slackmgr/types"
+
+	_ "modernc.org/sqlite" // Registers the "sqlite" driver.
+)
+
+// busyTimeoutMillis is how long a statement waits for a lock held by another connection or process.
+const busyTimeoutMillis = 5000
+
+// DB implements types.DB on top of a SQLite file.
+type DB struct {
+	conn *sql.DB
+	opts *options
+}
+
+// Open opens the SQLite file at the given path, creating it if it doesn't exist.
+// Init must be called before the DB is used, to create or migrate the schema.
+func Open(path string, opts ...Option) (*DB, error) {
+	o := newOptions()
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)", url.PathEscape(path), busyTimeoutMillis)
+
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite file %s: %w", path, err)
+	}
+
+	// SQLite only allows one writer at a time, so a single connection avoids busy errors between our own writes.
+	conn.SetMaxOpenConns(1)
+
+	if err := conn.Ping(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to open SQLite file %s: %w", path, err)
+	}
+
+	return &DB{conn: conn, opts: o}, nil
+}
+
+// Close closes the SQLite file.
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
+// Init applies any schema migrations that have not been applied yet. It is safe to call more than once.
+// Schema validation is not supported, so skipSchemaValidation is ignored.
+func (db *DB) Init(ctx context.Context, _ bool) error {
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)", db.opts.schemaMigrationsTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	for _, m := range db.opts.migrations() {
+		if err := db.applyMigration(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) applyMigration(ctx context.Context, m migration) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+	}
+
+	defer func() { _ = tx.Rollback() }() // No-op if committed
+
+	var applied bool
+
+	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE version = ?)", db.opts.schemaMigrationsTable)
+
+	if err := tx.QueryRowContext(ctx, query, m.version).Scan(&applied); err != nil {
+		return fmt.Errorf("failed to check migration %d status: %w", m.version, err)
+	}
+
+	if applied {
+		return nil
+	}
+
+	for _, stmt := range m.stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to execute migration %d: %w", m.version, err)
+		}
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (version) VALUES (?)", db.opts.schemaMigrationsTable)
+
+	if _, err := tx.ExecContext(ctx, stmt, m.version); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+	}
+
+	return nil
+}
+
+// DropAllData drops all tables, including the schema migrations table. Init must be called again afterwards.
+func (db *DB) DropAllData(ctx context.Context) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin drop tables transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }() // No-op if committed
+
+	for _, stmt := range db.opts.dropStatements() {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to execute drop statement: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit drop tables transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAlert creates or updates an alert.
+func (db *DB) SaveAlert(ctx context.Context, alert *types.Alert) error {
+	if alert == nil {
+		return errors.New("alert is nil")
+	}
+
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (id, attrs) VALUES (?, ?) ON CONFLICT (id) DO UPDATE SET attrs = excluded.attrs", db.opts.alertsTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt, alert.UniqueID(), string(body)); err != nil {
+		return fmt.Errorf("failed to save alert to SQLite db: %w", err)
+	}
+
+	return nil
+}
+
+// SaveIssue creates or updates a single issue.
+func (db *DB) SaveIssue(ctx context.Context, issue types.Issue) error {
+	return db.SaveIssues(ctx, issue)
+}
+
+// SaveIssues creates or updates multiple issues, in a single transaction.
+func (db *DB) SaveIssues(ctx context.Context, issues ...types.Issue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	for _, issue := range issues {
+		if issue == nil {
+			return errors.New("issue is nil")
+		}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin save issues transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }() // No-op if committed
+
+	stmt := fmt.Sprintf("INSERT INTO %s (id, channel_id, correlation_id, is_open, slack_post_id, attrs) VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET channel_id = excluded.channel_id, correlation_id = excluded.correlation_id, is_open = excluded.is_open, slack_post_id = excluded.slack_post_id, attrs = excluded.attrs", db.opts.issuesTable)
+
+	for _, issue := range issues {
+		body, err := issue.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal issue: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, stmt, issue.UniqueID(), issue.ChannelID(), issue.GetCorrelationID(), issue.IsOpen(), nullString(issue.CurrentPostID()), string(body))
+		if err != nil {
+			return fmt.Errorf("failed to save issue to SQLite db: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit save issues transaction: %w", err)
+	}
+
+	return nil
+}
+
+// MoveIssue moves an issue from one channel to another.
+// Returns an error if sourceChannelID and targetChannelID are the same.
+// If the issue does not exist in the database, this is a no-op.
+func (db *DB) MoveIssue(ctx context.Context, issue types.Issue, sourceChannelID, targetChannelID string) error {
+	if sourceChannelID == targetChannelID {
+		return errors.New("source and target channel IDs are the same")
+	}
+
+	if issue == nil {
+		return errors.New("issue is nil")
+	}
+
+	body, err := issue.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal issue: %w", err)
+	}
+
+	stmt := fmt.Sprintf("UPDATE %s SET channel_id = ?, is_open = ?, slack_post_id = ?, attrs = ? WHERE id = ?", db.opts.issuesTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt, targetChannelID, issue.IsOpen(), nullString(issue.CurrentPostID()), string(body), issue.UniqueID()); err != nil {
+		return fmt.Errorf("failed to move issue in SQLite db: %w", err)
+	}
+
+	return nil
+}
+
+// FindOpenIssueByCorrelationID finds a single open issue by channel ID and correlation ID.
+// Returns an error if channelID or correlationID are empty.
+func (db *DB) FindOpenIssueByCorrelationID(ctx context.Context, channelID, correlationID string) (string, json.RawMessage, error) {
+	if channelID == "" {
+		return "", nil, errors.New("channelID is required")
+	}
+
+	if correlationID == "" {
+		return "", nil, errors.New("correlationID is required")
+	}
+
+	query := fmt.Sprintf("SELECT id, attrs FROM %s WHERE channel_id = ? AND correlation_id = ? AND is_open = 1 LIMIT 1", db.opts.issuesTable)
+
+	id, body, err := db.findIssue(ctx, query, channelID, correlationID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find issue by correlation ID in SQLite db: %w", err)
+	}
+
+	return id, body, nil
+}
+
+// FindIssueBySlackPostID finds a single issue by channel ID and Slack post ID.
+// Returns an error if channelID or postID are empty.
+func (db *DB) FindIssueBySlackPostID(ctx context.Context, channelID, postID string) (string, json.RawMessage, error) {
+	if channelID == "" {
+		return "", nil, errors.New("channelID is required")
+	}
+
+	if postID == "" {
+		return "", nil, errors.New("postID is required")
+	}
+
+	query := fmt.Sprintf("SELECT id, attrs FROM %s WHERE channel_id = ? AND slack_post_id = ? LIMIT 1", db.opts.issuesTable)
+
+	id, body, err := db.findIssue(ctx, query, channelID, postID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to find issue by Slack post ID in SQLite db: %w", err)
+	}
+
+	return id, body, nil
+}
+
+// FindActiveChannels returns a list of all channels that have at least one open issue.
+func (db *DB) FindActiveChannels(ctx context.Context) ([]string, error) {
+	query := fmt.Sprintf("SELECT DISTINCT channel_id FROM %s WHERE is_open = 1", db.opts.issuesTable)
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find active channels in SQLite db: %w", err)
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	channels := []string{}
+
+	for rows.Next() {
+		var channelID string
+
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, fmt.Errorf("failed to scan row for active channel: %w", err)
+		}
+
+		channels = append(channels, channelID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows for active channels: %w", err)
+	}
+
+	return channels, nil
+}
+
+// LoadOpenIssuesInChannel loads all open issues for the specified channel.
+func (db *DB) LoadOpenIssuesInChannel(ctx context.Context, channelID string) (map[string]json.RawMessage, error) {
+	query := fmt.Sprintf("SELECT id, attrs FROM %s WHERE channel_id = ? AND is_open = 1", db.opts.issuesTable)
+
+	rows, err := db.conn.QueryContext(ctx, query, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load open issues from SQLite db: %w", err)
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	issues := make(map[string]json.RawMessage)
+
+	for rows.Next() {
+		var id, body string
+
+		if err := rows.Scan(&id, &body); err != nil {
+			return nil, fmt.Errorf("failed to load open issues from SQLite db: %w", err)
+		}
+
+		issues[id] = json.RawMessage(body)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows in SQLite db: %w", err)
+	}
+
+	return issues, nil
+}
+
+// SaveMoveMapping creates or updates a move mapping.
+func (db *DB) SaveMoveMapping(ctx context.Context, moveMapping types.MoveMapping) error {
+	if moveMapping == nil {
+		return errors.New("moveMapping is nil")
+	}
+
+	body, err := moveMapping.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal move mapping: %w", err)
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (id, channel_id, correlation_id, attrs) VALUES (?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET attrs = excluded.attrs", db.opts.moveMappingsTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt, moveMapping.UniqueID(), moveMapping.ChannelID(), moveMapping.GetCorrelationID(), string(body)); err != nil {
+		return fmt.Errorf("failed to save move mapping to SQLite db: %w", err)
+	}
+
+	return nil
+}
+
+// FindMoveMapping finds a move mapping by channel ID and correlation ID.
+// Returns an error if channelID or correlationID are empty.
+func (db *DB) FindMoveMapping(ctx context.Context, channelID, correlationID string) (json.RawMessage, error) {
+	if channelID == "" {
+		return nil, errors.New("channelID is required")
+	}
+
+	if correlationID == "" {
+		return nil, errors.New("correlationID is required")
+	}
+
+	query := fmt.Sprintf("SELECT attrs FROM %s WHERE channel_id = ? AND correlation_id = ? LIMIT 1", db.opts.moveMappingsTable)
+
+	var body string
+
+	if err := db.conn.QueryRowContext(ctx, query, channelID, correlationID).Scan(&body); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to find move mapping in SQLite db: %w", err)
+	}
+
+	return json.RawMessage(body), nil
+}
+
+// DeleteMoveMapping deletes a move mapping. No error is returned if the mapping does not exist.
+func (db *DB) DeleteMoveMapping(ctx context.Context, channelID, correlationID string) error {
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE channel_id = ? AND correlation_id = ?", db.opts.moveMappingsTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt, channelID, correlationID); err != nil {
+		return fmt.Errorf("failed to delete move mapping from SQLite db: %w", err)
+	}
+
+	return nil
+}
+
+// SaveChannelProcessingState creates or updates a channel processing state.
+func (db *DB) SaveChannelProcessingState(ctx context.Context, state *types.ChannelProcessingState) error {
+	if state == nil {
+		return errors.New("state is nil")
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal channel processing state: %w", err)
+	}
+
+	stmt := fmt.Sprintf("INSERT INTO %s (channel_id, attrs) VALUES (?, ?) ON CONFLICT (channel_id) DO UPDATE SET attrs = excluded.attrs", db.opts.channelProcessingStateTable)
+
+	if _, err := db.conn.ExecContext(ctx, stmt, state.ChannelID, string(body)); err != nil {
+		return fmt.Errorf("failed to save channel processing state to SQLite db: %w", err)
+	}
+
+	return nil
+}
+
+// FindChannelProcessingState finds a channel processing state by channel ID.
+// Returns nil without an error if no state is found.
+func (db *DB) FindChannelProcessingState(ctx context.Context, channelID string) (*types.ChannelProcessingState, error) {
+	query := fmt.Sprintf("SELECT attrs FROM %s WHERE channel_id = ?", db.opts.channelProcessingStateTable)
+
+	var body string
+
+	if err := db.conn.QueryRowContext(ctx, query, channelID).Scan(&body); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil //nolint:nilnil // DB interface contract: return nil, nil when not found
+		}
+
+		return nil, fmt.Errorf("failed to find channel processing state in SQLite db: %w", err)
+	}
+
+	state := &types.ChannelProcessingState{}
+
+	if err := json.Unmarshal([]byte(body), state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal channel processing state: %w", err)
+	}
+
+	return state, nil
+}
+
+// findIssue runs a query that selects the id and attrs of at most one issue.
+func (db *DB) findIssue(ctx context.Context, query string, args ...any) (string, json.RawMessage, error) {
+	var id, body string
+
+	if err := db.conn.QueryRowContext(ctx, query, args...).Scan(&id, &body); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, nil
+		}
+
+		return "", nil, err
+	}
+
+	return id, json.RawMessage(body), nil
+}
+
+// nullString maps an empty string to NULL, so that the unique indexes ignore it.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,127 @@
+package sqlitestore
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/slackmgr/examples/hostkit/dbconformance"
+	"github.com/slackmgr/types"
+)
+
+// openTestDB opens and initializes a database file, which is closed when the test ends.
+func openTestDB(t *testing.T, path string, opts ...Option) *DB {
+	t.Helper()
+
+	db, err := Open(path, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.Init(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestDBConformance(t *testing.T) {
+	factory := func(context.Context) (types.DB, error) {
+		return openTestDB(t, filepath.Join(t.TempDir(), "slackmgr.db")), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, result := range dbconformance.Run(ctx, factory) {
+		if result.Err != nil {
+			t.Errorf("%s: %s", result.Check, result.Err)
+		}
+	}
+}
+
+func TestDBConformanceWithReset(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "slackmgr.db"), WithIssuesTable("custom_issues"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// The checks share one file, which is dropped and migrated again before each check.
+	for _, result := range dbconformance.Run(ctx, dbconformance.ResetFactory(db)) {
+		if result.Err != nil {
+			t.Errorf("%s: %s", result.Check, result.Err)
+		}
+	}
+}
+
+// appliedMigrations returns the number of rows per version in the schema migrations table, ordered by version.
+func appliedMigrations(t *testing.T, db *DB) map[int]int {
+	t.Helper()
+
+	rows, err := db.conn.QueryContext(context.Background(), "SELECT version, COUNT(*) FROM schema_migrations GROUP BY version ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	applied := map[int]int{}
+
+	for rows.Next() {
+		var version, count int
+
+		if err := rows.Scan(&version, &count); err != nil {
+			t.Fatal(err)
+		}
+
+		applied[version] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return applied
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "slackmgr.db")
+
+	db := openTestDB(t, path)
+
+	state := types.NewChannelProcessingState("C1")
+	if err := db.SaveChannelProcessingState(ctx, state); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opening the file again keeps the data and the recorded migrations, and applies no migration twice.
+	db = openTestDB(t, path)
+
+	if got, want := appliedMigrations(t, db), map[int]int{1: 1, 2: 1}; !maps.Equal(got, want) {
+		t.Errorf("got migration rows %v after reopening, want %v", got, want)
+	}
+
+	found, err := db.FindChannelProcessingState(ctx, "C1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found == nil || found.ChannelID != "C1" {
+		t.Errorf("got state %+v after reopening, want the saved state", found)
+	}
+}
+
+func TestOpenInvalidTableName(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "slackmgr.db"), WithAlertsTable("alerts; DROP TABLE issues")); err == nil {
+		t.Error("got no error for an invalid table name")
+	}
+}
@@ -0,0 +1,122 @@
+package sqlitestore
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// validIdentifier matches the table names that can be used in the SQL statements without quoting.
+var validIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Option configures a DB.
+type Option func(*options)
+
+type options struct {
+	issuesTable                 string
+	alertsTable                 string
+	moveMappingsTable           string
+	channelProcessingStateTable string
+	schemaMigrationsTable       string
+}
+
+func newOptions() *options {
+	return &options{
+		issuesTable:                 "issues",
+		alertsTable:                 "alerts",
+		moveMappingsTable:           "move_mappings",
+		channelProcessingStateTable: "channel_processing_state",
+		schemaMigrationsTable:       "schema_migrations",
+	}
+}
+
+// WithIssuesTable sets the name of the issues table. Defaults to "issues".
+func WithIssuesTable(name string) Option {
+	return func(o *options) { o.issuesTable = name }
+}
+
+// WithAlertsTable sets the name of the alerts table. Defaults to "alerts".
+func WithAlertsTable(name string) Option {
+	return func(o *options) { o.alertsTable = name }
+}
+
+// WithMoveMappingsTable sets the name of the move mappings table. Defaults to "move_mappings".
+func WithMoveMappingsTable(name string) Option {
+	return func(o *options) { o.moveMappingsTable = name }
+}
+
+// WithChannelProcessingStateTable sets the name of the channel processing state table.
+// Defaults to "channel_processing_state".
+func WithChannelProcessingStateTable(name string) Option {
+	return func(o *options) { o.channelProcessingStateTable = name }
+}
+
+// WithSchemaMigrationsTable sets the name of the table used to track applied schema migrations.
+// Defaults to "schema_migrations".
+func WithSchemaMigrationsTable(name string) Option {
+	return func(o *options) { o.schemaMigrationsTable = name }
+}
+
+func (o *options) validate() error {
+	tables := []struct{ kind, name string }{
+		{"issues", o.issuesTable},
+		{"alerts", o.alertsTable},
+		{"move mappings", o.moveMappingsTable},
+		{"channel processing state", o.channelProcessingStateTable},
+		{"schema migrations", o.schemaMigrationsTable},
+	}
+
+	for _, table := range tables {
+		if !validIdentifier.MatchString(table.name) {
+			return fmt.Errorf("invalid %s table name %q", table.kind, table.name)
+		}
+	}
+
+	return nil
+}
+
+// migration holds a versioned set of SQL statements that are applied once, and recorded in the schema migrations table.
+type migration struct {
+	version int
+	stmts   []string
+}
+
+// migrations returns the ordered list of schema migrations, with the same versions as the Postgres plugin.
+// To add a new migration, append an entry with the next version number. Never change an applied migration.
+func (o *options) migrations() []migration {
+	return []migration{
+		{
+			version: 1,
+			stmts: []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, channel_id TEXT NOT NULL, correlation_id TEXT NOT NULL, is_open INTEGER NOT NULL, slack_post_id TEXT NULL, attrs TEXT NOT NULL)`, o.issuesTable),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_channel_correlation_idx ON %s (channel_id, correlation_id)`, o.issuesTable, o.issuesTable),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_channel_slack_post_idx ON %s (channel_id, slack_post_id)`, o.issuesTable, o.issuesTable),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_is_open_idx ON %s (is_open) WHERE is_open = 1`, o.issuesTable, o.issuesTable),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, attrs TEXT NOT NULL)`, o.alertsTable),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (id TEXT PRIMARY KEY, channel_id TEXT NOT NULL, correlation_id TEXT NOT NULL, attrs TEXT NOT NULL)`, o.moveMappingsTable),
+				fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_channel_correlation_idx ON %s (channel_id, correlation_id)`, o.moveMappingsTable, o.moveMappingsTable),
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (channel_id TEXT PRIMARY KEY, attrs TEXT NOT NULL)`, o.channelProcessingStateTable),
+			},
+		},
+		{
+			version: 2,
+			stmts: []string{
+				// At most one open issue per channel and correlation ID.
+				fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s_open_channel_correlation_uniq ON %s (channel_id, correlation_id) WHERE is_open = 1`, o.issuesTable, o.issuesTable),
+				// At most one issue per channel and Slack post ID. NULLs are distinct in unique indexes.
+				fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s_channel_slack_post_uniq ON %s (channel_id, slack_post_id)`, o.issuesTable, o.issuesTable),
+				// At most one move mapping per channel and correlation ID.
+				fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS %s_channel_correlation_uniq ON %s (channel_id, correlation_id)`, o.moveMappingsTable, o.moveMappingsTable),
+			},
+		},
+	}
+}
+
+func (o *options) dropStatements() []string {
+	return []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", o.issuesTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", o.alertsTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", o.moveMappingsTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", o.channelProcessingStateTable),
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", o.schemaMigrationsTable),
+	}
+}
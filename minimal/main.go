@@ -2,24 +2,22 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"runtime/debug"
-	"syscall"
 	"time"
 
-	"github.com/rs/zerolog/log"
 	managerconfig "github.com/slackmgr/core/config"
 	managerpkg "github.com/slackmgr/core/manager"
 	api "github.com/slackmgr/core/restapi"
+	"github.com/slackmgr/examples/hostkit"
+	"github.com/slackmgr/examples/hostkit/boltstore"
 	"github.com/slackmgr/types"
 	"golang.org/x/sync/errgroup"
 )
 
 func main() {
-	exitMain(mainImpl())
+	hostkit.ExitMain(mainImpl())
 }
 
 func mainImpl() (retErr error) {
@@ -32,18 +30,42 @@ func mainImpl() (retErr error) {
 		}
 	}()
 
-	go handleSignals(ctx, cancel)
+	go hostkit.HandleSignals(ctx, cancel, hostkit.SignalOptions{})
 
-	logger := newLogger()
+	// Create a logger with debug logging, writing human-readable output to stderr.
+	// The Slack tokens are redacted if they ever appear in the log.
+	logger, err := hostkit.NewLogger(hostkit.LoggerOptions{
+		Verbose: true,
+		Secrets: []string{os.Getenv("SLACK_BOT_TOKEN"), os.Getenv("SLACK_APP_TOKEN")},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
 
-	// Create an in-memory alert queue. Do not use this in production!
-	alertQueue := types.NewInMemoryFifoQueue("alerts", 1000, 5*time.Second)
+	// Create the queues and the database. If DATA_FILE is set, they are stored in that file and survive restarts.
+	// Otherwise, they are kept in memory. Do not use the in-memory versions in production!
+	var alertQueue, commandQueue managerpkg.FifoQueue
+	var db types.DB
 
-	// Create an in-memory command queue. Do not use this in production!
-	commandQueue := types.NewInMemoryFifoQueue("commands", 1000, 5*time.Second)
+	if dataFile := os.Getenv("DATA_FILE"); dataFile != "" {
+		store, err := boltstore.Open(dataFile)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = store.Close() }()
 
-	// Create an in-memory database. Do not use this in production!
-	db := types.NewInMemoryDB()
+		alertQueue = store.Queue("alerts")
+		commandQueue = store.Queue("commands")
+		db = store.DB()
+
+		if err := db.Init(ctx, false); err != nil {
+			return err
+		}
+	} else {
+		alertQueue = types.NewInMemoryFifoQueue("alerts", 1000, 5*time.Second)
+		commandQueue = types.NewInMemoryFifoQueue("commands", 1000, 5*time.Second)
+		db = types.NewInMemoryDB()
+	}
 
 	// Create a minimal manager config.
 	managerCfg := managerconfig.NewDefaultManagerConfig()
@@ -89,35 +111,3 @@ func mainImpl() (retErr error) {
 
 	return errg.Wait()
 }
-
-// handleSignals listens for OS signals and cancels the context when a termination signal is received.
-func handleSignals(ctx context.Context, cancel context.CancelFunc) {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
-	defer signal.Stop(signals)
-
-	select {
-	case <-ctx.Done():
-	case sig := <-signals:
-		log.Info().Msgf("Signal %s received", sig)
-		cancel()
-	}
-}
-
-// exitMain handles the application exit logic based on the provided error.
-func exitMain(err error) {
-	var returnCode int
-
-	switch {
-	case err == nil:
-		returnCode = 0
-	case errors.Is(err, context.Canceled):
-		returnCode = 0
-		log.Info().Msgf("Application canceled: %s", err)
-	default:
-		returnCode = 1
-		log.Error().Msgf("Application failed: %s", err)
-	}
-
-	os.Exit(returnCode)
-}